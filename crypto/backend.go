@@ -0,0 +1,174 @@
+// ThreatSpec package github.com/pki-io/core/crypto as crypto
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Signer performs signing with a private key that may not be directly accessible, such as a key held in an HSM.
+type Signer interface {
+	Sign(message string, signature *Signed) error
+}
+
+// Decrypter performs group decryption with a private key that may not be directly accessible, such as a key held in an HSM.
+type Decrypter interface {
+	Decrypt(encrypted *Encrypted, keyID string) (string, error)
+	// UnwrapKey returns the data key wrapped for the key ID, so that several ciphertexts sharing it, such as a container
+	// body and its encrypted options, can be decrypted with DecryptWithDataKey after a single unwrap. It returns
+	// ErrNotARecipient if the key ID isn't a recipient, which shouldn't take noticeably less time than an unwrap.
+	UnwrapKey(encrypted *Encrypted, keyID string) ([]byte, error)
+}
+
+// PemSigner is a Signer backed by an in-memory PEM encoded private key.
+type PemSigner struct {
+	privateKey string
+}
+
+// ThreatSpec TMv0.1 for NewPemSigner
+// Creates new in-memory signer for App:Crypto
+
+// NewPemSigner returns a Signer for the given PEM encoded private key.
+func NewPemSigner(privateKeyPem string) *PemSigner {
+	return &PemSigner{privateKey: privateKeyPem}
+}
+
+// ThreatSpec TMv0.1 for PemSigner.Sign
+// Does message signing with an in-memory key for App:Crypto
+
+// Sign signs the message using the PEM encoded private key.
+func (signer *PemSigner) Sign(message string, signature *Signed) error {
+	return Sign(message, signer.privateKey, signature)
+}
+
+// PemDecrypter is a Decrypter backed by an in-memory PEM encoded private key.
+type PemDecrypter struct {
+	privateKey string
+}
+
+// ThreatSpec TMv0.1 for NewPemDecrypter
+// Creates new in-memory decrypter for App:Crypto
+
+// NewPemDecrypter returns a Decrypter for the given PEM encoded private key.
+func NewPemDecrypter(privateKeyPem string) *PemDecrypter {
+	return &PemDecrypter{privateKey: privateKeyPem}
+}
+
+// ThreatSpec TMv0.1 for PemDecrypter.Decrypt
+// Does hybrid decryption with an in-memory key for App:Crypto
+
+// Decrypt group decrypts using the PEM encoded private key.
+func (decrypter *PemDecrypter) Decrypt(encrypted *Encrypted, keyID string) (string, error) {
+	return GroupDecrypt(encrypted, keyID, decrypter.privateKey)
+}
+
+// UnwrapKey unwraps the data key using the PEM encoded private key.
+func (decrypter *PemDecrypter) UnwrapKey(encrypted *Encrypted, keyID string) ([]byte, error) {
+	privateKey, err := PemDecodePrivate([]byte(decrypter.privateKey))
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode private key: %s", err)
+	}
+	return unwrapKey(encrypted, keyID, privateKey)
+}
+
+// PSKDecrypter is a Decrypter backed by the pre-shared key of a PSKRecipient.
+type PSKDecrypter struct {
+	key []byte
+}
+
+// ThreatSpec TMv0.1 for NewPSKDecrypter
+// Creates new pre-shared key decrypter for App:Crypto
+
+// NewPSKDecrypter returns a Decrypter for the given pre-shared key.
+func NewPSKDecrypter(key []byte) *PSKDecrypter {
+	return &PSKDecrypter{key: key}
+}
+
+// ThreatSpec TMv0.1 for PSKDecrypter.Decrypt
+// Does hybrid decryption with a pre-shared key for App:Crypto
+
+// Decrypt group decrypts using the pre-shared key.
+func (decrypter *PSKDecrypter) Decrypt(encrypted *Encrypted, keyID string) (string, error) {
+	return GroupDecryptWithPSK(encrypted, keyID, decrypter.key)
+}
+
+// UnwrapKey unwraps the data key using the pre-shared key.
+func (decrypter *PSKDecrypter) UnwrapKey(encrypted *Encrypted, keyID string) ([]byte, error) {
+	return unwrapKeyWithPSK(encrypted, keyID, decrypter.key)
+}
+
+// ErrKeyZeroed is returned when a KeyDecrypter is used after its key has been zeroed.
+var ErrKeyZeroed = errors.New("Key has been zeroed")
+
+// KeyDecrypter is a Decrypter backed by a parsed private key, avoiding PEM decoding on each decryption.
+type KeyDecrypter struct {
+	privateKey crypto.PrivateKey
+}
+
+// ThreatSpec TMv0.1 for NewKeyDecrypter
+// Creates new parsed key decrypter for App:Crypto
+
+// NewKeyDecrypter returns a Decrypter for the given PEM encoded private key, which is parsed once.
+func NewKeyDecrypter(privateKeyPem string) (*KeyDecrypter, error) {
+	privateKey, err := PemDecodePrivate([]byte(privateKeyPem))
+	if err != nil {
+		return nil, err
+	}
+	return &KeyDecrypter{privateKey: privateKey}, nil
+}
+
+// ThreatSpec TMv0.1 for KeyDecrypter.Decrypt
+// Does hybrid decryption with a parsed key for App:Crypto
+
+// Decrypt group decrypts using the parsed private key. It returns ErrKeyZeroed after Zero has been called.
+func (decrypter *KeyDecrypter) Decrypt(encrypted *Encrypted, keyID string) (string, error) {
+	if decrypter.privateKey == nil {
+		return "", ErrKeyZeroed
+	}
+	return GroupDecryptWithKey(encrypted, keyID, decrypter.privateKey)
+}
+
+// UnwrapKey unwraps the data key using the parsed private key. It returns ErrKeyZeroed after Zero has been called.
+func (decrypter *KeyDecrypter) UnwrapKey(encrypted *Encrypted, keyID string) ([]byte, error) {
+	if decrypter.privateKey == nil {
+		return nil, ErrKeyZeroed
+	}
+	return unwrapKey(encrypted, keyID, decrypter.privateKey)
+}
+
+// ThreatSpec TMv0.1 for KeyDecrypter.Zero
+// Mitigates App:Crypto against private key disclosure from memory with zeroing of key material
+
+// Zero overwrites the private key material and releases the key.
+// This is best effort, as copies made by the runtime or standard library can't be reached.
+func (decrypter *KeyDecrypter) Zero() {
+	switch k := decrypter.privateKey.(type) {
+	case *rsa.PrivateKey:
+		zeroBigInt(k.D)
+		for _, prime := range k.Primes {
+			zeroBigInt(prime)
+		}
+		zeroBigInt(k.Precomputed.Dp)
+		zeroBigInt(k.Precomputed.Dq)
+		zeroBigInt(k.Precomputed.Qinv)
+	case *ecdsa.PrivateKey:
+		zeroBigInt(k.D)
+	}
+	decrypter.privateKey = nil
+}
+
+// zeroBigInt overwrites the words of b with zeros.
+func zeroBigInt(b *big.Int) {
+	if b == nil {
+		return
+	}
+	words := b.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	b.SetInt64(0)
+}
@@ -2,9 +2,15 @@
 package crypto
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
+	"errors"
 	"fmt"
 )
 
@@ -13,12 +19,77 @@ type Mode string
 
 // Signature modes
 const (
-	SignatureModeSha256Rsa   Mode = "sha256+rsa"
-	SignatureModeSha256Ecdsa Mode = "sha256+ecdsa"
-	SignatureModeSha256Hmac  Mode = "sha256+hmac"
+	SignatureModeSha256Rsa    Mode = "sha256+rsa"
+	SignatureModeSha256RsaPss Mode = "sha256+rsa-pss"
+	SignatureModeSha256Ecdsa  Mode = "sha256+ecdsa"
+	SignatureModeSha256Hmac   Mode = "sha256+hmac"
 )
 
-// TODO - encryption mode consts
+// SignatureStrength ranks signature modes so that weak modes can be refused by policy.
+type SignatureStrength int
+
+// Signature strengths, weakest first
+const (
+	// SignatureStrengthNone is the strength of unknown or missing signature modes.
+	SignatureStrengthNone SignatureStrength = iota
+	// SignatureStrengthLegacy is the strength of PKCS#1 v1.5 RSA signatures.
+	SignatureStrengthLegacy
+	// SignatureStrengthStandard is the strength of RSA-PSS and ECDSA signatures and HMACs.
+	SignatureStrengthStandard
+)
+
+// Encryption modes
+const (
+	EncryptionModeAesCbc256    Mode = "aes-cbc-256"
+	EncryptionModeAesCbc256Rsa Mode = "aes-cbc-256+rsa"
+	EncryptionModeAesGcm256Rsa Mode = "aes-gcm-256+rsa"
+	EncryptionModeAesGcm256    Mode = "aes-gcm-256"
+)
+
+// Key wrap algorithms, recorded per recipient by GroupEncrypt
+const (
+	// KeyWrapRsaOaep wraps the data key with RSA-OAEP using SHA-256, for RSA recipients.
+	KeyWrapRsaOaep = "rsa-oaep-sha256"
+	// KeyWrapEcies wraps the data key with ECIES, for EC recipients.
+	KeyWrapEcies = "ecies"
+	// KeyWrapAesKw wraps the data key with AES key wrap, for pre-shared key recipients.
+	KeyWrapAesKw = "aes-kw"
+)
+
+// ErrAuthenticationFailed is returned when an authenticated ciphertext or its additional data has been modified.
+var ErrAuthenticationFailed = errors.New("Could not authenticate ciphertext")
+
+// Errors returned by GroupDecrypt for each stage of decryption
+var (
+	// ErrNotARecipient is returned when the ciphertext has no wrapped key for the key ID.
+	ErrNotARecipient = errors.New("Not a recipient")
+	// ErrWrappedKeyUnwrapFailed is returned when the wrapped key can't be decrypted with the private key.
+	ErrWrappedKeyUnwrapFailed = errors.New("Could not unwrap key")
+	// ErrPayloadAuthFailed is returned when the payload can't be authenticated or decrypted with the unwrapped key.
+	// It is the same error as ErrAuthenticationFailed.
+	ErrPayloadAuthFailed = ErrAuthenticationFailed
+)
+
+// ErrNoRecipients is returned when encrypting for no recipients, which would give a ciphertext no one can decrypt.
+var ErrNoRecipients = errors.New("No recipients")
+
+// ErrInvalidRecipient is returned by ValidateRecipients when a recipient has no id or its key can't be used.
+var ErrInvalidRecipient = errors.New("Invalid recipient")
+
+// ErrDuplicateRecipient is returned by ValidateRecipients when more than one recipient has the same id.
+var ErrDuplicateRecipient = errors.New("Duplicate recipient")
+
+// ErrTruncatedCiphertext is returned when a ciphertext is too short to be complete for its encryption mode.
+var ErrTruncatedCiphertext = errors.New("Ciphertext is truncated")
+
+// ErrInvalidNonce is returned when a ciphertext's nonce or IV has the wrong length or is degenerate.
+var ErrInvalidNonce = errors.New("Invalid nonce")
+
+// gcmNonceSize is the size in bytes of AES-GCM nonces.
+const gcmNonceSize int = 12
+
+// gcmTagSize is the size in bytes of the authentication tag appended to AES-GCM ciphertexts.
+const gcmTagSize int = 16
 
 // Encrypted represents a ciphertext with related inputs
 type Encrypted struct {
@@ -26,6 +97,8 @@ type Encrypted struct {
 	Mode       string
 	Inputs     map[string]string
 	Keys       map[string]string
+	// KeyAlgorithms are the key wrap algorithms by key ID. Older ciphertexts don't record them.
+	KeyAlgorithms map[string]string
 }
 
 // Signed represents a signature and related inputs
@@ -35,6 +108,18 @@ type Signed struct {
 	Signature string
 }
 
+// ThreatSpec TMv0.1 for ModeStrength
+// Returns strength of signature mode for App:Crypto
+
+// ModeStrength returns the strength of the given signature mode from the ModeRegistry. Unknown modes return SignatureStrengthNone.
+func ModeStrength(mode Mode) SignatureStrength {
+	scheme, err := LookupMode(mode)
+	if err != nil {
+		return SignatureStrengthNone
+	}
+	return scheme.Strength
+}
+
 // ThreatSpec TMv0.1 for NewSignature
 // Does new signature creation for App:Crypto
 
@@ -48,30 +133,141 @@ func NewSignature(mode Mode) *Signed {
 
 // GroupEncrypt takes a plaintext and encrypts with one or more public keys.
 func GroupEncrypt(plaintext string, publicKeys map[string]string) (*Encrypted, error) {
+	encrypted, _, err := GroupEncryptForEscrow(plaintext, publicKeys)
+	return encrypted, err
+}
+
+// ThreatSpec TMv0.1 for GroupEncryptForEscrow
+// Does hybrid encryption returning the data key for escrow for App:Crypto
+// Mitigates App:Crypto against accidental data key disclosure with key only returned by explicit escrow function
+
+// GroupEncryptForEscrow is like GroupEncrypt, but also returns the raw data key so that it can be escrowed.
+// Anyone with the data key can decrypt the ciphertext without a private key, using DecryptWithDataKey,
+// so it must be protected at least as well as the recipients' private keys.
+func GroupEncryptForEscrow(plaintext string, publicKeys map[string]string) (*Encrypted, []byte, error) {
+	return GroupEncryptForRecipients(plaintext, PublicKeyRecipients(publicKeys))
+}
+
+// ThreatSpec TMv0.1 for GroupEncryptForRecipients
+// Does hybrid encryption for one or more recipients for App:Crypto
+
+// GroupEncryptForRecipients is like GroupEncryptForEscrow, but takes recipients, which may have different key types.
+func GroupEncryptForRecipients(plaintext string, recipients []Recipient) (*Encrypted, []byte, error) {
+	keySize := 32
+	key, err := RandomBytes(keySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphertext, iv, err := aesCBCEncryptString(plaintext, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	inputs := make(map[string]string)
+	inputs["iv"] = string(Base64Encode(iv))
+
+	encryptedKeys, keyAlgorithms, err := wrapKeys(key, recipients)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &Encrypted{Ciphertext: ciphertext, Mode: string(EncryptionModeAesCbc256Rsa), Inputs: inputs, Keys: encryptedKeys, KeyAlgorithms: keyAlgorithms}, key, nil
+}
+
+// ThreatSpec TMv0.1 for GroupEncryptWithAAD
+// Does hybrid authenticated encryption with one or more public keys for App:Crypto
+// Mitigates App:Crypto against ciphertext tampering with AES in GCM mode
 
+// GroupEncryptWithAAD takes a plaintext and encrypts with one or more public keys using an authenticated cipher.
+// The additional data is bound to the ciphertext and recorded in the inputs so that it can be checked on decryption.
+func GroupEncryptWithAAD(plaintext string, publicKeys map[string]string, additionalData string) (*Encrypted, error) {
+	return groupEncryptWithAAD([]byte(plaintext), PublicKeyRecipients(publicKeys), additionalData)
+}
+
+// groupEncryptWithAAD encrypts the plaintext using AES in GCM mode with the additional data, wrapping the data key for each recipient.
+func groupEncryptWithAAD(plaintext []byte, recipients []Recipient, additionalData string) (*Encrypted, error) {
 	keySize := 32
 	key, err := RandomBytes(keySize)
 	if err != nil {
 		return nil, err
 	}
-	ciphertext, iv, err := AESEncrypt([]byte(plaintext), key)
+	ciphertext, nonce, err := AESGCMEncrypt(plaintext, key, []byte(additionalData))
 	if err != nil {
 		return nil, err
 	}
 	inputs := make(map[string]string)
-	inputs["iv"] = string(Base64Encode(iv))
+	inputs["nonce"] = string(Base64Encode(nonce))
+	inputs["aad"] = string(Base64Encode([]byte(additionalData)))
+
+	encryptedKeys, keyAlgorithms, err := wrapKeys(key, recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Encrypted{Ciphertext: string(Base64Encode(ciphertext)), Mode: string(EncryptionModeAesGcm256Rsa), Inputs: inputs, Keys: encryptedKeys, KeyAlgorithms: keyAlgorithms}, nil
+}
 
+// ThreatSpec TMv0.1 for wrapKeys
+// Does data key wrapping with one or more public keys for App:Crypto
+
+// wrapKeys wraps the data key for each of the recipients, returning the base64 encoded wrapped keys and the key wrap algorithms by id.
+// Recipients can be mixed, with each key wrapped using the algorithm for its type. It returns ErrNoRecipients if there are none.
+func wrapKeys(key []byte, recipients []Recipient) (map[string]string, map[string]string, error) {
+	if len(recipients) == 0 {
+		return nil, nil, ErrNoRecipients
+	}
 	encryptedKeys := make(map[string]string)
-	for id, publicKeyString := range publicKeys {
-		publicKey, err := PemDecodePublic([]byte(publicKeyString))
-		encryptedKey, err := Encrypt(key, publicKey)
+	keyAlgorithms := make(map[string]string)
+	for _, recipient := range recipients {
+		if _, ok := encryptedKeys[recipient.RecipientId()]; ok {
+			return nil, nil, fmt.Errorf("Recipient '%s': %w", recipient.RecipientId(), ErrDuplicateRecipient)
+		}
+		encryptedKey, algorithm, err := recipient.wrapKey(key)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		encryptedKeys[id] = string(Base64Encode(encryptedKey))
+		encryptedKeys[recipient.RecipientId()] = encryptedKey
+		keyAlgorithms[recipient.RecipientId()] = algorithm
+	}
+	return encryptedKeys, keyAlgorithms, nil
+}
+
+// ThreatSpec TMv0.1 for ValidateRecipients
+// Does recipient validation without key wrapping for App:Crypto
+
+// ValidateRecipients checks the recipients without wrapping any keys, so that a bad recipient can be found before an
+// expensive encryption. It returns ErrNoRecipients if there are none, ErrDuplicateRecipient if an id is repeated, and
+// ErrInvalidRecipient if an id is empty or a key can't be used, such as a public key that can't be decoded.
+func ValidateRecipients(recipients []Recipient) error {
+	if len(recipients) == 0 {
+		return ErrNoRecipients
 	}
+	seen := make(map[string]bool, len(recipients))
+	for _, recipient := range recipients {
+		id := recipient.RecipientId()
+		if len(id) == 0 {
+			return fmt.Errorf("Recipient has no id: %w", ErrInvalidRecipient)
+		}
+		if seen[id] {
+			return fmt.Errorf("Recipient '%s': %w", id, ErrDuplicateRecipient)
+		}
+		seen[id] = true
+		if err := recipient.validate(); err != nil {
+			return fmt.Errorf("Recipient '%s': %w: %w", id, err, ErrInvalidRecipient)
+		}
+	}
+	return nil
+}
 
-	return &Encrypted{Ciphertext: string(Base64Encode(ciphertext)), Mode: "aes-cbc-256+rsa", Inputs: inputs, Keys: encryptedKeys}, nil
+// keyWrapAlgorithm returns the key wrap algorithm used with a public or private key, as chosen by Encrypt and Decrypt.
+func keyWrapAlgorithm(key interface{}) (string, error) {
+	switch key.(type) {
+	case *rsa.PublicKey, *rsa.PrivateKey:
+		return KeyWrapRsaOaep, nil
+	case *ecdsa.PublicKey, *ecdsa.PrivateKey:
+		return KeyWrapEcies, nil
+	default:
+		return "", fmt.Errorf("Unsupported key type %T", key)
+	}
 }
 
 // ThreatSpec TMv0.1 for SymmetricEncrypt
@@ -100,18 +296,73 @@ func SymmetricEncrypt(plaintext, id, key string) (*Encrypted, error) {
 	inputs["iv"] = string(Base64Encode(iv))
 	inputs["salt"] = string(Base64Encode(salt))
 
-	return &Encrypted{Ciphertext: string(Base64Encode(ciphertext)), Mode: "aes-cbc-256", Inputs: inputs}, nil
+	return &Encrypted{Ciphertext: string(Base64Encode(ciphertext)), Mode: string(EncryptionModeAesCbc256), Inputs: inputs}, nil
+}
+
+// ThreatSpec TMv0.1 for CheckCiphertextLength
+// Mitigates App:Crypto against truncated ciphertext with length check before decryption
+
+// CheckCiphertextLength returns ErrTruncatedCiphertext if the ciphertext is too short to be complete for the encryption mode.
+// CBC ciphertexts must be a non-zero multiple of the block size, and GCM ciphertexts must be longer than the authentication tag.
+func CheckCiphertextLength(encrypted *Encrypted) error {
+	ciphertext, err := Base64Decode([]byte(encrypted.Ciphertext))
+	if err != nil {
+		return fmt.Errorf("Could not decode ciphertext: %s", err)
+	}
+
+	switch encrypted.Mode {
+	case string(EncryptionModeAesCbc256), string(EncryptionModeAesCbc256Rsa):
+		if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+			return ErrTruncatedCiphertext
+		}
+	case string(EncryptionModeAesGcm256Rsa), string(EncryptionModeAesGcm256):
+		if len(ciphertext) <= gcmTagSize {
+			return ErrTruncatedCiphertext
+		}
+	}
+	return nil
+}
+
+// ThreatSpec TMv0.1 for CheckNonce
+// Mitigates App:Crypto against broken or malicious producers with nonce length and degeneracy check before decryption
+
+// CheckNonce returns ErrInvalidNonce if the nonce or IV in the inputs doesn't have the length expected by the encryption mode,
+// or if it is degenerate, with every byte the same, such as an all-zero nonce.
+func CheckNonce(encrypted *Encrypted) error {
+	var input string
+	var size int
+	switch encrypted.Mode {
+	case string(EncryptionModeAesCbc256), string(EncryptionModeAesCbc256Rsa):
+		input, size = "iv", aes.BlockSize
+	case string(EncryptionModeAesGcm256Rsa), string(EncryptionModeAesGcm256):
+		input, size = "nonce", gcmNonceSize
+	default:
+		return nil
+	}
+
+	nonce, err := Base64Decode([]byte(encrypted.Inputs[input]))
+	if err != nil {
+		return fmt.Errorf("Could not decode %s: %s: %w", input, err, ErrInvalidNonce)
+	}
+	if len(nonce) != size {
+		return fmt.Errorf("Expected %s of %d bytes but got %d: %w", input, size, len(nonce), ErrInvalidNonce)
+	}
+	if bytes.Count(nonce, nonce[:1]) == len(nonce) {
+		return fmt.Errorf("Degenerate %s: %w", input, ErrInvalidNonce)
+	}
+	return nil
 }
 
 // ThreatSpec TMv0.1 for GroupDecrypt
 // Does hybrid decryption with a private key for App:Crypto
 
 // GroupDecrypt takes an Encrypted struct and decrypts for the given private key, returning a plaintext string.
+//
+// Each stage of decryption returns its own error: ErrNotARecipient if there is no wrapped key for the key ID,
+// ErrWrappedKeyUnwrapFailed if the wrapped key can't be decrypted and ErrPayloadAuthFailed if the payload can't be decrypted.
+// For authenticated modes, the additional data recorded in the inputs is checked and ErrAuthenticationFailed is returned if it doesn't match.
 func GroupDecrypt(encrypted *Encrypted, keyID string, privateKeyPem string) (string, error) {
-	var privateKey interface{}
-	var err error
-
-	if encrypted.Mode != "aes-cbc-256+rsa" {
+	if encrypted.Mode != string(EncryptionModeAesCbc256Rsa) && encrypted.Mode != string(EncryptionModeAesGcm256Rsa) {
 		return "", fmt.Errorf("Invalid mode '%s'", encrypted.Mode)
 	}
 
@@ -119,14 +370,199 @@ func GroupDecrypt(encrypted *Encrypted, keyID string, privateKeyPem string) (str
 		return "", fmt.Errorf("Private key pem is 0 bytes")
 	}
 
-	// TODO - check errors
-	ciphertext, _ := Base64Decode([]byte(encrypted.Ciphertext))
-	iv, _ := Base64Decode([]byte(encrypted.Inputs["iv"]))
-	encryptedKey, _ := Base64Decode([]byte(encrypted.Keys[keyID]))
-	privateKey, err = PemDecodePrivate([]byte(privateKeyPem))
+	privateKey, err := PemDecodePrivate([]byte(privateKeyPem))
+	if err != nil {
+		return "", fmt.Errorf("Could not decode private key: %s", err)
+	}
+	return GroupDecryptWithKey(encrypted, keyID, privateKey)
+}
+
+// ThreatSpec TMv0.1 for GroupDecryptWithKey
+// Does hybrid decryption with a parsed private key for App:Crypto
+
+// GroupDecryptWithKey is like GroupDecrypt, but takes a parsed private key so that it doesn't need to be decoded for each decryption.
+func GroupDecryptWithKey(encrypted *Encrypted, keyID string, privateKey crypto.PrivateKey) (string, error) {
+	key, err := unwrapKey(encrypted, keyID, privateKey)
+	if err != nil {
+		return "", err
+	}
+	defer clear(key)
+	return decryptPayload(encrypted, key)
+}
+
+// unwrapKey returns the data key wrapped for the key ID, unwrapped with the private key.
+func unwrapKey(encrypted *Encrypted, keyID string, privateKey crypto.PrivateKey) ([]byte, error) {
+	if encrypted.Mode != string(EncryptionModeAesCbc256Rsa) && encrypted.Mode != string(EncryptionModeAesGcm256Rsa) {
+		return nil, fmt.Errorf("Invalid mode '%s'", encrypted.Mode)
+	}
+
+	encryptedKey, isRecipient, err := wrappedKeyFor(encrypted.Keys, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if recorded, ok := encrypted.KeyAlgorithms[keyID]; ok && isRecipient {
+		algorithm, err := keyWrapAlgorithm(privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", err, ErrWrappedKeyUnwrapFailed)
+		}
+		if recorded != algorithm {
+			return nil, fmt.Errorf("Key is wrapped with '%s' but private key uses '%s': %w", recorded, algorithm, ErrWrappedKeyUnwrapFailed)
+		}
+	}
+
 	key, err := Decrypt(encryptedKey, privateKey)
-	plaintext, err := AESDecrypt(ciphertext, iv, key)
-	return string(plaintext), err
+	if !isRecipient {
+		clear(key)
+		return nil, ErrNotARecipient
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrWrappedKeyUnwrapFailed)
+	}
+	return key, nil
+}
+
+// dummyWrappedKeySize is the size of the random wrapped key unwrapped for a non-member of a container without recipients.
+const dummyWrappedKeySize = 256
+
+// ThreatSpec TMv0.1 for lookupWrappedKey
+// Mitigates App:Crypto against recipient membership disclosure by timing with an unwrap for non-members too
+
+// lookupWrappedKey returns the key wrapped for the recipient id and whether id is a recipient. The key is found with a
+// single map lookup, so decryption doesn't slow down with the number of recipients. For a non-member it returns another
+// recipient's wrapped key, or an empty string if there is none, which the caller must unwrap and discard before returning
+// ErrNotARecipient, so that a non-member takes about as long as a member rather than failing early.
+func lookupWrappedKey(keys map[string]string, id string) (string, bool) {
+	if wrappedKey, ok := keys[id]; ok {
+		return wrappedKey, true
+	}
+	for _, wrappedKey := range keys {
+		return wrappedKey, false
+	}
+	return "", false
+}
+
+// wrappedKeyFor is like lookupWrappedKey, but returns the decoded wrapped key. For a non-member whose key can't be
+// decoded, or with no recipients, it returns random bytes to unwrap instead.
+func wrappedKeyFor(keys map[string]string, id string) ([]byte, bool, error) {
+	wrappedKey, isRecipient := lookupWrappedKey(keys, id)
+	encryptedKey, err := Base64Decode([]byte(wrappedKey))
+	if isRecipient {
+		if err != nil {
+			return nil, true, fmt.Errorf("Could not decode wrapped key: %s: %w", err, ErrWrappedKeyUnwrapFailed)
+		}
+		return encryptedKey, true, nil
+	}
+	if err == nil && len(encryptedKey) > 0 {
+		return encryptedKey, false, nil
+	}
+	dummy, err := RandomBytes(dummyWrappedKeySize)
+	if err != nil {
+		return nil, false, err
+	}
+	return dummy, false, nil
+}
+
+// ThreatSpec TMv0.1 for GroupDecryptWithPSK
+// Does hybrid decryption with a pre-shared key for App:Crypto
+
+// GroupDecryptWithPSK is like GroupDecrypt, but unwraps the data key with the pre-shared key of a PSKRecipient.
+func GroupDecryptWithPSK(encrypted *Encrypted, keyID string, psk []byte) (string, error) {
+	key, err := unwrapKeyWithPSK(encrypted, keyID, psk)
+	if err != nil {
+		return "", err
+	}
+	defer clear(key)
+	return decryptPayload(encrypted, key)
+}
+
+// unwrapKeyWithPSK returns the data key wrapped for the key ID, unwrapped with the pre-shared key.
+func unwrapKeyWithPSK(encrypted *Encrypted, keyID string, psk []byte) ([]byte, error) {
+	if encrypted.Mode != string(EncryptionModeAesCbc256Rsa) && encrypted.Mode != string(EncryptionModeAesGcm256Rsa) {
+		return nil, fmt.Errorf("Invalid mode '%s'", encrypted.Mode)
+	}
+
+	encryptedKey, isRecipient, err := wrappedKeyFor(encrypted.Keys, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if recorded := encrypted.KeyAlgorithms[keyID]; isRecipient && recorded != KeyWrapAesKw {
+		return nil, fmt.Errorf("Key is wrapped with '%s' but pre-shared key uses '%s': %w", recorded, KeyWrapAesKw, ErrWrappedKeyUnwrapFailed)
+	}
+
+	key, err := AESKeyUnwrap(psk, encryptedKey)
+	if !isRecipient {
+		clear(key)
+		return nil, ErrNotARecipient
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrWrappedKeyUnwrapFailed)
+	}
+	return key, nil
+}
+
+// ThreatSpec TMv0.1 for DecryptWithDataKey
+// Does hybrid decryption with an escrowed data key for App:Crypto
+
+// DecryptWithDataKey decrypts an Encrypted struct from GroupEncrypt or GroupEncryptWithAAD using the raw data key,
+// such as one escrowed with GroupEncryptForEscrow, instead of a private key.
+func DecryptWithDataKey(encrypted *Encrypted, key []byte) (string, error) {
+	if encrypted.Mode != string(EncryptionModeAesCbc256Rsa) && encrypted.Mode != string(EncryptionModeAesGcm256Rsa) {
+		return "", fmt.Errorf("Invalid mode '%s'", encrypted.Mode)
+	}
+
+	return decryptPayload(encrypted, key)
+}
+
+// ThreatSpec TMv0.1 for EncryptWithDataKey
+// Does symmetric encryption with a hybrid data key for App:Crypto
+
+// EncryptWithDataKey encrypts a plaintext with the raw data key of a GroupEncrypt Encrypted struct, with its own IV.
+// The result has no wrapped keys. Sharing the wrapped keys of the original Encrypted struct allows it to be decrypted
+// by the same recipients, such as with GroupDecrypt or DecryptWithDataKey.
+func EncryptWithDataKey(plaintext string, key []byte) (*Encrypted, error) {
+	ciphertext, iv, err := aesCBCEncryptString(plaintext, key)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make(map[string]string)
+	inputs["iv"] = string(Base64Encode(iv))
+
+	return &Encrypted{Ciphertext: ciphertext, Mode: string(EncryptionModeAesCbc256Rsa), Inputs: inputs}, nil
+}
+
+// decryptPayload decrypts the ciphertext of a hybrid Encrypted struct using the unwrapped data key.
+// The ciphertext is decoded and decrypted in place in a pooled buffer, which is zeroed afterwards.
+func decryptPayload(encrypted *Encrypted, key []byte) (string, error) {
+	buffer, err := decodeBuffer(encrypted.Ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("Could not decode ciphertext: %s", err)
+	}
+	defer putBuffer(buffer)
+	ciphertext := *buffer
+
+	if encrypted.Mode == string(EncryptionModeAesGcm256Rsa) {
+		nonce, err := Base64Decode([]byte(encrypted.Inputs["nonce"]))
+		if err != nil {
+			return "", fmt.Errorf("Could not decode nonce: %s", err)
+		}
+		additionalData, err := Base64Decode([]byte(encrypted.Inputs["aad"]))
+		if err != nil {
+			return "", fmt.Errorf("Could not decode additional data: %s", err)
+		}
+		plaintext, err := aesGCMOpen(ciphertext[:0], ciphertext, nonce, key, additionalData)
+		return string(plaintext), err
+	}
+
+	iv, err := Base64Decode([]byte(encrypted.Inputs["iv"]))
+	if err != nil {
+		return "", fmt.Errorf("Could not decode IV: %w", err)
+	}
+	plaintext, err := aesCBCDecrypt(ciphertext, ciphertext, iv, key)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", err, ErrPayloadAuthFailed)
+	}
+	return string(plaintext), nil
 }
 
 // ThreatSpec TMv0.1 for SymmetricDecrypt
@@ -134,14 +570,22 @@ func GroupDecrypt(encrypted *Encrypted, keyID string, privateKeyPem string) (str
 
 // SymmetricDecrypt takes an Encrypted struct and decrypts with the given symmetric key, returning a plaintext string.
 func SymmetricDecrypt(encrypted *Encrypted, key string) (string, error) {
-	if encrypted.Mode != "aes-cbc-256" {
+	if encrypted.Mode != string(EncryptionModeAesCbc256) {
 		return "", fmt.Errorf("Invalid mode: %s", encrypted.Mode)
 	}
 
-	// TODO - check errors
-	ciphertext, _ := Base64Decode([]byte(encrypted.Ciphertext))
-	iv, _ := Base64Decode([]byte(encrypted.Inputs["iv"]))
-	salt, _ := Base64Decode([]byte(encrypted.Inputs["salt"]))
+	ciphertext, err := Base64Decode([]byte(encrypted.Ciphertext))
+	if err != nil {
+		return "", fmt.Errorf("Could not decode ciphertext: %w", err)
+	}
+	iv, err := Base64Decode([]byte(encrypted.Inputs["iv"]))
+	if err != nil {
+		return "", fmt.Errorf("Could not decode IV: %w", err)
+	}
+	salt, err := Base64Decode([]byte(encrypted.Inputs["salt"]))
+	if err != nil {
+		return "", fmt.Errorf("Could not decode salt: %w", err)
+	}
 
 	rawKey, err := hex.DecodeString(key)
 	if err != nil {
@@ -165,23 +609,38 @@ func SymmetricDecrypt(encrypted *Encrypted, key string) (string, error) {
 // Does message signing for App:Crypto
 
 // Sign takes a message string and signs using the given private key. The signature and inputs are added to the provided Signed input.
+// If the Signed input has a mode, such as from NewSignature, it is used and must be registered for the key's type,
+// otherwise the default mode for the key type is used.
 func Sign(message string, privateKeyString string, signature *Signed) error {
 	privateKey, err := PemDecodePrivate([]byte(privateKeyString))
 	if err != nil {
 		return err
 	}
 
-	switch privateKey.(type) {
-	case *rsa.PrivateKey:
-		signature.Mode = SignatureModeSha256Rsa
-	case *ecdsa.PrivateKey:
-		signature.Mode = SignatureModeSha256Ecdsa
+	keyType, err := GetKeyType(privateKey)
+	if err != nil {
+		return err
+	}
+	mode := signature.Mode
+	if len(mode) == 0 {
+		if mode, err = ModeForKeyType(keyType); err != nil {
+			return err
+		}
+	}
+	scheme, err := LookupMode(mode)
+	if err != nil {
+		return err
+	}
+	if scheme.KeyType != keyType {
+		return fmt.Errorf("Signature mode '%s' can't be used with key type '%s'", mode, keyType)
 	}
-	sig, err := SignMessage([]byte(message), privateKey)
+	sig, err := scheme.Sign([]byte(message), privateKey)
 	if err != nil {
 		return err
 	}
 
+	signature.Mode = mode
+
 	signature.Message = message
 	signature.Signature = string(Base64Encode(sig))
 	return nil
@@ -205,12 +664,18 @@ func Authenticate(message string, key []byte, signature *Signed) error {
 // Does signature verification for App:Crypto
 
 // Verify takes a Signed struct and verifies the signature using the given key. It supports both symmetric (MAC) and public key signatures.
+// The signature mode is looked up in the ModeRegistry, and for public key modes the key is a PEM encoded public key that must be of the mode's key type.
 func Verify(signed *Signed, key []byte) error {
+	scheme, err := LookupMode(signed.Mode)
+	if err != nil {
+		return err
+	}
+
 	message := []byte(signed.Message)
 	signature, _ := Base64Decode([]byte(signed.Signature))
 
-	if signed.Mode == SignatureModeSha256Hmac {
-		return HMACVerify(message, key, signature)
+	if !scheme.IsPublicKey() {
+		return scheme.Verify(message, signature, key)
 	}
 
 	publicKey, err := PemDecodePublic(key)
@@ -218,5 +683,49 @@ func Verify(signed *Signed, key []byte) error {
 		return err
 	}
 
-	return VerifySignature(message, signature, publicKey)
+	return scheme.Verify(message, signature, publicKey)
+}
+
+// ThreatSpec TMv0.1 for VerifyWithKey
+// Does signature verification with a parsed public key for App:Crypto
+
+// VerifyWithKey is like Verify for public key signatures, but takes a parsed public key so that it doesn't need to be
+// decoded for each verification. MAC modes aren't accepted.
+func VerifyWithKey(signed *Signed, publicKey crypto.PublicKey) error {
+	scheme, err := LookupMode(signed.Mode)
+	if err != nil {
+		return err
+	}
+	if !scheme.IsPublicKey() {
+		return fmt.Errorf("Signature mode '%s' isn't a public key mode", signed.Mode)
+	}
+
+	signature, _ := Base64Decode([]byte(signed.Signature))
+	return scheme.Verify([]byte(signed.Message), signature, publicKey)
+}
+
+// ThreatSpec TMv0.1 for LookupRecipient
+// Mitigates App:Crypto against recipient membership disclosure by timing with constant-time comparison of every recipient id
+
+// LookupRecipient returns the wrapped key for the recipient id and whether it was found. Every recipient is compared in
+// constant time and the loop doesn't exit early, so the time taken depends on the number of recipients but not on whether,
+// or where, the id is found.
+//
+// This only hides membership from an attacker who can time the lookup but can't read the recipient ids, which are stored
+// in plaintext. Decryption doesn't use it, as the scan is slow for containers with many recipients. Instead it looks the
+// wrapped key up directly and unwraps a key for non-members too, so that the unwrap, which takes far longer than any
+// lookup, doesn't reveal membership.
+func LookupRecipient(keys map[string]string, id string) (string, bool) {
+	idDigest := sha256.Sum256([]byte(id))
+	found := 0
+	var wrappedKey string
+	for recipient, key := range keys {
+		recipientDigest := sha256.Sum256([]byte(recipient))
+		match := subtle.ConstantTimeCompare(idDigest[:], recipientDigest[:])
+		found |= match
+		if match == 1 {
+			wrappedKey = key
+		}
+	}
+	return wrappedKey, found == 1
 }
@@ -1,9 +1,16 @@
 package crypto
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestSymmetricEncryptDecrypt(t *testing.T) {
@@ -23,6 +30,10 @@ func TestSymmetricEncryptDecrypt(t *testing.T) {
 	newMessage, err := SymmetricDecrypt(encrypted, key)
 	assert.Nil(t, err)
 	assert.Equal(t, message, newMessage)
+
+	encrypted.Inputs["iv"] = "not base64!"
+	_, err = SymmetricDecrypt(encrypted, key)
+	assert.Error(t, err)
 }
 
 func TestAuthenticateVerify(t *testing.T) {
@@ -68,6 +79,10 @@ func TestGroupDecrypt(t *testing.T) {
 	newPlaintext, err := GroupDecrypt(e, "1", string(pk1))
 	assert.NoError(t, err)
 	assert.Equal(t, plaintext, newPlaintext)
+
+	e.Inputs["iv"] = "not base64!"
+	_, err = GroupDecrypt(e, "1", string(pk1))
+	assert.Error(t, err)
 }
 
 func TestSign(t *testing.T) {
@@ -110,6 +125,28 @@ func TestVerify(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestSignWithMode(t *testing.T) {
+	message := "this is a message"
+	rsakey, _ := GenerateRSAKey()
+	privateKey, _ := PemEncodePrivate(rsakey)
+	publicKey, _ := PemEncodePublic(&rsakey.PublicKey)
+
+	sig := NewSignature(SignatureModeSha256RsaPss)
+	err := Sign(message, string(privateKey), sig)
+	assert.NoError(t, err)
+	assert.Equal(t, sig.Mode, SignatureModeSha256RsaPss)
+	assert.NoError(t, Verify(sig, publicKey))
+
+	// PSS and PKCS#1 v1.5 signatures aren't interchangeable
+	sig.Mode = SignatureModeSha256Rsa
+	assert.Error(t, Verify(sig, publicKey))
+
+	sig = NewSignature(SignatureModeSha256Ecdsa)
+	assert.Error(t, Sign(message, string(privateKey), sig))
+	sig = NewSignature(SignatureModeSha256Hmac)
+	assert.Error(t, Sign(message, string(privateKey), sig))
+}
+
 func TestNewHMAC(t *testing.T) {
 	mac := NewSignature(SignatureModeSha256Hmac)
 	message := "message to be authenticated"
@@ -121,3 +158,303 @@ func TestNewHMAC(t *testing.T) {
 	err := HMACVerify([]byte(message), key, signature)
 	assert.Nil(t, err)
 }
+
+func TestGroupDecryptWithAAD(t *testing.T) {
+	key, _ := GenerateECKey()
+	keys := make(map[string]string)
+	k, _ := PemEncodePublic(&key.PublicKey)
+	keys["1"] = string(k)
+
+	plaintext := "this is a secret message"
+	e, err := GroupEncryptWithAAD(plaintext, keys, "additional data")
+	assert.NoError(t, err)
+	assert.Equal(t, e.Mode, string(EncryptionModeAesGcm256Rsa))
+
+	pk, _ := PemEncodePrivate(key)
+	newPlaintext, err := GroupDecrypt(e, "1", string(pk))
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, newPlaintext)
+
+	e.Inputs["aad"] = string(Base64Encode([]byte("other data")))
+	_, err = GroupDecrypt(e, "1", string(pk))
+	assert.Equal(t, err, ErrAuthenticationFailed)
+}
+
+func TestPemSignerDecrypter(t *testing.T) {
+	key, _ := GenerateECKey()
+	privateKey, _ := PemEncodePrivate(key)
+	publicKey, _ := PemEncodePublic(&key.PublicKey)
+
+	var signer Signer = NewPemSigner(string(privateKey))
+	sig := new(Signed)
+	err := signer.Sign("this is a message", sig)
+	assert.NoError(t, err)
+	assert.NoError(t, Verify(sig, publicKey))
+
+	keys := map[string]string{"1": string(publicKey)}
+	e, _ := GroupEncrypt("this is a secret", keys)
+	var decrypter Decrypter = NewPemDecrypter(string(privateKey))
+	plaintext, err := decrypter.Decrypt(e, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, "this is a secret")
+}
+
+func TestModeStrength(t *testing.T) {
+	assert.Equal(t, ModeStrength(SignatureModeSha256Rsa), SignatureStrengthLegacy)
+	assert.Equal(t, ModeStrength(SignatureModeSha256RsaPss), SignatureStrengthStandard)
+	assert.Equal(t, ModeStrength(SignatureModeSha256Ecdsa), SignatureStrengthStandard)
+	assert.Equal(t, ModeStrength(Mode("sha1+rsa")), SignatureStrengthNone)
+	assert.True(t, SignatureStrengthLegacy < SignatureStrengthStandard)
+}
+
+func TestMetrics(t *testing.T) {
+	assert.True(t, StartTimer().IsZero())
+
+	var observed []string
+	SetMetrics(MetricsFunc(func(operation string, duration time.Duration) {
+		observed = append(observed, operation)
+	}))
+	defer SetMetrics(nil)
+
+	start := StartTimer()
+	assert.False(t, start.IsZero())
+	Observe(OperationSign, start)
+	assert.Equal(t, observed, []string{OperationSign})
+}
+
+func TestCheckCiphertextLength(t *testing.T) {
+	encrypted := &Encrypted{Mode: string(EncryptionModeAesGcm256Rsa)}
+	encrypted.Ciphertext = string(Base64Encode(make([]byte, 16)))
+	assert.Equal(t, CheckCiphertextLength(encrypted), ErrTruncatedCiphertext)
+
+	encrypted.Ciphertext = string(Base64Encode(make([]byte, 17)))
+	assert.NoError(t, CheckCiphertextLength(encrypted))
+
+	encrypted.Mode = string(EncryptionModeAesCbc256Rsa)
+	assert.Equal(t, CheckCiphertextLength(encrypted), ErrTruncatedCiphertext)
+}
+
+func TestCheckNonce(t *testing.T) {
+	encrypted := &Encrypted{Mode: string(EncryptionModeAesCbc256Rsa), Inputs: make(map[string]string)}
+	iv, _ := RandomBytes(16)
+	encrypted.Inputs["iv"] = string(Base64Encode(iv))
+	assert.NoError(t, CheckNonce(encrypted))
+
+	encrypted.Inputs["iv"] = string(Base64Encode(iv[:12]))
+	assert.True(t, errors.Is(CheckNonce(encrypted), ErrInvalidNonce))
+
+	encrypted.Inputs["iv"] = string(Base64Encode(bytes.Repeat([]byte{0xff}, 16)))
+	assert.True(t, errors.Is(CheckNonce(encrypted), ErrInvalidNonce))
+
+	encrypted.Mode = string(EncryptionModeAesGcm256Rsa)
+	encrypted.Inputs["nonce"] = string(Base64Encode(iv[:12]))
+	assert.NoError(t, CheckNonce(encrypted))
+
+	encrypted.Inputs["nonce"] = string(Base64Encode(make([]byte, 12)))
+	assert.True(t, errors.Is(CheckNonce(encrypted), ErrInvalidNonce))
+}
+
+func TestTestVectors(t *testing.T) {
+	vectors, err := TestVectors()
+	assert.NoError(t, err)
+	assert.Equal(t, len(vectors), 7)
+
+	// Known answers, checked against OpenSSL for HMAC, RSA and CBC
+	assert.Equal(t, vectors[0].Signature, "9N5ptvex2nVxei+pnXwuMEq9W3LpkAQQcZka4KF3GU4=")
+	assert.Equal(t, vectors[3].Signature, "udzR0WJl7cVjp9tm8WzKaC20y9Nyn/C1Wi0QESvkVNkvqgXxZtlnptiZIddI2Q+qj1jA6pFEzee1XHHrTlk8j9ZzyuBS9xE6xxWdVxuOSqcTGR/LS75iMrZ2uXOGvJVIS4JObPb9NzLKF+0BtAs++P2zJKOsgyWD3M3YReNmKHUSVfYAebHR1P2R3jsNolXP4ujHOOXNp4ND5/1x3gc2+6vkdOpLyGPUvsgxd7j92L61AFjCv/vAKMymiN0D2Hti3/wd1P3bRjWDs6aXpBNQ7yorAgHGI/aRRdiumlnptNRqQhc2b3g20LMzY0oKRpSI2Rz5BtATiwNhAZ3uxt9fdQ==")
+	assert.Equal(t, vectors[1].Encrypted.Ciphertext, "ErjJW/xQXmaR7uFyaEALjqfpxrLIueyCE9xN1JA1sgg=")
+	assert.Equal(t, vectors[2].Encrypted.Ciphertext, "wfrHMu0zHKR1l+bomZSoSxK6hgvGog651SZVKiC3DR5iNA==")
+
+	// Known answers for the seeded modes
+	assert.Equal(t, vectors[5].Signature, "yDIU6Devvy8Quej4dLICMvCg0SPHKu7oSRfCcllqLkiOt616xqF9uXBZ1RyNCdM0RNio9wpj9/JajuoMBw2I/OfIrng99/cMffkMlVWi5xaDMchEP/SZz8ab1+ZId0h4Oe5fA3+RzyISrJgyZfICtJWJSseAAhbYm4+D5dHc0hHJ2pwWBbYkiVvENIDdqzr7UdsrDvSC/0nKcelc+GtGpwRAJEUkdpwcXuSvGSErHqJh7D28OsH4Iq94shG1YglZIPtFyktvNSNaYFeNEf9WBDKljzSy96ICoTMpfbLxpUGHKBtTa15F0cwKU2vcP5+sTIg6H1Sx7HXAgJdydJhGEA==")
+	assert.Equal(t, vectors[6].Encrypted.Ciphertext, "tzdEv8MFUMlIUwBj41b8EFWtWjDtbxCo0UJfzOt2uvU=")
+	assert.Equal(t, vectors[6].Encrypted.Keys["test-vector"], "F+00u70r85pFTfIXBsm+iwZ4UaioSPlSAJ4E34Cc2SFWH84yJVnFg/vZZn7yHwSwvcLC6WstjaSp0t7NaziyuXIhathpy2XSzzoaGuofpcb6NC6N9rQrTLjLxBB16wV2C0JjvzA9lFNgL4Tp519L1HPXvzsr+Uf6EjxXAMWMuLHRBev678vylHKW41hnTVXl68mhgDfh6+ah6LHB0gxHFvAcACWsHUUa87l6msX5h6n4EVYJQWHtZBpB8IE0fe+dJfevuCm/DMlOzvNhoo0xuVxg6Mw0AnVB3XWoPFb2nAgLFXqdwDcploy9X3RD2Dr0VfAFSu9yM1E7moRnocrdxg==")
+
+	rawKey, _ := hex.DecodeString(vectors[0].Key)
+	mac := NewSignature(vectors[0].Mode)
+	mac.Message = vectors[0].Plaintext
+	mac.Signature = vectors[0].Signature
+	assert.NoError(t, Verify(mac, rawKey))
+
+	for _, vector := range vectors[3:6] {
+		signature := NewSignature(vector.Mode)
+		signature.Message = vector.Plaintext
+		signature.Signature = vector.Signature
+		assert.NoError(t, Verify(signature, []byte(vector.PublicKey)), string(vector.Mode))
+	}
+
+	plaintext, err := SymmetricDecrypt(vectors[1].Encrypted, vectors[1].Key)
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, vectors[1].Plaintext)
+
+	plaintext, err = GroupDecrypt(vectors[6].Encrypted, "test-vector", vectors[6].Key)
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, vectors[6].Plaintext)
+
+	// Seeded modes give the same answer every time
+	again, err := TestVectors()
+	assert.NoError(t, err)
+	assert.Equal(t, again, vectors)
+}
+
+func TestModeRegistry(t *testing.T) {
+	for mode, scheme := range ModeRegistry {
+		assert.NotNil(t, scheme.Sign, string(mode))
+		assert.NotNil(t, scheme.Verify, string(mode))
+		assert.Equal(t, ModeStrength(mode), scheme.Strength)
+	}
+
+	mode, err := ModeForKeyType(KeyTypeEC)
+	assert.NoError(t, err)
+	assert.Equal(t, mode, SignatureModeSha256Ecdsa)
+
+	_, err = LookupMode("sha1+rsa")
+	assert.True(t, errors.Is(err, ErrUnknownMode))
+
+	key, _ := GenerateECKey()
+	privateKey, _ := PemEncodePrivate(key)
+	publicKey, _ := PemEncodePublic(&key.PublicKey)
+	signature := NewSignature(SignatureModeSha256Ecdsa)
+	Sign("this is a message", string(privateKey), signature)
+	assert.NoError(t, Verify(signature, publicKey))
+
+	// The declared mode must match the key
+	signature.Mode = SignatureModeSha256Rsa
+	assert.Error(t, Verify(signature, publicKey))
+
+	defer delete(ModeRegistry, "test")
+	RegisterMode("test", ModeRegistry[SignatureModeSha256Ecdsa])
+	signature.Mode = "test"
+	assert.NoError(t, Verify(signature, publicKey))
+}
+
+func TestLookupRecipient(t *testing.T) {
+	keys := map[string]string{"1": "key1", "2": "key2", "3": "key3"}
+	for id, key := range keys {
+		wrappedKey, ok := LookupRecipient(keys, id)
+		assert.True(t, ok)
+		assert.Equal(t, wrappedKey, key)
+	}
+
+	wrappedKey, ok := LookupRecipient(keys, "4")
+	assert.False(t, ok)
+	assert.Equal(t, wrappedKey, "")
+
+	_, ok = LookupRecipient(nil, "1")
+	assert.False(t, ok)
+}
+
+func TestWrappedKeyFor(t *testing.T) {
+	keys := map[string]string{"1": string(Base64Encode([]byte("key1")))}
+	wrappedKey, isRecipient, err := wrappedKeyFor(keys, "1")
+	assert.NoError(t, err)
+	assert.True(t, isRecipient)
+	assert.Equal(t, wrappedKey, []byte("key1"))
+
+	// Non-members get a key to unwrap too
+	wrappedKey, isRecipient, err = wrappedKeyFor(keys, "2")
+	assert.NoError(t, err)
+	assert.False(t, isRecipient)
+	assert.Equal(t, wrappedKey, []byte("key1"))
+
+	wrappedKey, isRecipient, _ = wrappedKeyFor(nil, "1")
+	assert.False(t, isRecipient)
+	assert.Equal(t, len(wrappedKey), dummyWrappedKeySize)
+
+	_, _, err = wrappedKeyFor(map[string]string{"1": "not base64!"}, "1")
+	assert.True(t, errors.Is(err, ErrWrappedKeyUnwrapFailed))
+}
+
+func TestSignVerifyJWS(t *testing.T) {
+	ecKey, _ := GenerateECKey()
+	rsaKey, _ := GenerateRSAKey()
+	for _, key := range []interface{}{ecKey, rsaKey} {
+		jws, err := SignJWS(map[string]interface{}{"kid": "1", "alg": "none"}, []byte("this is a message"), key)
+		assert.NoError(t, err)
+
+		var publicKey interface{}
+		switch k := key.(type) {
+		case *ecdsa.PrivateKey:
+			publicKey = &k.PublicKey
+		case *rsa.PrivateKey:
+			publicKey = &k.PublicKey
+		}
+		header, payload, err := VerifyJWS(jws, publicKey)
+		assert.NoError(t, err)
+		assert.Equal(t, header["kid"], "1")
+		assert.Equal(t, string(payload), "this is a message")
+
+		parts := strings.Split(jws, ".")
+		tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte("this is a tampered message")) + "." + parts[2]
+		_, _, err = VerifyJWS(tampered, publicKey)
+		assert.True(t, errors.Is(err, ErrInvalidJWS))
+	}
+
+	// An ES256 token must not verify with an RSA key
+	jws, _ := SignJWS(nil, []byte("this is a message"), ecKey)
+	_, _, err := VerifyJWS(jws, &rsaKey.PublicKey)
+	assert.True(t, errors.Is(err, ErrInvalidJWS))
+}
+
+func TestValidateRecipients(t *testing.T) {
+	key, _ := GenerateECKey()
+	publicKey, _ := PemEncodePublic(key.Public())
+	psk, _ := RandomBytes(32)
+
+	recipients := []Recipient{PublicKeyRecipient{Id: "ec", PublicKey: string(publicKey)}, PSKRecipient{Id: "psk", Key: psk}}
+	assert.NoError(t, ValidateRecipients(recipients))
+	assert.True(t, errors.Is(ValidateRecipients(nil), ErrNoRecipients))
+	assert.True(t, errors.Is(ValidateRecipients(append(recipients, PSKRecipient{Id: "ec", Key: psk})), ErrDuplicateRecipient))
+	assert.True(t, errors.Is(ValidateRecipients([]Recipient{PSKRecipient{Id: "psk", Key: psk[:20]}}), ErrInvalidRecipient))
+	assert.True(t, errors.Is(ValidateRecipients([]Recipient{PublicKeyRecipient{Id: "empty"}}), ErrInvalidRecipient))
+}
+
+func TestSealOpen(t *testing.T) {
+	rsaKey, _ := GenerateRSAKey()
+	rsaPrivate, _ := PemEncodePrivate(rsaKey)
+	rsaPublic, _ := PemEncodePublic(&rsaKey.PublicKey)
+	ecKey, _ := GenerateECKey()
+	ecPrivate, _ := PemEncodePrivate(ecKey)
+	ecPublic, _ := PemEncodePublic(&ecKey.PublicKey)
+	plaintext := []byte("this is a secret")
+
+	sealed, err := Seal(plaintext, []Recipient{
+		PublicKeyRecipient{Id: "rsa", PublicKey: string(rsaPublic)},
+		PublicKeyRecipient{Id: "ec", PublicKey: string(ecPublic)},
+	})
+	assert.NoError(t, err)
+
+	opened, err := Open(sealed, "rsa", string(rsaPrivate))
+	assert.NoError(t, err)
+	assert.Equal(t, opened, plaintext)
+	opened, err = Open(sealed, "ec", string(ecPrivate))
+	assert.NoError(t, err)
+	assert.Equal(t, opened, plaintext)
+
+	_, err = Open(sealed, "other", string(ecPrivate))
+	assert.True(t, errors.Is(err, ErrNotARecipient))
+}
+
+// BenchmarkDataKeyEncryptDecrypt measures the allocations of the symmetric payload path used by GroupEncrypt and GroupDecrypt.
+func BenchmarkDataKeyEncryptDecrypt(b *testing.B) {
+	key, _ := RandomBytes(32)
+	plaintext := strings.Repeat("this is a secret", 64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		encrypted, _ := EncryptWithDataKey(plaintext, key)
+		if decrypted, err := DecryptWithDataKey(encrypted, key); err != nil || decrypted != plaintext {
+			b.Fatal("Could not decrypt")
+		}
+	}
+}
+
+func TestPutBufferZeroes(t *testing.T) {
+	buffer := getBuffer(32)
+	copy(*buffer, []byte("this is a secret"))
+	putBuffer(buffer)
+	assert.Equal(t, 0, len(*buffer))
+	for _, b := range (*buffer)[:cap(*buffer)] {
+		assert.Equal(t, byte(0), b)
+	}
+}
@@ -12,15 +12,22 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"github.com/pki-io/ecies"
 	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh"
+	"hash"
 	"io"
 	"math/big"
+	"strings"
 	"time"
 )
 
@@ -35,6 +42,52 @@ const (
 	KeyTypeEC  KeyType = "ec"
 )
 
+// StrictLowS makes signature verification reject ECDSA signatures whose S value is in the upper half of the curve order.
+// Signatures produced by this package are always low-S.
+var StrictLowS = false
+
+// AcceptLegacyDigests makes fingerprint pins, content digests and container references recorded as untagged SHA-256
+// digests, before TaggedHash was introduced, be accepted as well as tagged ones. Untagged digests have no domain
+// separation, so it should only be set while migrating stored values, see LegacyFingerprint.
+var AcceptLegacyDigests = false
+
+// ErrSignatureLengthMismatch is returned when a signature's length or structure doesn't match the public key.
+var ErrSignatureLengthMismatch = errors.New("Signature length doesn't match key")
+
+// ErrHighS is returned when StrictLowS is set and an ECDSA signature isn't low-S.
+var ErrHighS = errors.New("ECDSA signature S value isn't canonical")
+
+// ErrInvalidKeyType is returned when a key type is not supported.
+var ErrInvalidKeyType = errors.New("Invalid key type")
+
+// ErrInvalidPublicKey is returned when a public key is weak or invalid, such as an EC point that isn't on the curve.
+var ErrInvalidPublicKey = errors.New("Invalid public key")
+
+// ErrMalformedKey is returned when an encoded key can't be decoded, such as a truncated or corrupt PEM block.
+var ErrMalformedKey = errors.New("Malformed key")
+
+// MinRSAModulusBits is the smallest RSA modulus accepted by ValidatePublicKey.
+const MinRSAModulusBits = 1024
+
+// keyTypeAliases maps accepted key type names to key types.
+var keyTypeAliases = map[string]KeyType{
+	"rsa":   KeyTypeRSA,
+	"ec":    KeyTypeEC,
+	"ecdsa": KeyTypeEC,
+}
+
+// ThreatSpec TMv0.1 for ParseKeyType
+// Does key type normalisation for App:Crypto
+
+// ParseKeyType normalises a key type name, ignoring case and surrounding whitespace and accepting common aliases.
+// It returns ErrInvalidKeyType if the name isn't a supported key type.
+func ParseKeyType(name string) (KeyType, error) {
+	if keyType, ok := keyTypeAliases[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return keyType, nil
+	}
+	return "", fmt.Errorf("%w: '%s'", ErrInvalidKeyType, name)
+}
+
 // ThreatSpec TMv0.1 for TimeOrderedUUID
 // Does time-ordered UUID generation for App:Crypto
 
@@ -79,7 +132,7 @@ func RandomBytes(size int) ([]byte, error) {
 	}
 
 	if numBytesRead != size {
-		return nil, fmt.Errorf("Wrong number of random bytes read: %i vs %i", size, numBytesRead)
+		return nil, fmt.Errorf("Wrong number of random bytes read: %d vs %d", size, numBytesRead)
 	}
 
 	return randomBytes, nil
@@ -111,6 +164,15 @@ func UnPad(src []byte) []byte {
 	return src[:(length - unpadding)]
 }
 
+// DefaultSaltSize is the size in bytes of salts generated by ExpandKey.
+const DefaultSaltSize = 16
+
+// MinSaltSize is the smallest salt size in bytes accepted for key expansion.
+const MinSaltSize = 16
+
+// ErrWeakSalt is returned when a salt is shorter than MinSaltSize.
+var ErrWeakSalt = errors.New("Salt is too short")
+
 // ThreatSpec TMv0.1 for ExpandKey
 // Mitigates App:Crypto against Use of Password Hash With Insufficient Computational Effort (CWE-916) with PBKDF2 provided by standard package
 // Mitigates App:Crypto against Use of a One-Way Hash without a Salt (CWE-759) with salt create by function
@@ -123,7 +185,7 @@ func UnPad(src []byte) []byte {
 func ExpandKey(key, salt []byte) ([]byte, []byte, error) {
 	if len(salt) == 0 {
 		var err error
-		salt, err = RandomBytes(16) // TODO Shouldn't be hardcoded i guess
+		salt, err = RandomBytes(DefaultSaltSize)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -132,6 +194,71 @@ func ExpandKey(key, salt []byte) ([]byte, []byte, error) {
 	return newKey, salt, nil
 }
 
+// ThreatSpec TMv0.1 for ExpandKeyWithSaltSize
+// Does key expansion with a new salt of a given size for App:Crypto
+// Mitigates App:Crypto against Use of a One-Way Hash with a Predictable Salt (CWE-760) with minimum salt size
+
+// ExpandKeyWithSaltSize is like ExpandKey, but generates a new salt of the given size in bytes.
+// It returns ErrWeakSalt if the size is less than MinSaltSize.
+func ExpandKeyWithSaltSize(key []byte, saltSize int) ([]byte, []byte, error) {
+	if saltSize < MinSaltSize {
+		return nil, nil, fmt.Errorf("Salt size %d is less than %d: %w", saltSize, MinSaltSize, ErrWeakSalt)
+	}
+	salt, err := RandomBytes(saltSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ExpandKey(key, salt)
+}
+
+// ScryptParams are the scrypt work factor parameters. The memory and time needed grow with N and R.
+type ScryptParams struct {
+	N int `json:"n"`
+	R int `json:"r"`
+	P int `json:"p"`
+}
+
+// DefaultScryptParams are the scrypt parameters used when none are given. Use BenchmarkDeriveKeyScrypt to calibrate
+// N so that a derivation takes about 250ms on the target hardware.
+var DefaultScryptParams = ScryptParams{N: 1 << 15, R: 8, P: 1}
+
+// MaxScryptParams are the largest scrypt parameters DeriveKeyScrypt accepts, so that recorded parameters from an untrusted
+// document can't make a derivation use excessive memory or time.
+var MaxScryptParams = ScryptParams{N: 1 << 20, R: 16, P: 16}
+
+// MaxScryptCost is the largest combined scrypt cost, 128·N·r·p, that DeriveKeyScrypt accepts. It bounds the memory of
+// a derivation, 128·N·r bytes, times its parallelism, so that parameters within MaxScryptParams can't be combined into
+// an excessive derivation. It is 8 times the cost of DefaultScryptParams.
+var MaxScryptCost uint64 = 256 * 1024 * 1024
+
+// ErrWorkFactorTooHigh is returned when scrypt parameters exceed MaxScryptParams or MaxScryptCost.
+var ErrWorkFactorTooHigh = errors.New("Work factor too high")
+
+// ThreatSpec TMv0.1 for DeriveKeyScrypt
+// Does passphrase key derivation with scrypt for App:Crypto
+// Mitigates App:Crypto against passphrase brute forcing with memory hard key derivation
+// Mitigates App:Crypto against resource exhaustion with upper bound on work factor
+
+// DeriveKeyScrypt derives a 256 bit key from the passphrase and salt using scrypt with the given parameters.
+// It returns ErrWorkFactorTooHigh if the parameters exceed MaxScryptParams or MaxScryptCost, and ErrWeakSalt if the salt
+// is shorter than MinSaltSize.
+func DeriveKeyScrypt(passphrase, salt []byte, params ScryptParams) ([]byte, error) {
+	if params.N > MaxScryptParams.N || params.R > MaxScryptParams.R || params.P > MaxScryptParams.P {
+		return nil, fmt.Errorf("Scrypt parameters N=%d, r=%d, p=%d exceed the maximum: %w", params.N, params.R, params.P, ErrWorkFactorTooHigh)
+	}
+	if params.N > 0 && params.R > 0 && params.P > 0 && 128*uint64(params.N)*uint64(params.R)*uint64(params.P) > MaxScryptCost {
+		return nil, fmt.Errorf("Scrypt parameters N=%d, r=%d, p=%d exceed the maximum cost: %w", params.N, params.R, params.P, ErrWorkFactorTooHigh)
+	}
+	if len(salt) < MinSaltSize {
+		return nil, fmt.Errorf("Salt of %d bytes is less than %d: %w", len(salt), MinSaltSize, ErrWeakSalt)
+	}
+	key, err := scrypt.Key(passphrase, salt, params.N, params.R, params.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Could not derive key: %s", err)
+	}
+	return key, nil
+}
+
 // ThreatSpec TMv0.1 for Base64Encode
 // Does base64 encoding for App:Crypto
 
@@ -165,22 +292,63 @@ func AESEncrypt(plaintext, key []byte) (ciphertext []byte, iv []byte, err error)
 		return nil, nil, fmt.Errorf("Plaintext can't be empty")
 	}
 
-	block, err := aes.NewCipher(key)
+	iv, err = RandomBytes(aes.BlockSize)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Can't initialise cipher: %s", err)
+		return nil, nil, err
 	}
 
-	paddedPlaintext := Pad(plaintext, aes.BlockSize)
-	ciphertext = make([]byte, len(paddedPlaintext))
-	iv, err = RandomBytes(aes.BlockSize)
+	ciphertext, err = aesCBCEncrypt(plaintext, key, iv)
 	if err != nil {
 		return nil, nil, err
 	}
+	return ciphertext, iv, nil
+}
+
+// aesCBCEncrypt pads and encrypts the plaintext with AES in CBC mode using the given IV.
+func aesCBCEncrypt(plaintext, key, iv []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("Can't initialise cipher: %s", err)
+	}
+
+	paddedPlaintext := Pad(plaintext, aes.BlockSize)
+	ciphertext := make([]byte, len(paddedPlaintext))
 
 	mode := cipher.NewCBCEncrypter(block, iv)
 	mode.CryptBlocks(ciphertext, paddedPlaintext)
 
-	return ciphertext, iv, nil
+	return ciphertext, nil
+}
+
+// aesCBCEncryptString pads and encrypts the plaintext with AES in CBC mode using a random IV, returning the base64 encoded
+// ciphertext and the IV. The padded plaintext is encrypted in place in a pooled buffer, which is zeroed afterwards.
+func aesCBCEncryptString(plaintext string, key []byte) (string, []byte, error) {
+	if len(plaintext) == 0 {
+		return "", nil, fmt.Errorf("Plaintext can't be empty")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", nil, fmt.Errorf("Can't initialise cipher: %s", err)
+	}
+
+	iv, err := RandomBytes(aes.BlockSize)
+	if err != nil {
+		return "", nil, err
+	}
+
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	buffer := getBuffer(len(plaintext) + padding)
+	defer putBuffer(buffer)
+	padded := *buffer
+	copy(padded, plaintext)
+	for i := len(plaintext); i < len(padded); i++ {
+		padded[i] = byte(padding)
+	}
+
+	mode := cipher.NewCBCEncrypter(block, iv)
+	mode.CryptBlocks(padded, padded)
+	return base64.StdEncoding.EncodeToString(padded), iv, nil
 }
 
 // ThreatSpec TMv0.1 for AESDecrypt
@@ -189,6 +357,12 @@ func AESEncrypt(plaintext, key []byte) (ciphertext []byte, iv []byte, err error)
 // AESDecrypt is an opinionated helper function that decryptes a ciphertext encrypted
 // with 256 bit AES in CBC mode and returns the plaintext.
 func AESDecrypt(ciphertext, iv, key []byte) ([]byte, error) {
+	return aesCBCDecrypt(make([]byte, len(ciphertext)), ciphertext, iv, key)
+}
+
+// aesCBCDecrypt decrypts the ciphertext with AES in CBC mode into dst, which may be the ciphertext itself,
+// returning the unpadded plaintext as a slice of dst.
+func aesCBCDecrypt(dst, ciphertext, iv, key []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, fmt.Errorf("Can't initialise cipher: %s", err)
@@ -202,22 +376,175 @@ func AESDecrypt(ciphertext, iv, key []byte) ([]byte, error) {
 		return nil, fmt.Errorf("iv is not equal to block size")
 	}
 
-	paddedPlaintext := make([]byte, len(ciphertext))
+	if len(ciphertext) == 0 {
+		return nil, fmt.Errorf("ciphertext is empty")
+	}
+
+	paddedPlaintext := dst[:len(ciphertext)]
 	mode := cipher.NewCBCDecrypter(block, iv)
 	mode.CryptBlocks(paddedPlaintext, ciphertext)
 
+	if padding := int(paddedPlaintext[len(paddedPlaintext)-1]); padding == 0 || padding > aes.BlockSize {
+		return nil, fmt.Errorf("invalid padding")
+	}
+
 	return UnPad(paddedPlaintext), nil
 }
 
+// keyWrapIV is the default initial value for AES key wrap, from RFC 3394.
+var keyWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// ThreatSpec TMv0.1 for AESKeyWrap
+// Does symmetric key wrapping for App:Crypto
+
+// AESKeyWrap wraps the key with the key encryption key using AES key wrap, as defined in RFC 3394.
+// The key must be at least 16 bytes and a multiple of 8 bytes. The wrapped key is 8 bytes longer than the key.
+func AESKeyWrap(kek, key []byte) ([]byte, error) {
+	if len(key) < 16 || len(key)%8 != 0 {
+		return nil, fmt.Errorf("Key to wrap must be a multiple of 8 bytes and at least 16 bytes")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, fmt.Errorf("Can't initialise cipher: %s", err)
+	}
+
+	n := len(key) / 8
+	wrapped := make([]byte, 8+len(key))
+	copy(wrapped, keyWrapIV)
+	copy(wrapped[8:], key)
+	b := make([]byte, aes.BlockSize)
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b, wrapped[:8])
+			copy(b[8:], wrapped[8*i:8*i+8])
+			block.Encrypt(b, b)
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(wrapped[:8], binary.BigEndian.Uint64(b[:8])^t)
+			copy(wrapped[8*i:8*i+8], b[8:])
+		}
+	}
+	return wrapped, nil
+}
+
+// ThreatSpec TMv0.1 for AESKeyUnwrap
+// Does symmetric key unwrapping for App:Crypto
+// Mitigates App:Crypto against wrapped key tampering with integrity check value
+
+// AESKeyUnwrap unwraps a key wrapped by AESKeyWrap with the key encryption key.
+// It returns ErrAuthenticationFailed if the integrity check fails, such as with the wrong key encryption key.
+func AESKeyUnwrap(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, fmt.Errorf("Wrapped key must be a multiple of 8 bytes and at least 24 bytes")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, fmt.Errorf("Can't initialise cipher: %s", err)
+	}
+
+	n := len(wrapped)/8 - 1
+	a := make([]byte, 8)
+	copy(a, wrapped[:8])
+	key := make([]byte, len(wrapped)-8)
+	copy(key, wrapped[8:])
+	b := make([]byte, aes.BlockSize)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(a)^t)
+			copy(b[8:], key[8*(i-1):8*i])
+			block.Decrypt(b, b)
+			copy(a, b[:8])
+			copy(key[8*(i-1):8*i], b[8:])
+		}
+	}
+	if subtle.ConstantTimeCompare(a, keyWrapIV) != 1 {
+		return nil, ErrAuthenticationFailed
+	}
+	return key, nil
+}
+
+// ThreatSpec TMv0.1 for AESGCMEncrypt
+// Does authenticated symmetric encryption for App:Crypto
+// Mitigates App:Crypto against ciphertext tampering with AES in GCM mode
+// Mitigates App:Crypto against nonce reuse with generated random nonce
+
+// AESGCMEncrypt is an opinionated helper function that implements 256 bit AES in GCM mode.
+// It creates a random 96 bit nonce which is returned along with the ciphertext. The additional data is authenticated but not encrypted.
+func AESGCMEncrypt(plaintext, key, additionalData []byte) (ciphertext []byte, nonce []byte, err error) {
+	if len(plaintext) == 0 {
+		return nil, nil, fmt.Errorf("Plaintext can't be empty")
+	}
+
+	nonce, err = RandomBytes(gcmNonceSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ciphertext, err = aesGCMSeal(plaintext, key, nonce, additionalData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ciphertext, nonce, nil
+}
+
+// aesGCMSeal encrypts and authenticates the plaintext with AES in GCM mode using the given nonce.
+func aesGCMSeal(plaintext, key, nonce, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("Can't initialise cipher: %s", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("Can't initialise GCM: %s", err)
+	}
+
+	return aead.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+// ThreatSpec TMv0.1 for AESGCMDecrypt
+// Does authenticated symmetric decryption for App:Crypto
+
+// AESGCMDecrypt is an opinionated helper function that decrypts a ciphertext encrypted
+// with 256 bit AES in GCM mode and returns the plaintext. If the ciphertext or additional data
+// have been modified, it returns ErrAuthenticationFailed.
+func AESGCMDecrypt(ciphertext, nonce, key, additionalData []byte) ([]byte, error) {
+	return aesGCMOpen(nil, ciphertext, nonce, key, additionalData)
+}
+
+// aesGCMOpen decrypts and authenticates the ciphertext with AES in GCM mode, appending the plaintext to dst.
+// Passing ciphertext[:0] as dst decrypts in place.
+func aesGCMOpen(dst, ciphertext, nonce, key, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("Can't initialise cipher: %s", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("Can't initialise GCM: %s", err)
+	}
+
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("nonce is not equal to nonce size")
+	}
+
+	plaintext, err := aead.Open(dst, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrAuthenticationFailed
+	}
+	return plaintext, nil
+}
+
 // TheatSpec TMv0.1 for GetKeyType
 // Does key type identification for App:Crypto
 
-// GetKeyType returns the key type for a given key
+// GetKeyType returns the key type for a given private or public key
 func GetKeyType(key interface{}) (KeyType, error) {
 	switch t := key.(type) {
-	case *rsa.PrivateKey:
+	case *rsa.PrivateKey, *rsa.PublicKey:
 		return KeyTypeRSA, nil
-	case *ecdsa.PrivateKey:
+	case *ecdsa.PrivateKey, *ecdsa.PublicKey:
 		return KeyTypeEC, nil
 	default:
 		return "", fmt.Errorf("Unknown key type: %T", t)
@@ -256,23 +583,49 @@ func GenerateECKey() (*ecdsa.PrivateKey, error) {
 
 // PemEncodePrivate PEM encodes a private key. It supports RSA and ECDSA key types.
 func PemEncodePrivate(key crypto.PrivateKey) ([]byte, error) {
+	return PemEncodePrivateWithHeaders(key, nil)
+}
+
+// ThreatSpec TMv0.1 for PemEncodePrivateWithHeaders
+// Does PEM encoding of private keys with headers for App:Crypto
+
+// PemEncodePrivateWithHeaders is like PemEncodePrivate, but adds the headers to the PEM block.
+// Headers are informational only and are ignored when decoding.
+func PemEncodePrivateWithHeaders(key crypto.PrivateKey, headers map[string]string) ([]byte, error) {
+	der, err := DerEncodePrivate(key)
+	if err != nil {
+		return nil, err
+	}
 
+	var t string
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		t = "RSA PRIVATE KEY"
+	case *ecdsa.PrivateKey:
+		t = "EC PRIVATE KEY"
+	}
+
+	b := &pem.Block{Type: t, Headers: headers, Bytes: der}
+	return pemEncode(b)
+}
+
+// ThreatSpec TMv0.1 for DerEncodePrivate
+// Does DER encoding of private keys for App:Crypto
+
+// DerEncodePrivate DER encodes a private key, as PKCS1 for RSA keys and SEC 1 for ECDSA keys.
+func DerEncodePrivate(key crypto.PrivateKey) ([]byte, error) {
 	switch k := key.(type) {
 	case *rsa.PrivateKey:
-		der := x509.MarshalPKCS1PrivateKey(k)
-		b := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: der}
-		return pem.EncodeToMemory(b), nil
+		return x509.MarshalPKCS1PrivateKey(k), nil
 	case *ecdsa.PrivateKey:
 		der, err := x509.MarshalECPrivateKey(k)
 		if err != nil {
 			return nil, fmt.Errorf("Can't marshal ECDSA key: %s", err)
 		}
-		b := &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
-		return pem.EncodeToMemory(b), nil
+		return der, nil
 	default:
 		return nil, errors.New("Unsupported private key type")
 	}
-
 }
 
 // ThreatSpec TMv0.1 for PemEncodePublic
@@ -280,7 +633,16 @@ func PemEncodePrivate(key crypto.PrivateKey) ([]byte, error) {
 
 // PemEncodePublic PEM encodes a public key. It supports RSA and ECDSA.
 func PemEncodePublic(key crypto.PublicKey) ([]byte, error) {
-	der, err := x509.MarshalPKIXPublicKey(key)
+	return PemEncodePublicWithHeaders(key, nil)
+}
+
+// ThreatSpec TMv0.1 for PemEncodePublicWithHeaders
+// Does PEM encoding of public keys with headers for App:Crypto
+
+// PemEncodePublicWithHeaders is like PemEncodePublic, but adds the headers to the PEM block.
+// Headers are informational only and are ignored when decoding.
+func PemEncodePublicWithHeaders(key crypto.PublicKey, headers map[string]string) ([]byte, error) {
+	der, err := DerEncodePublic(key)
 	if err != nil {
 		return nil, err
 	}
@@ -291,11 +653,32 @@ func PemEncodePublic(key crypto.PublicKey) ([]byte, error) {
 		t = "RSA PUBLIC KEY"
 	case *ecdsa.PublicKey:
 		t = "EC PUBLIC KEY"
+	}
+
+	b := &pem.Block{Type: t, Headers: headers, Bytes: der}
+	return pemEncode(b)
+}
+
+// ThreatSpec TMv0.1 for DerEncodePublic
+// Does DER encoding of public keys for App:Crypto
+
+// DerEncodePublic DER encodes a public key as PKIX. It supports RSA and ECDSA.
+func DerEncodePublic(key crypto.PublicKey) ([]byte, error) {
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
 	default:
 		return nil, errors.New("Unsupported public key type")
 	}
+	return x509.MarshalPKIXPublicKey(key)
+}
 
-	b := &pem.Block{Type: t, Bytes: der}
+// pemEncode PEM encodes the block, returning an error if a header can't be encoded.
+func pemEncode(b *pem.Block) ([]byte, error) {
+	for k, v := range b.Headers {
+		if strings.ContainsAny(k, ":\r\n") || strings.ContainsAny(v, "\r\n") {
+			return nil, fmt.Errorf("Invalid PEM header '%s'", k)
+		}
+	}
 	return pem.EncodeToMemory(b), nil
 }
 
@@ -303,32 +686,217 @@ func PemEncodePublic(key crypto.PublicKey) ([]byte, error) {
 // Does PEM decoding of private keys for App:Crypto
 
 // PemDecodePrivate decodes a PEM encoded private key. It supports PKCS1 and EC private keys.
+// Input without a PEM block, or with a block that isn't a valid key, returns ErrMalformedKey.
 func PemDecodePrivate(in []byte) (crypto.PrivateKey, error) {
 	b, _ := pem.Decode(in)
-	key, err := x509.ParsePKCS1PrivateKey(b.Bytes)
+	if b == nil {
+		return nil, fmt.Errorf("Could not decode PEM: %w", ErrMalformedKey)
+	}
+	return DerDecodePrivate(b.Bytes)
+}
+
+// ThreatSpec TMv0.1 for DerDecodePrivate
+// Does DER decoding of private keys for App:Crypto
+// Mitigates App:Crypto against denial of service from adversarial keys with recovery from parser panics
+
+// DerDecodePrivate decodes a DER encoded private key. It supports PKCS1 and EC private keys.
+// Input that isn't a valid key returns ErrMalformedKey, including if the parser panics.
+func DerDecodePrivate(der []byte) (key crypto.PrivateKey, err error) {
+	defer recoverMalformedKey(&err)
+	rsaKey, err := x509.ParsePKCS1PrivateKey(der)
 	if err != nil {
-		eckey, err := x509.ParseECPrivateKey(b.Bytes)
+		eckey, err := x509.ParseECPrivateKey(der)
 		if err != nil {
-			return nil, fmt.Errorf("Could not parse private key: %s", err)
+			return nil, fmt.Errorf("Could not parse private key: %s: %w", err, ErrMalformedKey)
 		}
 		return eckey, nil
 	}
-	return key, nil
+	return rsaKey, nil
+}
+
+// recoverMalformedKey recovers from a panic while parsing a key, setting the error to ErrMalformedKey.
+// It must be deferred directly by the parsing function.
+func recoverMalformedKey(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("Could not parse key: %v: %w", r, ErrMalformedKey)
+	}
+}
+
+// ThreatSpec TMv0.1 for DecodePrivate
+// Does PEM or DER decoding of private keys for App:Crypto
+
+// DecodePrivate decodes a PEM or DER encoded private key, detecting the encoding. Input containing a PEM block is
+// decoded with PemDecodePrivate, and anything else with DerDecodePrivate.
+func DecodePrivate(in []byte) (crypto.PrivateKey, error) {
+	if b, _ := pem.Decode(in); b != nil {
+		return DerDecodePrivate(b.Bytes)
+	}
+	return DerDecodePrivate(in)
 }
 
 // ThreatSpec TMv0.1 for PemDecodePublic
 // Does PEM decodimg of public keys for App:Crypto
 
 // PemDecodePublic decodes a PEM encoded public key. It supports any PKIX public key.
+// Input without a PEM block, or with a block that isn't a valid key, returns ErrMalformedKey.
+// RSA and EC keys are checked with ValidatePublicKey, returning ErrInvalidPublicKey if they are weak or invalid.
 func PemDecodePublic(in []byte) (crypto.PublicKey, error) {
 	b, _ := pem.Decode(in)
-	pubKey, err := x509.ParsePKIXPublicKey(b.Bytes)
+	if b == nil {
+		return nil, fmt.Errorf("Could not decode PEM: %w", ErrMalformedKey)
+	}
+	return DerDecodePublic(b.Bytes)
+}
+
+// ThreatSpec TMv0.1 for DerDecodePublic
+// Does DER decoding of public keys for App:Crypto
+// Mitigates App:Crypto against denial of service from adversarial keys with recovery from parser panics
+
+// DerDecodePublic decodes a DER encoded PKIX public key, checking RSA and EC keys with ValidatePublicKey like PemDecodePublic.
+// Input that isn't a valid key returns ErrMalformedKey, including if the parser panics.
+func DerDecodePublic(der []byte) (publicKey crypto.PublicKey, err error) {
+	defer recoverMalformedKey(&err)
+	pubKey, err := x509.ParsePKIXPublicKey(der)
 	if err != nil {
-		return nil, fmt.Errorf("Could not parse public key: %s", err)
+		return nil, fmt.Errorf("Could not parse public key: %s: %w", err, ErrMalformedKey)
+	}
+	if err := ValidatePublicKey(pubKey); err != nil {
+		return nil, err
 	}
 	return pubKey, nil
 }
 
+// ThreatSpec TMv0.1 for ValidatePublicKey
+// Mitigates App:Crypto against invalid curve attacks with on-curve check of EC points
+// Mitigates App:Crypto against weak RSA keys with public exponent and modulus size checks
+
+// ValidatePublicKey returns ErrInvalidPublicKey if an EC public key is the point at infinity or not on its curve,
+// or if an RSA public key has a public exponent less than 3, an even public exponent, or a modulus of fewer than
+// MinRSAModulusBits bits. Other key types aren't checked.
+func ValidatePublicKey(publicKey crypto.PublicKey) error {
+	switch k := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if k.Curve == nil || k.X == nil || k.Y == nil {
+			return fmt.Errorf("EC public key is incomplete: %w", ErrInvalidPublicKey)
+		}
+		if k.X.Sign() == 0 && k.Y.Sign() == 0 {
+			return fmt.Errorf("EC public key is the point at infinity: %w", ErrInvalidPublicKey)
+		}
+		if !k.Curve.IsOnCurve(k.X, k.Y) {
+			return fmt.Errorf("EC public key isn't on curve %s: %w", k.Curve.Params().Name, ErrInvalidPublicKey)
+		}
+	case *rsa.PublicKey:
+		if k.N == nil {
+			return fmt.Errorf("RSA public key has no modulus: %w", ErrInvalidPublicKey)
+		}
+		if k.E < 3 || k.E%2 == 0 {
+			return fmt.Errorf("RSA public exponent %d is weak: %w", k.E, ErrInvalidPublicKey)
+		}
+		if bits := k.N.BitLen(); bits < MinRSAModulusBits {
+			return fmt.Errorf("RSA modulus is %d bits, less than %d: %w", bits, MinRSAModulusBits, ErrInvalidPublicKey)
+		}
+	}
+	return nil
+}
+
+// ThreatSpec TMv0.1 for SSHPublicKey
+// Does OpenSSH public key encoding for App:Crypto
+
+// SSHPublicKey encodes a public key as an OpenSSH authorized_keys line with the given comment.
+// It supports RSA keys and ECDSA keys on the NIST P-256, P-384 and P-521 curves.
+func SSHPublicKey(publicKey crypto.PublicKey, comment string) (string, error) {
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return "", fmt.Errorf("Unsupported curve for SSH: %s", k.Curve.Params().Name)
+		}
+	default:
+		return "", fmt.Errorf("Unsupported key type for SSH: %T", k)
+	}
+
+	sshKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("Could not convert public key to SSH: %s", err)
+	}
+
+	line := strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(sshKey)), "\n")
+	// The comment must stay on one line
+	if comment = strings.Join(strings.Fields(comment), " "); len(comment) > 0 {
+		line += " " + comment
+	}
+	return line, nil
+}
+
+// Hash tags for domain separation, see TaggedHash
+const (
+	TagFingerprint     = "pki.io/fingerprint"
+	TagContentDigest   = "pki.io/content-digest"
+	TagContainerDigest = "pki.io/container-digest"
+	TagChallenge       = "pki.io/challenge"
+	TagStreamDigest    = "pki.io/stream-digest"
+)
+
+// ThreatSpec TMv0.1 for TaggedHash
+// Does domain separated hashing for App:Crypto
+// Mitigates App:Crypto against cross-protocol hash collisions with domain separation tags
+
+// TaggedHash returns the SHA-256 digest of the data prefixed with a domain separation tag, so that hashes made for
+// different purposes never collide even over the same data. The tag is length prefixed, so no tag and data can be
+// confused with another.
+func TaggedHash(tag string, data []byte) []byte {
+	hash := NewTaggedHash(tag)
+	hash.Write(data)
+	return hash.Sum(nil)
+}
+
+// ThreatSpec TMv0.1 for NewTaggedHash
+// Does incremental domain separated hashing for App:Crypto
+
+// NewTaggedHash returns a SHA-256 hash that has been fed the length prefixed tag, so that data written to it gives the
+// same digest as TaggedHash without being held in memory at once.
+func NewTaggedHash(tag string) hash.Hash {
+	digest := sha256.New()
+	length := make([]byte, 8)
+	binary.BigEndian.PutUint64(length, uint64(len(tag)))
+	digest.Write(length)
+	digest.Write([]byte(tag))
+	return digest
+}
+
+// ThreatSpec TMv0.1 for Fingerprint
+// Does public key fingerprinting for App:Crypto
+
+// Fingerprint returns the hex encoded tagged hash of the DER encoded public key, see TaggedHash.
+// The fingerprint doesn't depend on PEM headers or formatting.
+//
+// Fingerprints were untagged SHA-256 digests before TaggedHash was introduced, so fingerprints recorded by earlier
+// versions don't match, and neither do entity ids derived from them. LegacyFingerprint returns the earlier form, which
+// is only accepted where fingerprints are checked if AcceptLegacyDigests is set.
+func Fingerprint(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("Could not marshal public key: %s", err)
+	}
+	return hex.EncodeToString(TaggedHash(TagFingerprint, der)), nil
+}
+
+// ThreatSpec TMv0.1 for LegacyFingerprint
+// Does legacy public key fingerprinting for App:Crypto
+
+// LegacyFingerprint returns the hex encoded untagged SHA-256 digest of the DER encoded public key, as returned by
+// Fingerprint before TaggedHash was introduced. It should only be used to migrate fingerprints recorded by earlier versions.
+func LegacyFingerprint(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("Could not marshal public key: %s", err)
+	}
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:]), nil
+}
+
 // ThreatSpec TMv0.1 for Encrypt
 // Does asymmetric encryption for App:Crypto
 
@@ -352,9 +920,14 @@ func Encrypt(plaintext []byte, publicKey crypto.PublicKey) ([]byte, error) {
 // rsaEncrypt is an opinionated helper function that encryptes a plaintext using an RSA public key,
 // and returns the ciphertext. It uses OAEP with SHA-256.
 func rsaEncrypt(plaintext []byte, publicKey *rsa.PublicKey) ([]byte, error) {
+	return rsaEncryptWithRand(rand.Reader, plaintext, publicKey)
+}
+
+// rsaEncryptWithRand is like rsaEncrypt, but reads the OAEP seed from random. Only test vectors use a source other than crypto/rand.
+func rsaEncryptWithRand(random io.Reader, plaintext []byte, publicKey *rsa.PublicKey) ([]byte, error) {
 	label := []byte("")
 	hash := sha256.New()
-	ciphertext, err := rsa.EncryptOAEP(hash, rand.Reader, publicKey, plaintext, label)
+	ciphertext, err := rsa.EncryptOAEP(hash, random, publicKey, plaintext, label)
 	if err != nil {
 		return nil, fmt.Errorf("Could not RSA encrypt: %s", err)
 	}
@@ -454,10 +1027,30 @@ func rsaSign(message []byte, privateKey *rsa.PrivateKey) ([]byte, error) {
 	return signature, nil
 }
 
+// ThreatSpec TMv0.1 for rsaPSSSign
+// Does RSA-PSS message signing for App:Crypto
+
+// rsaPSSSign is an opinionated helper function that signs a message using an RSA private key. It uses PSS with SHA-256
+// and a salt the length of the hash, and returns the message signature.
+func rsaPSSSign(message []byte, privateKey *rsa.PrivateKey) ([]byte, error) {
+	return rsaPSSSignWithRand(rand.Reader, message, privateKey)
+}
+
+// rsaPSSSignWithRand is like rsaPSSSign, but reads the salt from random. Only test vectors use a source other than crypto/rand.
+func rsaPSSSignWithRand(random io.Reader, message []byte, privateKey *rsa.PrivateKey) ([]byte, error) {
+	hashed := sha256.Sum256(message)
+	signature, err := rsa.SignPSS(random, privateKey, crypto.SHA256, hashed[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	if err != nil {
+		return nil, fmt.Errorf("Could not RSA-PSS sign: %s", err)
+	}
+	return signature, nil
+}
+
 // ThreatSpec TMv0.1 for ecdsaSign
 // Does EC DSA message signing for App:Crypto
 
 // ecdsaSign is an opinionated helper function that signs a message using an ECDSA private key, and returns the message signature. It uses SHA-256 for hashing.
+// The signature is normalised so that S is in the lower half of the curve order.
 func ecdsaSign(message []byte, privateKey *ecdsa.PrivateKey) ([]byte, error) {
 	hash := sha256.New()
 	_, err := io.WriteString(hash, string(message))
@@ -470,6 +1063,7 @@ func ecdsaSign(message []byte, privateKey *ecdsa.PrivateKey) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Could not ECDSA sign: %s", err)
 	}
+	s = NormaliseLowS(s, privateKey.Curve)
 
 	// TODO - this bit is ugly
 	buf := new(bytes.Buffer)
@@ -493,6 +1087,7 @@ func ecdsaSign(message []byte, privateKey *ecdsa.PrivateKey) ([]byte, error) {
 // Does asymmetric signature verification for App:Crypto
 
 // VerifySignature verifies a message for a given signature and public key. If verified, the function returns nil, otherwise it returns an error. It supports RSA and ECDSA public keys.
+// A signature that is the wrong size for the key, or for ECDSA isn't a valid (r,s) pair, returns ErrSignatureLengthMismatch.
 func VerifySignature(message []byte, signature []byte, publicKey crypto.PublicKey) error {
 	switch k := publicKey.(type) {
 	case *rsa.PublicKey:
@@ -516,6 +1111,10 @@ func rsaVerify(message []byte, signature []byte, publicKey *rsa.PublicKey) error
 		return fmt.Errorf("Could not write to hash: %s", err)
 	}
 
+	if len(signature) != publicKey.Size() {
+		return fmt.Errorf("RSA signature is %d bytes but key is %d bytes: %w", len(signature), publicKey.Size(), ErrSignatureLengthMismatch)
+	}
+
 	hashed := hash.Sum(nil)
 	err = rsa.VerifyPKCS1v15(publicKey, h, hashed, signature)
 	if err != nil {
@@ -524,6 +1123,22 @@ func rsaVerify(message []byte, signature []byte, publicKey *rsa.PublicKey) error
 	return nil
 }
 
+// ThreatSpec TMv0.1 for rsaPSSVerify
+// Does RSA-PSS signature verification for App:Crypto
+
+// rsaPSSVerify is an opinionated helper function that verifies a message for a given signature and RSA public key. If verified, the function returns nil, otherwise it returns an error. It uses PSS with SHA-256.
+func rsaPSSVerify(message []byte, signature []byte, publicKey *rsa.PublicKey) error {
+	if len(signature) != publicKey.Size() {
+		return fmt.Errorf("RSA signature is %d bytes but key is %d bytes: %w", len(signature), publicKey.Size(), ErrSignatureLengthMismatch)
+	}
+
+	hashed := sha256.Sum256(message)
+	if err := rsa.VerifyPSS(publicKey, crypto.SHA256, hashed[:], signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}); err != nil {
+		return fmt.Errorf("Could not RSA-PSS verify: %s", err)
+	}
+	return nil
+}
+
 // ThreatSpec TMv0.1 for ecdsaVerify
 // Does EC DSA signature verification for App:Crypto
 
@@ -535,10 +1150,20 @@ func ecdsaVerify(message []byte, signature []byte, publicKey *ecdsa.PublicKey) e
 		return fmt.Errorf("Could not write to hash: %s", err)
 	}
 
+	// The signature is the length of r, then r and s, each no longer than the curve order
+	size := (publicKey.Curve.Params().N.BitLen() + 7) / 8
+	if len(signature) < 3 || int(signature[0]) == 0 || int(signature[0]) > size ||
+		int(signature[0])+1 >= len(signature) || len(signature)-int(signature[0])-1 > size {
+		return fmt.Errorf("ECDSA signature of %d bytes isn't a valid (r,s) pair for key: %w", len(signature), ErrSignatureLengthMismatch)
+	}
+
 	hashed := hash.Sum(nil)
 	l := int(signature[0])
 	r := new(big.Int).SetBytes(signature[1 : l+1])
 	s := new(big.Int).SetBytes(signature[l+1:])
+	if StrictLowS && !isLowS(s, publicKey.Curve) {
+		return ErrHighS
+	}
 	ok := ecdsa.Verify(publicKey, hashed, r, s)
 	if !ok {
 		return errors.New("Could not ECDSA verify.")
@@ -546,6 +1171,26 @@ func ecdsaVerify(message []byte, signature []byte, publicKey *ecdsa.PublicKey) e
 	return nil
 }
 
+// ThreatSpec TMv0.1 for NormaliseLowS
+// Does ECDSA signature canonicalisation for App:Crypto
+// Mitigates App:Crypto against signature malleability with low-S normalisation
+
+// NormaliseLowS returns s if it is in the lower half of the curve order, otherwise the equivalent value N - s.
+// Signatures made outside Sign, such as on a hardware token, should be normalised with it so that they verify when
+// StrictLowS is set.
+func NormaliseLowS(s *big.Int, curve elliptic.Curve) *big.Int {
+	if isLowS(s, curve) {
+		return s
+	}
+	return new(big.Int).Sub(curve.Params().N, s)
+}
+
+// isLowS checks whether s is in the lower half of the curve order.
+func isLowS(s *big.Int, curve elliptic.Curve) bool {
+	halfOrder := new(big.Int).Rsh(curve.Params().N, 1)
+	return s.Cmp(halfOrder) <= 0
+}
+
 // ThreatSpec TMv0.1 for hmac256
 // Does SHA-256  message authentication for App:Crypto
 
@@ -0,0 +1,320 @@
+//go:build go1.24
+
+// ThreatSpec package github.com/pki-io/core/crypto as crypto
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hkdf"
+	"crypto/mlkem"
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// KeyTypeHybrid is a hybrid encryption key pair, of a classical RSA or EC key and an ML-KEM-768 key. It can only be
+// used for encryption, as ML-KEM is a key encapsulation mechanism.
+const KeyTypeHybrid KeyType = "hybrid"
+
+// KeyWrapHybrid wraps the data key for a HybridRecipient, with a key derived from both the classical and the
+// ML-KEM-768 shared secrets.
+const KeyWrapHybrid = "hybrid-ml-kem-768"
+
+// PEM block types of the ML-KEM-768 part of hybrid keys.
+const (
+	pemTypeMLKEMPrivate = "ML-KEM-768 PRIVATE KEY"
+	pemTypeMLKEMPublic  = "ML-KEM-768 PUBLIC KEY"
+)
+
+// hybridInfo is the HKDF info prefix used to derive hybrid key wrapping keys.
+const hybridInfo = "pki.io hybrid key wrap v1"
+
+// HybridPrivateKey is a KeyTypeHybrid private key.
+type HybridPrivateKey struct {
+	Classical crypto.PrivateKey
+	KEM       *mlkem.DecapsulationKey768
+}
+
+// HybridPublicKey is a KeyTypeHybrid public key.
+type HybridPublicKey struct {
+	Classical crypto.PublicKey
+	KEM       *mlkem.EncapsulationKey768
+}
+
+// ThreatSpec TMv0.1 for GenerateHybridKey
+// Does hybrid key generation for App:Crypto
+
+// GenerateHybridKey generates a hybrid key pair with an EC P-256 classical key and an ML-KEM-768 key.
+func GenerateHybridKey() (*HybridPrivateKey, error) {
+	classical, err := GenerateECKey()
+	if err != nil {
+		return nil, err
+	}
+	kem, err := mlkem.GenerateKey768()
+	if err != nil {
+		return nil, fmt.Errorf("Can't create ML-KEM keys: %s", err)
+	}
+	return &HybridPrivateKey{Classical: classical, KEM: kem}, nil
+}
+
+// Public returns the public part of the hybrid key.
+func (key *HybridPrivateKey) Public() *HybridPublicKey {
+	return &HybridPublicKey{Classical: key.Classical.(crypto.Signer).Public(), KEM: key.KEM.EncapsulationKey()}
+}
+
+// ThreatSpec TMv0.1 for PemEncodeHybridPrivate
+// Does PEM encoding of hybrid private keys for App:Crypto
+
+// PemEncodeHybridPrivate PEM encodes a hybrid private key as the classical private key block followed by an
+// ML-KEM-768 private key block holding the key's seed.
+func PemEncodeHybridPrivate(key *HybridPrivateKey) ([]byte, error) {
+	classical, err := PemEncodePrivate(key.Classical)
+	if err != nil {
+		return nil, err
+	}
+	kem, err := pemEncode(&pem.Block{Type: pemTypeMLKEMPrivate, Bytes: key.KEM.Bytes()})
+	if err != nil {
+		return nil, err
+	}
+	return append(classical, kem...), nil
+}
+
+// ThreatSpec TMv0.1 for PemEncodeHybridPublic
+// Does PEM encoding of hybrid public keys for App:Crypto
+
+// PemEncodeHybridPublic PEM encodes a hybrid public key as the classical public key block followed by an
+// ML-KEM-768 public key block.
+func PemEncodeHybridPublic(key *HybridPublicKey) ([]byte, error) {
+	classical, err := PemEncodePublic(key.Classical)
+	if err != nil {
+		return nil, err
+	}
+	kem, err := pemEncode(&pem.Block{Type: pemTypeMLKEMPublic, Bytes: key.KEM.Bytes()})
+	if err != nil {
+		return nil, err
+	}
+	return append(classical, kem...), nil
+}
+
+// ThreatSpec TMv0.1 for PemDecodeHybridPrivate
+// Does PEM decoding of hybrid private keys for App:Crypto
+
+// PemDecodeHybridPrivate decodes a hybrid private key from PemEncodeHybridPrivate. Input that isn't a hybrid private
+// key returns ErrMalformedKey.
+func PemDecodeHybridPrivate(in []byte) (*HybridPrivateKey, error) {
+	classical, rest, err := splitHybridPem(in, pemTypeMLKEMPrivate)
+	if err != nil {
+		return nil, err
+	}
+	classicalKey, err := PemDecodePrivate(classical)
+	if err != nil {
+		return nil, err
+	}
+	kem, err := mlkem.NewDecapsulationKey768(rest)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode ML-KEM private key: %s: %w", err, ErrMalformedKey)
+	}
+	return &HybridPrivateKey{Classical: classicalKey, KEM: kem}, nil
+}
+
+// ThreatSpec TMv0.1 for PemDecodeHybridPublic
+// Does PEM decoding of hybrid public keys for App:Crypto
+
+// PemDecodeHybridPublic decodes a hybrid public key from PemEncodeHybridPublic. Input that isn't a hybrid public
+// key returns ErrMalformedKey, and an invalid classical key returns ErrInvalidPublicKey.
+func PemDecodeHybridPublic(in []byte) (*HybridPublicKey, error) {
+	classical, rest, err := splitHybridPem(in, pemTypeMLKEMPublic)
+	if err != nil {
+		return nil, err
+	}
+	classicalKey, err := PemDecodePublic(classical)
+	if err != nil {
+		return nil, err
+	}
+	kem, err := mlkem.NewEncapsulationKey768(rest)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode ML-KEM public key: %s: %w", err, ErrMalformedKey)
+	}
+	return &HybridPublicKey{Classical: classicalKey, KEM: kem}, nil
+}
+
+// splitHybridPem returns the PEM encoded classical key block and the bytes of the ML-KEM block of the given type.
+func splitHybridPem(in []byte, kemType string) ([]byte, []byte, error) {
+	classical, rest := pem.Decode(in)
+	if classical == nil {
+		return nil, nil, fmt.Errorf("Could not decode PEM: %w", ErrMalformedKey)
+	}
+	kem, _ := pem.Decode(rest)
+	if kem == nil || kem.Type != kemType {
+		return nil, nil, fmt.Errorf("Missing %s block: %w", kemType, ErrMalformedKey)
+	}
+	return in[:len(in)-len(rest)], kem.Bytes, nil
+}
+
+// HybridRecipient is a recipient holding a hybrid key pair. The data key is wrapped with AES key wrap under a key
+// derived from two shared secrets: one encrypted to the classical public key and one encapsulated to the ML-KEM-768
+// public key. Unwrapping needs both, so the data key stays protected as long as either algorithm holds.
+// GroupDecryptWithHybrid or a HybridDecrypter unwraps it.
+type HybridRecipient struct {
+	Id string
+	// PublicKey is the PEM encoded hybrid public key, see PemEncodeHybridPublic.
+	PublicKey string
+}
+
+// RecipientId returns the recipient's id.
+func (recipient HybridRecipient) RecipientId() string {
+	return recipient.Id
+}
+
+func (recipient HybridRecipient) wrapKey(key []byte) (string, string, error) {
+	publicKey, err := PemDecodeHybridPublic([]byte(recipient.PublicKey))
+	if err != nil {
+		return "", "", err
+	}
+
+	classicalSecret, err := RandomBytes(32)
+	if err != nil {
+		return "", "", err
+	}
+	defer clear(classicalSecret)
+	classicalCiphertext, err := Encrypt(classicalSecret, publicKey.Classical)
+	if err != nil {
+		return "", "", err
+	}
+	kemSecret, kemCiphertext := publicKey.KEM.Encapsulate()
+	defer clear(kemSecret)
+
+	kek, err := hybridKek(classicalSecret, kemSecret, classicalCiphertext, kemCiphertext)
+	if err != nil {
+		return "", "", err
+	}
+	defer clear(kek)
+	wrapped, err := AESKeyWrap(kek, key)
+	if err != nil {
+		return "", "", err
+	}
+
+	parts := [][]byte{Base64Encode(classicalCiphertext), Base64Encode(kemCiphertext), Base64Encode(wrapped)}
+	return string(bytes.Join(parts, []byte("."))), KeyWrapHybrid, nil
+}
+
+func (recipient HybridRecipient) validate() error {
+	_, err := PemDecodeHybridPublic([]byte(recipient.PublicKey))
+	return err
+}
+
+// hybridKek derives the key wrapping key from both shared secrets, binding it to both ciphertexts.
+func hybridKek(classicalSecret, kemSecret, classicalCiphertext, kemCiphertext []byte) ([]byte, error) {
+	secret := append(append([]byte(nil), classicalSecret...), kemSecret...)
+	defer clear(secret)
+	info := hybridInfo + string(classicalCiphertext) + string(kemCiphertext)
+	kek, err := hkdf.Key(sha256.New, secret, nil, info, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Could not derive key wrapping key: %s", err)
+	}
+	return kek, nil
+}
+
+// ThreatSpec TMv0.1 for GroupDecryptWithHybrid
+// Does hybrid decryption with a hybrid post-quantum key for App:Crypto
+// Mitigates App:Crypto against future quantum attacks on classical key wrapping with key derived from classical and ML-KEM secrets
+
+// GroupDecryptWithHybrid is like GroupDecrypt, but unwraps the data key of a HybridRecipient with the hybrid private key.
+// Both the classical and the ML-KEM-768 shared secrets must be recovered, otherwise ErrWrappedKeyUnwrapFailed is returned.
+func GroupDecryptWithHybrid(encrypted *Encrypted, keyID string, privateKey *HybridPrivateKey) (string, error) {
+	key, err := unwrapKeyWithHybrid(encrypted, keyID, privateKey)
+	if err != nil {
+		return "", err
+	}
+	defer clear(key)
+	return decryptPayload(encrypted, key)
+}
+
+// unwrapKeyWithHybrid returns the data key wrapped for the key ID, unwrapped with the hybrid private key.
+func unwrapKeyWithHybrid(encrypted *Encrypted, keyID string, privateKey *HybridPrivateKey) ([]byte, error) {
+	if encrypted.Mode != string(EncryptionModeAesCbc256Rsa) && encrypted.Mode != string(EncryptionModeAesGcm256Rsa) {
+		return nil, fmt.Errorf("Invalid mode '%s'", encrypted.Mode)
+	}
+
+	wrappedKey, isRecipient := lookupWrappedKey(encrypted.Keys, keyID)
+	if recorded := encrypted.KeyAlgorithms[keyID]; isRecipient && recorded != KeyWrapHybrid {
+		return nil, fmt.Errorf("Key is wrapped with '%s' but hybrid key uses '%s': %w", recorded, KeyWrapHybrid, ErrWrappedKeyUnwrapFailed)
+	}
+
+	key, err := unwrapHybridKey(wrappedKey, privateKey)
+	if !isRecipient {
+		clear(key)
+		return nil, ErrNotARecipient
+	}
+	return key, err
+}
+
+// unwrapHybridKey unwraps a key wrapped for a HybridRecipient with the hybrid private key.
+func unwrapHybridKey(wrappedKey string, privateKey *HybridPrivateKey) ([]byte, error) {
+	parts := strings.Split(wrappedKey, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("Expected 3 parts in wrapped key but got %d: %w", len(parts), ErrWrappedKeyUnwrapFailed)
+	}
+	decoded := make([][]byte, len(parts))
+	for i, part := range parts {
+		var err error
+		if decoded[i], err = Base64Decode([]byte(part)); err != nil {
+			return nil, fmt.Errorf("Could not decode wrapped key: %s: %w", err, ErrWrappedKeyUnwrapFailed)
+		}
+	}
+	classicalCiphertext, kemCiphertext, wrapped := decoded[0], decoded[1], decoded[2]
+
+	classicalSecret, err := Decrypt(classicalCiphertext, privateKey.Classical)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrWrappedKeyUnwrapFailed)
+	}
+	defer clear(classicalSecret)
+	kemSecret, err := privateKey.KEM.Decapsulate(kemCiphertext)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decapsulate: %s: %w", err, ErrWrappedKeyUnwrapFailed)
+	}
+	defer clear(kemSecret)
+
+	kek, err := hybridKek(classicalSecret, kemSecret, classicalCiphertext, kemCiphertext)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrWrappedKeyUnwrapFailed)
+	}
+	defer clear(kek)
+	key, err := AESKeyUnwrap(kek, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrWrappedKeyUnwrapFailed)
+	}
+	return key, nil
+}
+
+// HybridDecrypter is a Decrypter backed by a hybrid private key.
+type HybridDecrypter struct {
+	privateKey *HybridPrivateKey
+}
+
+// ThreatSpec TMv0.1 for NewHybridDecrypter
+// Creates new hybrid key decrypter for App:Crypto
+
+// NewHybridDecrypter returns a Decrypter for the given PEM encoded hybrid private key, which is parsed once.
+func NewHybridDecrypter(privateKeyPem string) (*HybridDecrypter, error) {
+	privateKey, err := PemDecodeHybridPrivate([]byte(privateKeyPem))
+	if err != nil {
+		return nil, err
+	}
+	return &HybridDecrypter{privateKey: privateKey}, nil
+}
+
+// ThreatSpec TMv0.1 for HybridDecrypter.Decrypt
+// Does hybrid decryption with a hybrid post-quantum key for App:Crypto
+
+// Decrypt group decrypts using the hybrid private key.
+func (decrypter *HybridDecrypter) Decrypt(encrypted *Encrypted, keyID string) (string, error) {
+	return GroupDecryptWithHybrid(encrypted, keyID, decrypter.privateKey)
+}
+
+// UnwrapKey unwraps the data key using the hybrid private key.
+func (decrypter *HybridDecrypter) UnwrapKey(encrypted *Encrypted, keyID string) ([]byte, error) {
+	return unwrapKeyWithHybrid(encrypted, keyID, decrypter.privateKey)
+}
@@ -0,0 +1,73 @@
+//go:build go1.24
+
+package crypto
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestHybridKeyPem(t *testing.T) {
+	key, err := GenerateHybridKey()
+	assert.NoError(t, err)
+	privatePem, err := PemEncodeHybridPrivate(key)
+	assert.NoError(t, err)
+	publicPem, err := PemEncodeHybridPublic(key.Public())
+	assert.NoError(t, err)
+
+	decoded, err := PemDecodeHybridPrivate(privatePem)
+	assert.NoError(t, err)
+	assert.Equal(t, decoded.KEM.Bytes(), key.KEM.Bytes())
+	decodedPublic, err := PemDecodeHybridPublic(publicPem)
+	assert.NoError(t, err)
+	assert.Equal(t, decodedPublic.KEM.Bytes(), key.KEM.EncapsulationKey().Bytes())
+
+	// A classical key alone isn't a hybrid key
+	classical, _ := GenerateECKey()
+	classicalPem, _ := PemEncodePrivate(classical)
+	_, err = PemDecodeHybridPrivate(classicalPem)
+	assert.True(t, errors.Is(err, ErrMalformedKey))
+	_, err = PemDecodeHybridPublic(privatePem)
+	assert.True(t, errors.Is(err, ErrMalformedKey))
+}
+
+func TestHybridRecipient(t *testing.T) {
+	key, _ := GenerateHybridKey()
+	publicPem, _ := PemEncodeHybridPublic(key.Public())
+	privatePem, _ := PemEncodeHybridPrivate(key)
+	classical, _ := GenerateRSAKey()
+	classicalPublicPem, _ := PemEncodePublic(&classical.PublicKey)
+
+	recipients := []Recipient{
+		HybridRecipient{Id: "hybrid", PublicKey: string(publicPem)},
+		PublicKeyRecipient{Id: "classical", PublicKey: string(classicalPublicPem)},
+	}
+	encrypted, _, err := GroupEncryptForRecipients("secret", recipients)
+	assert.NoError(t, err)
+	assert.Equal(t, encrypted.KeyAlgorithms["hybrid"], KeyWrapHybrid)
+
+	decrypter, err := NewHybridDecrypter(string(privatePem))
+	assert.NoError(t, err)
+	plaintext, err := decrypter.Decrypt(encrypted, "hybrid")
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, "secret")
+
+	_, err = GroupDecryptWithHybrid(encrypted, "classical", key)
+	assert.True(t, errors.Is(err, ErrWrappedKeyUnwrapFailed))
+	_, err = GroupDecryptWithHybrid(encrypted, "missing", key)
+	assert.True(t, errors.Is(err, ErrNotARecipient))
+
+	// Both shared secrets are needed, so a different ML-KEM key can't unwrap
+	other, _ := GenerateHybridKey()
+	_, err = GroupDecryptWithHybrid(encrypted, "hybrid", &HybridPrivateKey{Classical: key.Classical, KEM: other.KEM})
+	assert.True(t, errors.Is(err, ErrWrappedKeyUnwrapFailed))
+	_, err = GroupDecryptWithHybrid(encrypted, "hybrid", &HybridPrivateKey{Classical: other.Classical, KEM: key.KEM})
+	assert.True(t, errors.Is(err, ErrWrappedKeyUnwrapFailed))
+
+	parts := strings.Split(encrypted.Keys["hybrid"], ".")
+	encrypted.Keys["hybrid"] = strings.Join(parts[:2], ".")
+	_, err = GroupDecryptWithHybrid(encrypted, "hybrid", key)
+	assert.True(t, errors.Is(err, ErrWrappedKeyUnwrapFailed))
+}
@@ -0,0 +1,152 @@
+// ThreatSpec package github.com/pki-io/core/crypto as crypto
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// JWS algorithms
+const (
+	JWSAlgorithmRS256 = "RS256"
+	JWSAlgorithmES256 = "ES256"
+)
+
+// ErrInvalidJWS is returned when a JWS is malformed or its signature doesn't verify.
+var ErrInvalidJWS = errors.New("Invalid JWS")
+
+// ThreatSpec TMv0.1 for JWSAlgorithm
+// Returns JWS algorithm for key for App:Crypto
+
+// JWSAlgorithm returns the JWS algorithm for the key, which can be a public or private key.
+// RSA keys use RS256 and ECDSA keys on P-256 use ES256. Other keys aren't supported.
+func JWSAlgorithm(key interface{}) (string, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return JWSAlgorithmRS256, nil
+	case *rsa.PublicKey:
+		return JWSAlgorithmRS256, nil
+	case *ecdsa.PrivateKey:
+		return JWSAlgorithm(&k.PublicKey)
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return "", fmt.Errorf("Unsupported curve for JWS: %s", k.Curve.Params().Name)
+		}
+		return JWSAlgorithmES256, nil
+	default:
+		return "", fmt.Errorf("Unsupported key type for JWS: %T", k)
+	}
+}
+
+// ThreatSpec TMv0.1 for SignJWS
+// Does JWS compact serialization signing for App:Crypto
+
+// SignJWS signs the payload as a JWS compact serialization using the private key. The alg header is set from the key
+// and overrides any alg in the given header.
+func SignJWS(header map[string]interface{}, payload []byte, privateKey crypto.PrivateKey) (string, error) {
+	alg, err := JWSAlgorithm(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	fullHeader := map[string]interface{}{"alg": alg}
+	for k, v := range header {
+		if k != "alg" {
+			fullHeader[k] = v
+		}
+	}
+	headerJson, err := json.Marshal(fullHeader)
+	if err != nil {
+		return "", fmt.Errorf("Could not marshal JWS header: %s", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJson) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch k := privateKey.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", fmt.Errorf("Could not RSA sign: %s", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return "", fmt.Errorf("Could not ECDSA sign: %s", err)
+		}
+		// JWS ECDSA signatures are the fixed size big-endian R and S concatenated
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// ThreatSpec TMv0.1 for VerifyJWS
+// Does JWS compact serialization verification for App:Crypto
+// Mitigates App:Crypto against algorithm substitution with alg header required to match the public key
+
+// VerifyJWS verifies a JWS compact serialization using the public key, returning its header and payload.
+// The alg header must be the algorithm for the public key, so "none" and HMAC algorithms are always rejected.
+// Any failure returns ErrInvalidJWS.
+func VerifyJWS(jws string, publicKey crypto.PublicKey) (map[string]interface{}, []byte, error) {
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 {
+		return nil, nil, fmt.Errorf("Expected 3 parts but got %d: %w", len(parts), ErrInvalidJWS)
+	}
+
+	headerJson, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not decode header: %s: %w", err, ErrInvalidJWS)
+	}
+	var header map[string]interface{}
+	if err := json.Unmarshal(headerJson, &header); err != nil {
+		return nil, nil, fmt.Errorf("Could not parse header: %s: %w", err, ErrInvalidJWS)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not decode payload: %s: %w", err, ErrInvalidJWS)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not decode signature: %s: %w", err, ErrInvalidJWS)
+	}
+
+	alg, err := JWSAlgorithm(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header["alg"] != alg {
+		return nil, nil, fmt.Errorf("Expected alg '%s' but got '%v': %w", alg, header["alg"], ErrInvalidJWS)
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, nil, fmt.Errorf("Could not verify signature: %s: %w", err, ErrInvalidJWS)
+		}
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 {
+			return nil, nil, fmt.Errorf("Expected signature of 64 bytes but got %d: %w", len(signature), ErrInvalidJWS)
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(k, digest[:], r, s) {
+			return nil, nil, fmt.Errorf("Could not verify signature: %w", ErrInvalidJWS)
+		}
+	}
+	return header, payload, nil
+}
@@ -0,0 +1,53 @@
+// ThreatSpec package github.com/pki-io/core/crypto as crypto
+package crypto
+
+import (
+	"time"
+)
+
+// Operation names reported to Metrics
+const (
+	OperationGenerateKeys = "generate-keys"
+	OperationSign         = "sign"
+	OperationVerify       = "verify"
+	OperationEncrypt      = "encrypt"
+	OperationDecrypt      = "decrypt"
+)
+
+// Metrics receives the duration of expensive crypto operations.
+type Metrics interface {
+	Observe(operation string, duration time.Duration)
+}
+
+// MetricsFunc is an adapter to allow the use of an ordinary function as Metrics.
+type MetricsFunc func(operation string, duration time.Duration)
+
+// Observe calls f(operation, duration).
+func (f MetricsFunc) Observe(operation string, duration time.Duration) {
+	f(operation, duration)
+}
+
+var metrics Metrics
+
+// SetMetrics sets the Metrics that operation durations are reported to. A nil Metrics disables reporting.
+// It should be set during initialisation, before any operations take place.
+func SetMetrics(m Metrics) {
+	metrics = m
+}
+
+// StartTimer returns the start time of an operation to be passed to Observe.
+// If no Metrics is set, the clock isn't read and the zero time is returned.
+func StartTimer() time.Time {
+	if metrics == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// Observe reports the time elapsed since start for the operation to the Metrics set with SetMetrics, if any.
+func Observe(operation string, start time.Time) {
+	if metrics == nil || start.IsZero() {
+		return
+	}
+	metrics.Observe(operation, time.Since(start))
+}
@@ -0,0 +1,141 @@
+// ThreatSpec package github.com/pki-io/core/crypto as crypto
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownMode is returned when a signature mode isn't in the ModeRegistry.
+var ErrUnknownMode = errors.New("Unknown signature mode")
+
+// SignatureScheme implements a signature mode.
+type SignatureScheme struct {
+	// KeyType is the type of key that signs with the mode, or empty for MAC modes.
+	KeyType KeyType
+	// Strength is the strength of the mode, see ModeStrength.
+	Strength SignatureStrength
+	// Sign signs the message. The key is a crypto.PrivateKey for public key modes and a []byte for MAC modes.
+	Sign func(message []byte, key interface{}) ([]byte, error)
+	// Verify verifies the signature of the message. The key is a crypto.PublicKey for public key modes and a []byte for MAC modes.
+	Verify func(message, signature []byte, key interface{}) error
+}
+
+// IsPublicKey checks whether the scheme uses public key signatures rather than MACs.
+func (scheme *SignatureScheme) IsPublicKey() bool {
+	return len(scheme.KeyType) > 0
+}
+
+// ModeRegistry maps signature modes to their implementations. Sign, Verify and ModeStrength look modes up here,
+// so a mode only needs to be registered, with RegisterMode, to be supported everywhere.
+var ModeRegistry = map[Mode]*SignatureScheme{
+	SignatureModeSha256Rsa: {
+		KeyType:  KeyTypeRSA,
+		Strength: SignatureStrengthLegacy,
+		Sign: func(message []byte, key interface{}) ([]byte, error) {
+			k, ok := key.(*rsa.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("Expected RSA private key but got %T", key)
+			}
+			return rsaSign(message, k)
+		},
+		Verify: func(message, signature []byte, key interface{}) error {
+			k, ok := key.(*rsa.PublicKey)
+			if !ok {
+				return fmt.Errorf("Expected RSA public key but got %T", key)
+			}
+			return rsaVerify(message, signature, k)
+		},
+	},
+	SignatureModeSha256RsaPss: {
+		KeyType:  KeyTypeRSA,
+		Strength: SignatureStrengthStandard,
+		Sign: func(message []byte, key interface{}) ([]byte, error) {
+			k, ok := key.(*rsa.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("Expected RSA private key but got %T", key)
+			}
+			return rsaPSSSign(message, k)
+		},
+		Verify: func(message, signature []byte, key interface{}) error {
+			k, ok := key.(*rsa.PublicKey)
+			if !ok {
+				return fmt.Errorf("Expected RSA public key but got %T", key)
+			}
+			return rsaPSSVerify(message, signature, k)
+		},
+	},
+	SignatureModeSha256Ecdsa: {
+		KeyType:  KeyTypeEC,
+		Strength: SignatureStrengthStandard,
+		Sign: func(message []byte, key interface{}) ([]byte, error) {
+			k, ok := key.(*ecdsa.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("Expected ECDSA private key but got %T", key)
+			}
+			return ecdsaSign(message, k)
+		},
+		Verify: func(message, signature []byte, key interface{}) error {
+			k, ok := key.(*ecdsa.PublicKey)
+			if !ok {
+				return fmt.Errorf("Expected ECDSA public key but got %T", key)
+			}
+			return ecdsaVerify(message, signature, k)
+		},
+	},
+	SignatureModeSha256Hmac: {
+		Strength: SignatureStrengthStandard,
+		Sign: func(message []byte, key interface{}) ([]byte, error) {
+			k, ok := key.([]byte)
+			if !ok {
+				return nil, fmt.Errorf("Expected MAC key but got %T", key)
+			}
+			return hmac256(message, k)
+		},
+		Verify: func(message, signature []byte, key interface{}) error {
+			k, ok := key.([]byte)
+			if !ok {
+				return fmt.Errorf("Expected MAC key but got %T", key)
+			}
+			return HMACVerify(message, k, signature)
+		},
+	},
+}
+
+// defaultModes are the signature modes used for each key type when no mode is given.
+var defaultModes = map[KeyType]Mode{
+	KeyTypeRSA: SignatureModeSha256Rsa,
+	KeyTypeEC:  SignatureModeSha256Ecdsa,
+}
+
+// RegisterMode adds or replaces a signature mode in the ModeRegistry. It should be called during initialisation,
+// as the registry isn't safe for concurrent modification.
+func RegisterMode(mode Mode, scheme *SignatureScheme) {
+	ModeRegistry[mode] = scheme
+}
+
+// ThreatSpec TMv0.1 for LookupMode
+// Returns implementation of signature mode for App:Crypto
+
+// LookupMode returns the implementation of the signature mode, or ErrUnknownMode if it isn't registered.
+func LookupMode(mode Mode) (*SignatureScheme, error) {
+	scheme, ok := ModeRegistry[mode]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownMode, mode)
+	}
+	return scheme, nil
+}
+
+// ThreatSpec TMv0.1 for ModeForKeyType
+// Returns default signature mode for key type for App:Crypto
+
+// ModeForKeyType returns the signature mode used to sign with the given key type.
+func ModeForKeyType(keyType KeyType) (Mode, error) {
+	mode, ok := defaultModes[keyType]
+	if !ok {
+		return "", fmt.Errorf("Invalid key type: %s", keyType)
+	}
+	return mode, nil
+}
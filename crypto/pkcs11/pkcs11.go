@@ -0,0 +1,199 @@
+// ThreatSpec package github.com/pki-io/core/crypto/pkcs11 as pkcs11
+package pkcs11
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/miekg/pkcs11"
+	"github.com/pki-io/core/crypto"
+	"math/big"
+)
+
+// Config identifies a private key held on a PKCS#11 token.
+type Config struct {
+	Module string
+	Slot   uint
+	Pin    string
+	Label  string
+}
+
+// Signer is a crypto.Signer backed by a private key held on a PKCS#11 token. The private key never leaves the token.
+type Signer struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	key     pkcs11.ObjectHandle
+	keyType crypto.KeyType
+}
+
+// ThreatSpec TMv0.1 for New
+// Creates new PKCS#11 signer for App:Crypto
+// Mitigates App:Crypto against private key disclosure with signing performed on a PKCS#11 token
+
+// New loads the PKCS#11 module, logs in to the slot and finds the private key with the given label.
+// The returned Signer must be closed when no longer needed.
+func New(config *Config) (*Signer, error) {
+	ctx := pkcs11.New(config.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("Could not load PKCS#11 module: %s", config.Module)
+	}
+
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("Could not initialize PKCS#11 module: %s", err)
+	}
+
+	signer := &Signer{ctx: ctx}
+	if err := signer.open(config); err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return nil, err
+	}
+	return signer, nil
+}
+
+// open opens a session, logs in and finds the private key.
+func (signer *Signer) open(config *Config) error {
+	session, err := signer.ctx.OpenSession(config.Slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return fmt.Errorf("Could not open PKCS#11 session: %s", err)
+	}
+	signer.session = session
+
+	if err := signer.ctx.Login(session, pkcs11.CKU_USER, config.Pin); err != nil {
+		signer.ctx.CloseSession(session)
+		return fmt.Errorf("Could not login to PKCS#11 token: %s", err)
+	}
+
+	if err := signer.findKey(config.Label); err != nil {
+		signer.ctx.Logout(session)
+		signer.ctx.CloseSession(session)
+		return err
+	}
+	return nil
+}
+
+// findKey finds the private key with the given label and determines its type.
+func (signer *Signer) findKey(label string) error {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := signer.ctx.FindObjectsInit(signer.session, template); err != nil {
+		return fmt.Errorf("Could not search for private key: %s", err)
+	}
+	objects, _, err := signer.ctx.FindObjects(signer.session, 1)
+	signer.ctx.FindObjectsFinal(signer.session)
+	if err != nil {
+		return fmt.Errorf("Could not search for private key: %s", err)
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("Could not find private key with label '%s'", label)
+	}
+	signer.key = objects[0]
+
+	attributes, err := signer.ctx.GetAttributeValue(signer.session, signer.key, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil),
+	})
+	if err != nil {
+		return fmt.Errorf("Could not get private key type: %s", err)
+	}
+
+	switch keyType := attributes[0].Value; {
+	case bytes.Equal(keyType, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA).Value):
+		signer.keyType = crypto.KeyTypeRSA
+	case bytes.Equal(keyType, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC).Value):
+		signer.keyType = crypto.KeyTypeEC
+	default:
+		return errors.New("Unsupported private key type")
+	}
+	return nil
+}
+
+// KeyType returns the type of the private key on the token.
+func (signer *Signer) KeyType() crypto.KeyType {
+	return signer.keyType
+}
+
+// ThreatSpec TMv0.1 for Signer.Sign
+// Does message signing on a PKCS#11 token for App:Crypto
+
+// Sign signs the message on the token. The signature is compatible with signatures made by crypto.Sign,
+// so it can be verified with the public key stored in the entity. Only the default mode for the key type is supported.
+func (signer *Signer) Sign(message string, signature *crypto.Signed) error {
+	hash := sha256.Sum256([]byte(message))
+
+	var mechanism *pkcs11.Mechanism
+	var mode crypto.Mode
+	switch signer.keyType {
+	case crypto.KeyTypeRSA:
+		// crypto.Sign uses PKCS#1 v1.5 padding over the raw digest, without a DigestInfo prefix
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
+		mode = crypto.SignatureModeSha256Rsa
+	case crypto.KeyTypeEC:
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+		mode = crypto.SignatureModeSha256Ecdsa
+	default:
+		return fmt.Errorf("Invalid key type: %s", signer.keyType)
+	}
+	if len(signature.Mode) > 0 && signature.Mode != mode {
+		return fmt.Errorf("Signature mode '%s' isn't supported by PKCS#11 signer", signature.Mode)
+	}
+	signature.Mode = mode
+
+	if err := signer.ctx.SignInit(signer.session, []*pkcs11.Mechanism{mechanism}, signer.key); err != nil {
+		return fmt.Errorf("Could not initialise PKCS#11 signing: %s", err)
+	}
+	sig, err := signer.ctx.Sign(signer.session, hash[:])
+	if err != nil {
+		return fmt.Errorf("Could not PKCS#11 sign: %s", err)
+	}
+
+	if signer.keyType == crypto.KeyTypeEC {
+		if sig, err = encodeECDSASignature(sig); err != nil {
+			return err
+		}
+	}
+
+	signature.Message = message
+	signature.Signature = string(crypto.Base64Encode(sig))
+	return nil
+}
+
+// ThreatSpec TMv0.1 for Signer.Close
+// Does closing of PKCS#11 session for App:Crypto
+
+// Close logs out of the token and unloads the PKCS#11 module.
+func (signer *Signer) Close() error {
+	signer.ctx.Logout(signer.session)
+	err := signer.ctx.CloseSession(signer.session)
+	signer.ctx.Finalize()
+	signer.ctx.Destroy()
+	return err
+}
+
+// ecdsaCurves are the curves of PKCS#11 ECDSA signatures by length, as r and s are each padded to the size of the curve order.
+var ecdsaCurves = map[int]elliptic.Curve{
+	64:  elliptic.P256(),
+	96:  elliptic.P384(),
+	132: elliptic.P521(),
+}
+
+// encodeECDSASignature converts a PKCS#11 ECDSA signature (r and s concatenated) to the format produced by crypto.Sign.
+// Tokens don't normalise S, so it is normalised with crypto.NormaliseLowS, like signatures made by crypto.Sign.
+func encodeECDSASignature(sig []byte) ([]byte, error) {
+	curve, ok := ecdsaCurves[len(sig)]
+	if !ok {
+		return nil, fmt.Errorf("Invalid ECDSA signature length: %d", len(sig))
+	}
+	r := new(big.Int).SetBytes(sig[:len(sig)/2]).Bytes()
+	s := crypto.NormaliseLowS(new(big.Int).SetBytes(sig[len(sig)/2:]), curve).Bytes()
+
+	buf := new(bytes.Buffer)
+	buf.WriteByte(byte(len(r)))
+	buf.Write(r)
+	buf.Write(s)
+	return buf.Bytes(), nil
+}
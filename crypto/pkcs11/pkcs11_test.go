@@ -0,0 +1,64 @@
+package pkcs11
+
+import (
+	"crypto/elliptic"
+	"github.com/pki-io/core/crypto"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"testing"
+)
+
+func TestEncodeECDSASignature(t *testing.T) {
+	raw := make([]byte, 64)
+	raw[0] = 0
+	raw[1] = 1
+	raw[63] = 2
+	sig, err := encodeECDSASignature(raw)
+	assert.NoError(t, err)
+	l := int(sig[0])
+	assert.Equal(t, new(big.Int).SetBytes(sig[1:l+1]), new(big.Int).SetBytes(raw[:32]))
+	assert.Equal(t, new(big.Int).SetBytes(sig[l+1:]), new(big.Int).SetBytes(raw[32:]))
+
+	_, err = encodeECDSASignature(raw[:63])
+	assert.Error(t, err)
+}
+
+func TestEncodeECDSASignatureLowS(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		size := (curve.Params().N.BitLen() + 7) / 8
+		halfOrder := new(big.Int).Rsh(curve.Params().N, 1)
+		highS := new(big.Int).Sub(curve.Params().N, big.NewInt(1))
+		raw := make([]byte, 2*size)
+		raw[size-1] = 1
+		highS.FillBytes(raw[size:])
+
+		sig, err := encodeECDSASignature(raw)
+		assert.NoError(t, err)
+		l := int(sig[0])
+		s := new(big.Int).SetBytes(sig[l+1:])
+		assert.True(t, s.Cmp(halfOrder) <= 0)
+		assert.Equal(t, s, big.NewInt(1))
+	}
+}
+
+// TestSign requires a PKCS#11 token, such as SoftHSM, configured through the environment.
+func TestSign(t *testing.T) {
+	module := os.Getenv("PKCS11_MODULE")
+	if module == "" {
+		t.Skip("PKCS11_MODULE not set")
+	}
+
+	signer, err := New(&Config{
+		Module: module,
+		Pin:    os.Getenv("PKCS11_PIN"),
+		Label:  os.Getenv("PKCS11_LABEL"),
+	})
+	assert.NoError(t, err)
+	defer signer.Close()
+
+	sig := new(crypto.Signed)
+	err = signer.Sign("this is a message", sig)
+	assert.NoError(t, err)
+	assert.NotEqual(t, len(sig.Signature), 0)
+}
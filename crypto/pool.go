@@ -0,0 +1,55 @@
+// ThreatSpec package github.com/pki-io/core/crypto as crypto
+package crypto
+
+import (
+	"encoding/base64"
+	"sync"
+)
+
+// maxPooledBufferSize is the largest buffer kept in the pool, so that one large payload doesn't pin memory.
+const maxPooledBufferSize int = 64 * 1024
+
+// bufferPool holds buffers reused for intermediate plaintext and ciphertext when encrypting and decrypting payloads.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
+// getBuffer returns a buffer of the given length from the pool. It must be returned with putBuffer.
+func getBuffer(size int) *[]byte {
+	buffer := bufferPool.Get().(*[]byte)
+	if cap(*buffer) < size {
+		*buffer = make([]byte, size)
+	}
+	*buffer = (*buffer)[:size]
+	return buffer
+}
+
+// ThreatSpec TMv0.1 for putBuffer
+// Mitigates App:Crypto against plaintext disclosure through pooled memory with buffers zeroed before reuse
+
+// putBuffer zeroes the buffer and returns it to the pool, so that no plaintext is left in pooled memory.
+func putBuffer(buffer *[]byte) {
+	b := (*buffer)[:cap(*buffer)]
+	for i := range b {
+		b[i] = 0
+	}
+	if cap(b) > maxPooledBufferSize {
+		return
+	}
+	*buffer = b[:0]
+	bufferPool.Put(buffer)
+}
+
+// decodeBuffer base64 decodes the input into a buffer from the pool. It must be returned with putBuffer.
+func decodeBuffer(input string) (*[]byte, error) {
+	buffer := getBuffer(base64.StdEncoding.DecodedLen(len(input)))
+	n, err := base64.StdEncoding.Decode(*buffer, []byte(input))
+	if err != nil {
+		putBuffer(buffer)
+		return nil, err
+	}
+	*buffer = (*buffer)[:n]
+	return buffer, nil
+}
@@ -0,0 +1,150 @@
+// ThreatSpec package github.com/pki-io/core/crypto as crypto
+package crypto
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+)
+
+// Recipient is a recipient of a hybrid encrypted data key, such as a PublicKeyRecipient.
+type Recipient interface {
+	// RecipientId returns the id the wrapped key is recorded under.
+	RecipientId() string
+	// wrapKey wraps the data key, returning the base64 encoded wrapped key and the key wrap algorithm.
+	wrapKey(key []byte) (string, string, error)
+	// validate checks that a key can be wrapped for the recipient, without wrapping one.
+	validate() error
+}
+
+// PublicKeyRecipient is a recipient holding a key pair. The data key is wrapped with the PEM encoded RSA or EC public key.
+type PublicKeyRecipient struct {
+	Id        string
+	PublicKey string
+}
+
+// RecipientId returns the recipient's id.
+func (recipient PublicKeyRecipient) RecipientId() string {
+	return recipient.Id
+}
+
+func (recipient PublicKeyRecipient) wrapKey(key []byte) (string, string, error) {
+	publicKey, algorithm, err := recipient.publicKey()
+	if err != nil {
+		return "", "", err
+	}
+	encryptedKey, err := Encrypt(key, publicKey)
+	if err != nil {
+		return "", "", err
+	}
+	return string(Base64Encode(encryptedKey)), algorithm, nil
+}
+
+func (recipient PublicKeyRecipient) validate() error {
+	_, _, err := recipient.publicKey()
+	return err
+}
+
+// publicKey returns the decoded public key and its key wrap algorithm.
+func (recipient PublicKeyRecipient) publicKey() (crypto.PublicKey, string, error) {
+	publicKey, err := PemDecodePublic([]byte(recipient.PublicKey))
+	if err != nil {
+		return nil, "", err
+	}
+	algorithm, err := keyWrapAlgorithm(publicKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return publicKey, algorithm, nil
+}
+
+// PSKRecipient is a recipient holding a symmetric pre-shared key, such as a service. The data key is wrapped with
+// AES key wrap under the key, which must be 16, 24 or 32 bytes. GroupDecryptWithPSK or a PSKDecrypter unwraps it.
+type PSKRecipient struct {
+	Id  string
+	Key []byte
+}
+
+// RecipientId returns the recipient's id.
+func (recipient PSKRecipient) RecipientId() string {
+	return recipient.Id
+}
+
+func (recipient PSKRecipient) wrapKey(key []byte) (string, string, error) {
+	wrapped, err := AESKeyWrap(recipient.Key, key)
+	if err != nil {
+		return "", "", err
+	}
+	return string(Base64Encode(wrapped)), KeyWrapAesKw, nil
+}
+
+func (recipient PSKRecipient) validate() error {
+	switch len(recipient.Key) {
+	case 16, 24, 32:
+		return nil
+	default:
+		return fmt.Errorf("Pre-shared key is %d bytes, not 16, 24 or 32", len(recipient.Key))
+	}
+}
+
+// PublicKeyRecipients returns a PublicKeyRecipient for each of the PEM encoded public keys, by id.
+func PublicKeyRecipients(publicKeys map[string]string) []Recipient {
+	recipients := make([]Recipient, 0, len(publicKeys))
+	for id, publicKey := range publicKeys {
+		recipients = append(recipients, PublicKeyRecipient{Id: id, PublicKey: publicKey})
+	}
+	return recipients
+}
+
+// sealed is the serialized form of a ciphertext from Seal.
+type sealed struct {
+	Mode          string            `json:"mode"`
+	Inputs        map[string]string `json:"inputs"`
+	Keys          map[string]string `json:"keys"`
+	KeyAlgorithms map[string]string `json:"key-algorithms"`
+	Ciphertext    string            `json:"ciphertext"`
+}
+
+// ThreatSpec TMv0.1 for Seal
+// Does hybrid authenticated encryption of bytes for App:Crypto
+// Mitigates App:Crypto against ciphertext tampering with AES in GCM mode
+
+// Seal encrypts the plaintext with a random data key using AES in GCM mode and wraps the data key for each recipient,
+// returning the sealed bytes. It uses the same encryption and key wrapping as GroupEncryptWithAAD, independently of
+// the document and container formats, so that other formats can be built on it. Open reverses it.
+func Seal(plaintext []byte, recipients []Recipient) ([]byte, error) {
+	encrypted, err := groupEncryptWithAAD(plaintext, recipients, "")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(sealed{
+		Mode:          encrypted.Mode,
+		Inputs:        encrypted.Inputs,
+		Keys:          encrypted.Keys,
+		KeyAlgorithms: encrypted.KeyAlgorithms,
+		Ciphertext:    encrypted.Ciphertext,
+	})
+}
+
+// ThreatSpec TMv0.1 for Open
+// Does hybrid decryption of bytes with a private key for App:Crypto
+
+// Open decrypts bytes sealed by Seal for the recipient id, using its PEM encoded private key.
+// It returns the same errors as GroupDecrypt for each stage of decryption.
+func Open(sealedBytes []byte, id string, privateKeyPem string) ([]byte, error) {
+	var s sealed
+	if err := json.Unmarshal(sealedBytes, &s); err != nil {
+		return nil, fmt.Errorf("Could not decode sealed bytes: %s", err)
+	}
+	plaintext, err := GroupDecrypt(&Encrypted{
+		Ciphertext:    s.Ciphertext,
+		Mode:          s.Mode,
+		Inputs:        s.Inputs,
+		Keys:          s.Keys,
+		KeyAlgorithms: s.KeyAlgorithms,
+	}, id, privateKeyPem)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(plaintext), nil
+}
@@ -2,8 +2,105 @@
 package document
 
 import (
+	gocrypto "crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/pki-io/core/crypto"
+	"strings"
+)
+
+// MaxDecryptedSize is the maximum size in bytes of plaintext that Decrypt will produce.
+// Containers whose ciphertext could decrypt to more than this are rejected before any decryption is done.
+var MaxDecryptedSize = 64 * 1024 * 1024
+
+// ErrSizeLimitExceeded is returned when a container's content exceeds MaxDecryptedSize.
+var ErrSizeLimitExceeded = errors.New("Container size limit exceeded")
+
+// MaxRecipients is the maximum number of recipients a container may have.
+var MaxRecipients = 1024
+
+// MaxContainerSize is the maximum size in bytes of a serialized container.
+var MaxContainerSize = 96 * 1024 * 1024
+
+// ErrVerificationFailed is returned when a container signature does not verify, or an authenticated ciphertext has been
+// modified. It signals a possible forgery, unlike ErrMalformedContainer.
+var ErrVerificationFailed = errors.New("Signature verification failed")
+
+// ErrMalformedContainer is returned when a container can't be verified or decrypted because it is incomplete or can't be
+// decoded, such as a truncated ciphertext. It signals an operational problem, unlike ErrVerificationFailed.
+var ErrMalformedContainer = errors.New("Malformed container")
+
+// WireVersion is the newest container format version this package produces and reads. Containers record the version
+// they were produced with in their version field.
+const WireVersion int = 1
+
+// MinWireVersion is the oldest container format version this package reads.
+const MinWireVersion int = 1
+
+var (
+	// ErrUnsupportedWireVersion is returned when a container has a format version outside MinWireVersion to WireVersion.
+	ErrUnsupportedWireVersion = errors.New("Unsupported container version")
+	// ErrNoCommonVersion is returned by NegotiateVersion when the peer supports no version this package does.
+	ErrNoCommonVersion = errors.New("No common container version")
+)
+
+// ThreatSpec TMv0.1 for NegotiateVersion
+// Does container format version negotiation for App:Document
+
+// NegotiateVersion returns the highest container format version supported by both this package and a peer whose
+// newest supported version is peer. It returns ErrNoCommonVersion if the peer's newest version is older than MinWireVersion.
+func NegotiateVersion(peer int) (int, error) {
+	if peer < MinWireVersion {
+		return 0, fmt.Errorf("Peer version %d is older than %d: %w", peer, MinWireVersion, ErrNoCommonVersion)
+	}
+	if peer < WireVersion {
+		return peer, nil
+	}
+	return WireVersion, nil
+}
+
+// Signature versions select the rules for the message covered by a Container signature, see Container.SignatureMessage.
+const (
+	// SignatureVersion0 signs the dumped Container without its signature and counter-signatures.
+	// Containers without a signature version, including all those signed before versions were introduced, use it.
+	SignatureVersion0 int = 0
+	// SignatureVersionSignedFields signs the canonical JSON of the fields listed in the signed-fields option, see SetSignedFields.
+	SignatureVersionSignedFields int = 1
+	// CurrentSignatureVersion is the signature version used for new signatures without signed fields.
+	CurrentSignatureVersion = SignatureVersion0
+)
+
+// ErrUnsupportedSignatureVersion is returned when a container's signature version isn't known.
+var ErrUnsupportedSignatureVersion = errors.New("Unsupported signature version")
+
+// Signature encodings select how the Container signature is stored in the signature option, see SetSignatureEncoding.
+const (
+	// SignatureEncodingBase64 stores the signature base64 encoded. Containers without a signature encoding use it.
+	SignatureEncodingBase64 = "base64"
+	// SignatureEncodingHex stores the signature hex encoded, for consumers that expect hex.
+	SignatureEncodingHex = "hex"
+)
+
+// ErrUnsupportedSignatureEncoding is returned when a container's signature encoding isn't known.
+var ErrUnsupportedSignatureEncoding = errors.New("Unsupported signature encoding")
+
+var (
+	// ErrTooManyRecipients is returned when a container has more than MaxRecipients recipients.
+	ErrTooManyRecipients = errors.New("Too many recipients")
+	// ErrContainerTooLarge is returned when a container is larger than MaxContainerSize bytes.
+	ErrContainerTooLarge = errors.New("Container too large")
+	// ErrEncryptedOptionsUnavailable is returned when encrypted options are read before the container is decrypted,
+	// or set after it is encrypted.
+	ErrEncryptedOptionsUnavailable = errors.New("Encrypted options not available")
+	// ErrAlreadySigned is returned when a signed container is encrypted, which would replace the signed body.
+	// Containers should be encrypted and then signed, so that the signature covers the ciphertext.
+	ErrAlreadySigned = errors.New("Container is already signed")
+	// ErrContentDigestMismatch is returned when a ciphertext attached to a container doesn't match its content digest.
+	ErrContentDigestMismatch = errors.New("Content digest doesn't match")
 )
 
 // ContainerDefault sets default values for a Container.
@@ -66,10 +163,32 @@ const ContainerSchema string = `{
                   "description": "Base64 encoded signature",
                   "type": "string"
               },
+              "signature-version": {
+                  "description": "Version of the rules for the message covered by the signature",
+                  "type": "integer"
+              },
+              "signature-encoding": {
+                  "description": "Encoding of the signature, base64 if not set",
+                  "type": "string"
+              },
+              "signed-fields": {
+                  "description": "Fields covered by the signature",
+                  "type": "array",
+                  "items": {
+                      "type": "string"
+                  }
+              },
               "encryption-keys": {
                   "description": "Encryption keys",
                   "type": "object"
               },
+              "encryption-key-algorithms": {
+                  "description": "Key wrap algorithms by recipient",
+                  "type": "object",
+                  "additionalProperties": {
+                      "type": "string"
+                  }
+              },
               "encryption-mode": {
                   "description": "Encryption mode",
                   "type": "string"
@@ -77,6 +196,70 @@ const ContainerSchema string = `{
               "encryption-inputs": {
                   "description": "Encryption inputs",
                   "type": "object"
+              },
+              "encrypted-options": {
+                  "description": "Base64 encoded options encrypted with the body data key using AES-GCM",
+                  "type": "string"
+              },
+              "encrypted-options-inputs": {
+                  "description": "Encrypted options inputs",
+                  "type": "object"
+              },
+              "headers": {
+                  "description": "Application headers",
+                  "type": "object",
+                  "additionalProperties": {
+                      "type": "string"
+                  }
+              },
+              "claims": {
+                  "description": "Signed claims",
+                  "type": "object",
+                  "additionalProperties": {
+                      "type": "string"
+                  }
+              },
+              "content-digest": {
+                  "description": "Hex encoded tagged SHA-256 digest of the body",
+                  "type": "string"
+              },
+              "not-before": {
+                  "description": "Unix time from which the container is valid",
+                  "type": "integer"
+              },
+              "not-after": {
+                  "description": "Unix time until which the container is valid",
+                  "type": "integer"
+              },
+              "references": {
+                  "description": "Hex encoded tagged SHA-256 digests of referenced containers",
+                  "type": "array",
+                  "items": {
+                      "type": "string"
+                  }
+              },
+              "counter-signatures": {
+                  "description": "Counter-signatures over the signed container",
+                  "type": "array",
+                  "items": {
+                      "type": "object",
+                      "required": ["signer","mode","signature"],
+                      "additionalProperties": false,
+                      "properties": {
+                          "signer": {
+                              "description": "Signer ID",
+                              "type": "string"
+                          },
+                          "mode": {
+                              "description": "Signature mode",
+                              "type": "string"
+                          },
+                          "signature": {
+                              "description": "Base64 encoded signature",
+                              "type": "string"
+                          }
+                      }
+                  }
               }
           }
       },
@@ -93,21 +276,52 @@ type ContainerData struct {
 	Version int    `json:"version"`
 	Type    string `json:"type"`
 	Options struct {
-		Source           string            `json:"source"`
-		SignatureMode    string            `json:"signature-mode"`
-		SignatureInputs  map[string]string `json:"signature-inputs"`
-		Signature        string            `json:"signature"`
-		EncryptionKeys   map[string]string `json:"encryption-keys"`
-		EncryptionMode   string            `json:"encryption-mode"`
-		EncryptionInputs map[string]string `json:"encryption-inputs"`
+		Source                  string             `json:"source"`
+		SignatureMode           string             `json:"signature-mode"`
+		SignatureInputs         map[string]string  `json:"signature-inputs"`
+		Signature               string             `json:"signature"`
+		SignatureVersion        int                `json:"signature-version,omitempty"`
+		SignatureEncoding       string             `json:"signature-encoding,omitempty"`
+		SignedFields            []string           `json:"signed-fields,omitempty"`
+		EncryptionKeys          map[string]string  `json:"encryption-keys"`
+		EncryptionKeyAlgorithms map[string]string  `json:"encryption-key-algorithms,omitempty"`
+		EncryptionMode          string             `json:"encryption-mode"`
+		EncryptionInputs        map[string]string  `json:"encryption-inputs"`
+		EncryptedOptions        string             `json:"encrypted-options,omitempty"`
+		EncryptedOptionsInputs  map[string]string  `json:"encrypted-options-inputs,omitempty"`
+		Headers                 map[string]string  `json:"headers,omitempty"`
+		Claims                  map[string]string  `json:"claims,omitempty"`
+		ContentDigest           string             `json:"content-digest,omitempty"`
+		NotBefore               int64              `json:"not-before,omitempty"`
+		NotAfter                int64              `json:"not-after,omitempty"`
+		References              []string           `json:"references,omitempty"`
+		CounterSignatures       []CounterSignature `json:"counter-signatures,omitempty"`
 	} `json:"options"`
 	Body string `json:"body"`
 }
 
+// CounterSignature is an additional signature over a signed Container, see Container.CounterSignatureMessage.
+type CounterSignature struct {
+	Signer    string `json:"signer"`
+	Mode      string `json:"mode"`
+	Signature string `json:"signature"`
+}
+
+// SignatureEntry is a signature on a Container with the signer and mode it was made with, see Container.Signatures.
+type SignatureEntry struct {
+	Signer    string
+	Mode      string
+	Signature string
+	// Counter is whether the entry is a counter-signature rather than the Container signature.
+	Counter bool
+}
+
 // Container is a cryptographic document that can be signed and/or encrypted.
 type Container struct {
 	Document
 	Data ContainerData
+	// encryptedOptions are the plaintext encrypted options, set before encryption or by decryption.
+	encryptedOptions map[string]string
 }
 
 // ThreatSpec TMv0.1 for NewContainer
@@ -115,6 +329,21 @@ type Container struct {
 
 // NewContainer creates a new Container.
 func NewContainer(jsonData interface{}) (*Container, error) {
+	switch t := jsonData.(type) {
+	case string:
+		if len(t) > MaxContainerSize {
+			return nil, ErrContainerTooLarge
+		}
+	case []byte:
+		if len(t) > MaxContainerSize {
+			return nil, ErrContainerTooLarge
+		}
+	case json.RawMessage:
+		if len(t) > MaxContainerSize {
+			return nil, ErrContainerTooLarge
+		}
+	}
+
 	doc := new(Container)
 	data := new(ContainerData)
 	doc.Schema = ContainerSchema
@@ -123,16 +352,37 @@ func NewContainer(jsonData interface{}) (*Container, error) {
 		return nil, fmt.Errorf("Could not load container json: %s", err)
 	} else {
 		doc.Data = *data.(*ContainerData)
+		if doc.Data.Version < MinWireVersion || doc.Data.Version > WireVersion {
+			return nil, fmt.Errorf("Container version %d: %w", doc.Data.Version, ErrUnsupportedWireVersion)
+		}
+		if err := doc.checkLimits(); err != nil {
+			return nil, err
+		}
 		return doc, nil
 	}
 }
 
+// ThreatSpec TMv0.1 for Container.FormatVersion
+// Returns container format version for App:Document
+
+// FormatVersion returns the container format version recorded in the version field, see WireVersion.
+// Every Container has one, as the field is required by ContainerSchema and written by Dump, and NewContainer rejects
+// versions outside MinWireVersion to WireVersion, so it can be used to pick the parser when the format changes.
+func (doc *Container) FormatVersion() int {
+	return doc.Data.Version
+}
+
 // ThreatSpec TMv0.1 for Container.Dump
 // Does container dumping for App:Document
 
-// Dump serializes the Container to JSON.
+// Dump serializes the Container to JSON, including the format version, see FormatVersion.
 func (doc *Container) Dump() string {
-	if jsonString, err := doc.ToJson(doc.Data); err != nil {
+	return doc.dumpData(doc.Data)
+}
+
+// dumpData serializes the given data, such as a modified copy of the Container data, to JSON.
+func (doc *Container) dumpData(data ContainerData) string {
+	if jsonString, err := doc.ToJson(data); err != nil {
 		return ""
 	} else {
 		return jsonString
@@ -143,13 +393,121 @@ func (doc *Container) Dump() string {
 // Does container hybdrid encryption for App:Document
 
 // Encrypt takes a plaintext string and group encrypts for the given public keys and updates its data to the ciphertext and inputs.
+// Encrypting replaces the body, so a signed Container returns ErrAlreadySigned; sign after encrypting instead.
+// Any encrypted options are encrypted with the same data key.
+// Recipients are serialized sorted by id, so the same recipient set always gives the same ordering.
+// Decryption doesn't depend on the ordering.
 func (doc *Container) Encrypt(jsonString string, keys map[string]string) error {
-	encrypted, err := crypto.GroupEncrypt(jsonString, keys)
+	_, err := doc.EncryptForEscrow(jsonString, keys)
+	return err
+}
+
+// ThreatSpec TMv0.1 for Container.EncryptForEscrow
+// Does container hybrid encryption returning the data key for escrow for App:Document
+
+// EncryptForEscrow is like Encrypt, but also returns the raw data key so that it can be escrowed with a separate custodian.
+// The data key isn't stored in the Container. Anyone with it can decrypt the Container using DecryptWithDataKey,
+// so it must be protected at least as well as the recipients' private keys.
+func (doc *Container) EncryptForEscrow(jsonString string, keys map[string]string) ([]byte, error) {
+	return doc.EncryptForRecipients(jsonString, crypto.PublicKeyRecipients(keys))
+}
+
+// ThreatSpec TMv0.1 for Container.EncryptForRecipients
+// Does container hybrid encryption for recipients for App:Document
+
+// EncryptForRecipients is like EncryptForEscrow, but takes recipients, which may have different key types.
+func (doc *Container) EncryptForRecipients(jsonString string, recipients []crypto.Recipient) ([]byte, error) {
+	if doc.IsSigned() {
+		return nil, ErrAlreadySigned
+	}
+
+	encrypted, dataKey, err := crypto.GroupEncryptForRecipients(jsonString, recipients)
 	if err != nil {
-		return fmt.Errorf("Could not group encrypt: %s", err)
+		return nil, fmt.Errorf("Couldn't group encrypt content: %w", err)
+	}
+
+	if err := doc.encryptOptions(dataKey, encrypted); err != nil {
+		return nil, err
 	}
 
 	doc.Data.Options.EncryptionKeys = encrypted.Keys
+	doc.Data.Options.EncryptionKeyAlgorithms = encrypted.KeyAlgorithms
+	doc.Data.Options.EncryptionMode = encrypted.Mode
+	doc.Data.Options.EncryptionInputs = encrypted.Inputs
+	doc.Data.Body = encrypted.Ciphertext
+
+	return dataKey, nil
+}
+
+// ThreatSpec TMv0.1 for Container.DecryptWithDataKey
+// Does container decryption with an escrowed data key for App:Document
+
+// DecryptWithDataKey decrypts the Container body using the raw data key returned by EncryptForEscrow, returning a plaintext string.
+func (doc *Container) DecryptWithDataKey(dataKey []byte) (string, error) {
+	if err := doc.checkDecryptedSize(); err != nil {
+		return "", err
+	}
+
+	if err := doc.checkCiphertext(doc.Encrypted()); err != nil {
+		return "", err
+	}
+
+	return doc.decryptWithDataKey(dataKey)
+}
+
+// decryptWithDataKey decrypts the Container body and any encrypted options with the unwrapped data key.
+func (doc *Container) decryptWithDataKey(dataKey []byte) (string, error) {
+	decryptedJson, err := crypto.DecryptWithDataKey(doc.Encrypted(), dataKey)
+	if err != nil {
+		return "", decryptError(err)
+	}
+
+	if err := doc.decryptOptions(dataKey); err != nil {
+		return "", err
+	}
+	return decryptedJson, nil
+}
+
+// checkCiphertext returns ErrMalformedContainer if the ciphertext is truncated or its nonce is invalid.
+func (doc *Container) checkCiphertext(encrypted *crypto.Encrypted) error {
+	if err := crypto.CheckCiphertextLength(encrypted); err != nil {
+		return fmt.Errorf("%w: %w", err, ErrMalformedContainer)
+	}
+	if err := crypto.CheckNonce(encrypted); err != nil {
+		return fmt.Errorf("%w: %w", err, ErrMalformedContainer)
+	}
+	return nil
+}
+
+// decryptError wraps a decryption error, adding ErrVerificationFailed if the ciphertext failed authentication.
+func decryptError(err error) error {
+	if errors.Is(err, crypto.ErrAuthenticationFailed) {
+		return fmt.Errorf("Could not decrypt container: %w: %w", err, ErrVerificationFailed)
+	}
+	return fmt.Errorf("Could not decrypt container: %w", err)
+}
+
+// ThreatSpec TMv0.1 for Container.EncryptWithAAD
+// Does container hybrid authenticated encryption for App:Document
+
+// EncryptWithAAD takes a plaintext string and group encrypts for the given public keys using an authenticated cipher,
+// binding the additional data to the ciphertext. The additional data is recorded in the encryption inputs so that Decrypt
+// can supply it automatically.
+func (doc *Container) EncryptWithAAD(jsonString string, keys map[string]string, additionalData string) error {
+	if doc.IsSigned() {
+		return ErrAlreadySigned
+	}
+	if len(doc.encryptedOptions) > 0 {
+		return fmt.Errorf("Encrypted options can't be used with additional data")
+	}
+
+	encrypted, err := crypto.GroupEncryptWithAAD(jsonString, keys, additionalData)
+	if err != nil {
+		return fmt.Errorf("Could not group encrypt: %w", err)
+	}
+
+	doc.Data.Options.EncryptionKeys = encrypted.Keys
+	doc.Data.Options.EncryptionKeyAlgorithms = encrypted.KeyAlgorithms
 	doc.Data.Options.EncryptionMode = encrypted.Mode
 	doc.Data.Options.EncryptionInputs = encrypted.Inputs
 	doc.Data.Body = encrypted.Ciphertext
@@ -162,6 +520,13 @@ func (doc *Container) Encrypt(jsonString string, keys map[string]string) error {
 
 // SymmetricEncrypt takes a plaintext string and encrypts with the given key. It updates its data to the ciphertext and inputs.
 func (doc *Container) SymmetricEncrypt(jsonString, id, key string) error {
+	if doc.IsSigned() {
+		return ErrAlreadySigned
+	}
+	if len(doc.encryptedOptions) > 0 {
+		return fmt.Errorf("Encrypted options can't be used with symmetric encryption")
+	}
+
 	encrypted, err := crypto.SymmetricEncrypt(jsonString, id, key)
 	if err != nil {
 		return fmt.Errorf("Couldn't symmetric encrypt content: %s", err)
@@ -179,17 +544,157 @@ func (doc *Container) SymmetricEncrypt(jsonString, id, key string) error {
 
 // Decrypt takes a private key and decrypts the Container body, return a plaintext string.
 func (doc *Container) Decrypt(id string, privateKey string) (string, error) {
+	return doc.DecryptWith(id, crypto.NewPemDecrypter(privateKey))
+}
+
+// ThreatSpec TMv0.1 for Container.DecryptWith
+// Does hybdrid decryption of container with a decryption backend for App:Document
+
+// DecryptWith decrypts the Container body using the given decrypter, returning a plaintext string.
+//
+// The cause of a failure can be found with errors.Is: crypto.ErrNotARecipient if id isn't a recipient,
+// crypto.ErrWrappedKeyUnwrapFailed if the key wrapped for id can't be decrypted, and crypto.ErrPayloadAuthFailed if the body can't be decrypted.
+// A body that fails authentication has been modified, so is also ErrVerificationFailed, and a truncated ciphertext
+// or invalid nonce is also ErrMalformedContainer.
+func (doc *Container) DecryptWith(id string, decrypter crypto.Decrypter) (string, error) {
+	if err := doc.checkLimits(); err != nil {
+		return "", err
+	}
+
+	if err := doc.checkDecryptedSize(); err != nil {
+		return "", err
+	}
+
+	if err := doc.checkCiphertext(doc.Encrypted()); err != nil {
+		return "", err
+	}
+
+	// The data key is unwrapped once and shared by the body and encrypted options. The decrypter returns
+	// crypto.ErrNotARecipient if id isn't a recipient, after the same work as for a recipient.
+	dataKey, err := decrypter.UnwrapKey(doc.Encrypted(), id)
+	if err != nil {
+		return "", decryptError(err)
+	}
+	defer clear(dataKey)
+
+	return doc.decryptWithDataKey(dataKey)
+}
+
+// ThreatSpec TMv0.1 for Container.SetEncryptedOption
+// Does setting of encrypted option for App:Document
+// Mitigates App:Document against metadata disclosure with options encrypted with the body data key
+
+// SetEncryptedOption sets an option that is encrypted with the same data key as the body by Encrypt, for metadata such as
+// recipient names that shouldn't be readable without decrypting. Options needed for routing should be headers instead.
+// The options are encrypted with AES in GCM mode, bound to the encrypted body, so they can't be modified or moved to
+// another Container without decryption failing with ErrVerificationFailed.
+// Encrypted options must be set before the Container is encrypted, otherwise ErrEncryptedOptionsUnavailable is returned.
+func (doc *Container) SetEncryptedOption(key, value string) error {
+	if doc.IsEncrypted() {
+		return ErrEncryptedOptionsUnavailable
+	}
+	if doc.encryptedOptions == nil {
+		doc.encryptedOptions = make(map[string]string)
+	}
+	doc.encryptedOptions[key] = value
+	return nil
+}
+
+// ThreatSpec TMv0.1 for Container.GetEncryptedOption
+// Does getting of encrypted option for App:Document
+
+// GetEncryptedOption returns an encrypted option, or an empty string if it isn't set. If the Container has encrypted options
+// that haven't been decrypted by DecryptWith, Decrypt or DecryptWithDataKey, ErrEncryptedOptionsUnavailable is returned.
+func (doc *Container) GetEncryptedOption(key string) (string, error) {
+	if doc.encryptedOptions == nil && len(doc.Data.Options.EncryptedOptions) > 0 {
+		return "", ErrEncryptedOptionsUnavailable
+	}
+	return doc.encryptedOptions[key], nil
+}
+
+// encryptOptions encrypts the encrypted options with the body data key using AES in GCM mode, clearing any previous
+// encrypted options if there are none. The options are bound to the encrypted body, see optionsAdditionalData.
+func (doc *Container) encryptOptions(dataKey []byte, body *crypto.Encrypted) error {
+	doc.Data.Options.EncryptedOptions = ""
+	doc.Data.Options.EncryptedOptionsInputs = nil
+	if len(doc.encryptedOptions) == 0 {
+		return nil
+	}
+
+	optionsJson, err := json.Marshal(doc.encryptedOptions)
+	if err != nil {
+		return fmt.Errorf("Could not marshal encrypted options: %s", err)
+	}
+	ciphertext, nonce, err := crypto.AESGCMEncrypt(optionsJson, dataKey, optionsAdditionalData(body))
+	if err != nil {
+		return fmt.Errorf("Could not encrypt options: %s", err)
+	}
+	doc.Data.Options.EncryptedOptions = string(crypto.Base64Encode(ciphertext))
+	doc.Data.Options.EncryptedOptionsInputs = map[string]string{"nonce": string(crypto.Base64Encode(nonce))}
+	return nil
+}
+
+// ThreatSpec TMv0.1 for optionsAdditionalData
+// Mitigates App:Document against swapping encrypted options between containers with options bound to the body IV or nonce
+
+// optionsAdditionalData returns the additional data authenticated with the encrypted options. Containers have no id, so
+// the options are bound to the encrypted body instead, by its encryption mode and its IV or nonce, which are random
+// for each Container and kept when the body is detached. Modifying either fails authentication of the options.
+func optionsAdditionalData(body *crypto.Encrypted) []byte {
+	return []byte(body.Mode + "." + body.Inputs["iv"] + body.Inputs["nonce"])
+}
+
+// decryptOptions decrypts the encrypted options, if any, with the body data key.
+// A truncated ciphertext or invalid nonce is ErrMalformedContainer, and options that fail authentication are ErrVerificationFailed.
+func (doc *Container) decryptOptions(dataKey []byte) error {
+	if len(doc.Data.Options.EncryptedOptions) == 0 {
+		return nil
+	}
+
+	encrypted := &crypto.Encrypted{
+		Mode:       string(crypto.EncryptionModeAesGcm256),
+		Inputs:     doc.Data.Options.EncryptedOptionsInputs,
+		Ciphertext: doc.Data.Options.EncryptedOptions,
+	}
+	if err := doc.checkCiphertext(encrypted); err != nil {
+		return err
+	}
+	ciphertext, err := crypto.Base64Decode([]byte(encrypted.Ciphertext))
+	if err != nil {
+		return fmt.Errorf("Could not decode encrypted options: %s: %w", err, ErrMalformedContainer)
+	}
+	nonce, err := crypto.Base64Decode([]byte(encrypted.Inputs["nonce"]))
+	if err != nil {
+		return fmt.Errorf("Could not decode encrypted options nonce: %s: %w", err, ErrMalformedContainer)
+	}
+
+	optionsJson, err := crypto.AESGCMDecrypt(ciphertext, nonce, dataKey, optionsAdditionalData(doc.Encrypted()))
+	if err != nil {
+		if errors.Is(err, crypto.ErrAuthenticationFailed) {
+			return fmt.Errorf("Could not decrypt options: %w: %w", err, ErrVerificationFailed)
+		}
+		return fmt.Errorf("Could not decrypt options: %w", err)
+	}
+	options := make(map[string]string)
+	if err := json.Unmarshal(optionsJson, &options); err != nil {
+		return fmt.Errorf("Could not unmarshal encrypted options: %s: %w", err, ErrMalformedContainer)
+	}
+	doc.encryptedOptions = options
+	return nil
+}
+
+// ThreatSpec TMv0.1 for Container.Encrypted
+// Returns encrypted content of container for App:Document
+
+// Encrypted returns the encrypted body and encryption options of the Container.
+func (doc *Container) Encrypted() *crypto.Encrypted {
 	encrypted := new(crypto.Encrypted)
 	encrypted.Keys = doc.Data.Options.EncryptionKeys
+	encrypted.KeyAlgorithms = doc.Data.Options.EncryptionKeyAlgorithms
 	encrypted.Mode = doc.Data.Options.EncryptionMode
 	encrypted.Inputs = doc.Data.Options.EncryptionInputs
 	encrypted.Ciphertext = doc.Data.Body
-
-	if decryptedJson, err := crypto.GroupDecrypt(encrypted, id, privateKey); err != nil {
-		return "", fmt.Errorf("Could not decrypt container: %s", err)
-	} else {
-		return decryptedJson, nil
-	}
+	return encrypted
 }
 
 // ThreatSpec TMv0.1 for Container.SymmetricDecrypt
@@ -197,19 +702,302 @@ func (doc *Container) Decrypt(id string, privateKey string) (string, error) {
 
 // SymmetricDecrypt takes a key and decrypts the Container body, returning a plaintext string.
 func (doc *Container) SymmetricDecrypt(key string) (string, error) {
-	encrypted := new(crypto.Encrypted)
-	encrypted.Keys = doc.Data.Options.EncryptionKeys
-	encrypted.Mode = doc.Data.Options.EncryptionMode
-	encrypted.Inputs = doc.Data.Options.EncryptionInputs
-	encrypted.Ciphertext = doc.Data.Body
+	if err := doc.checkLimits(); err != nil {
+		return "", err
+	}
+
+	if err := doc.checkDecryptedSize(); err != nil {
+		return "", err
+	}
+
+	if err := doc.checkCiphertext(doc.Encrypted()); err != nil {
+		return "", err
+	}
 
-	if decryptedJson, err := crypto.SymmetricDecrypt(encrypted, key); err != nil {
+	if decryptedJson, err := crypto.SymmetricDecrypt(doc.Encrypted(), key); err != nil {
 		return "", fmt.Errorf("Couldn't decrypt container: %s", err)
 	} else {
 		return decryptedJson, nil
 	}
 }
 
+// ThreatSpec TMv0.1 for Container.checkDecryptedSize
+// Mitigates App:Document against resource exhaustion with limit on decrypted size checked before decryption
+
+// checkDecryptedSize returns ErrSizeLimitExceeded if the Container body could decrypt to more than MaxDecryptedSize bytes.
+// The plaintext is never larger than the decoded ciphertext, so the check is done on the encoded body length.
+func (doc *Container) checkDecryptedSize() error {
+	if base64.StdEncoding.DecodedLen(len(doc.Data.Body)) > MaxDecryptedSize {
+		return ErrSizeLimitExceeded
+	}
+	return nil
+}
+
+// ThreatSpec TMv0.1 for Container.checkLimits
+// Mitigates App:Document against resource exhaustion with limits on recipient count and container size
+
+// checkLimits returns ErrTooManyRecipients or ErrContainerTooLarge if the Container exceeds MaxRecipients or MaxContainerSize.
+func (doc *Container) checkLimits() error {
+	if len(doc.Data.Options.EncryptionKeys) > MaxRecipients {
+		return ErrTooManyRecipients
+	}
+	if len(doc.Data.Body) > MaxContainerSize {
+		return ErrContainerTooLarge
+	}
+	return nil
+}
+
+// ThreatSpec TMv0.1 for Container.HasRecipient
+// Returns whether id is a recipient of container for App:Document
+// Mitigates App:Document against recipient membership disclosure by timing with constant-time lookup
+
+// HasRecipient checks whether the Container has an encrypted key for the given id.
+// The check takes the same time whether or not id is a recipient, see crypto.LookupRecipient.
+func (doc *Container) HasRecipient(id string) bool {
+	_, ok := crypto.LookupRecipient(doc.Data.Options.EncryptionKeys, id)
+	return ok
+}
+
+// ThreatSpec TMv0.1 for Container.ContentDigest
+// Returns digest of container body for App:Document
+
+// ContentDigest returns the hex encoded tagged hash of the Container body as stored, see crypto.TaggedHash.
+// For encrypted containers this is the digest of the ciphertext, so it doesn't reveal anything about the plaintext.
+//
+// Content digests were untagged SHA-256 digests before TaggedHash was introduced. Attach only accepts those if
+// crypto.AcceptLegacyDigests is set, so that headers detached by earlier versions can be migrated.
+func (doc *Container) ContentDigest() string {
+	return hex.EncodeToString(crypto.TaggedHash(crypto.TagContentDigest, []byte(doc.Data.Body)))
+}
+
+// digestMatches checks whether the hex encoded digest is the tagged hash of the data or, if crypto.AcceptLegacyDigests
+// is set, the untagged SHA-256 digest recorded by versions before crypto.TaggedHash was introduced.
+func digestMatches(digest, tag string, data []byte) bool {
+	if digest == hex.EncodeToString(crypto.TaggedHash(tag, data)) {
+		return true
+	}
+	if !crypto.AcceptLegacyDigests {
+		return false
+	}
+	legacyDigest := sha256.Sum256(data)
+	return digest == hex.EncodeToString(legacyDigest[:])
+}
+
+// ThreatSpec TMv0.1 for Container.SetContentDigest
+// Does content digest recording for App:Document
+
+// SetContentDigest records the digest of the current body in the content-digest option.
+// The body must not change afterwards and the Container should be signed so that the digest is covered by the signature.
+func (doc *Container) SetContentDigest() {
+	doc.Data.Options.ContentDigest = doc.ContentDigest()
+}
+
+// ThreatSpec TMv0.1 for Container.Detach
+// Does detaching of encrypted body for App:Document
+
+// Detach removes the encrypted body from the Container and returns it as raw ciphertext, so that it can be stored
+// separately from the Container, which becomes a small header. The content digest of the body is recorded first, so
+// that Attach can check the ciphertext. The header should be signed afterwards so that the digest is covered by the signature.
+func (doc *Container) Detach() ([]byte, error) {
+	if !doc.IsEncrypted() {
+		return nil, fmt.Errorf("Container isn't encrypted")
+	}
+	if doc.IsSigned() {
+		return nil, ErrAlreadySigned
+	}
+
+	ciphertext, err := crypto.Base64Decode([]byte(doc.Data.Body))
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode body: %s", err)
+	}
+	doc.SetContentDigest()
+	doc.Data.Body = ""
+	return ciphertext, nil
+}
+
+// ThreatSpec TMv0.1 for Container.Attach
+// Does attaching of detached encrypted body for App:Document
+// Mitigates App:Document against substitution of detached ciphertext with content digest check
+
+// Attach sets the body of a header from Detach to the raw ciphertext. It returns ErrContentDigestMismatch if the
+// ciphertext doesn't match the recorded content digest, leaving the body empty.
+func (doc *Container) Attach(ciphertext []byte) error {
+	if len(doc.Data.Body) > 0 {
+		return fmt.Errorf("Container already has a body")
+	}
+	if len(doc.Data.Options.ContentDigest) == 0 {
+		return fmt.Errorf("Container has no content digest: %w", ErrContentDigestMismatch)
+	}
+
+	doc.Data.Body = string(crypto.Base64Encode(ciphertext))
+	if !digestMatches(doc.Data.Options.ContentDigest, crypto.TagContentDigest, []byte(doc.Data.Body)) {
+		doc.Data.Body = ""
+		return ErrContentDigestMismatch
+	}
+	return nil
+}
+
+// ThreatSpec TMv0.1 for Container.Digest
+// Returns digest of whole container for App:Document
+
+// Digest returns the hex encoded tagged hash of the dumped Container, including its options and signature, see crypto.TaggedHash.
+// Like content digests, container digests were untagged before TaggedHash was introduced, see crypto.AcceptLegacyDigests.
+func (doc *Container) Digest() string {
+	return hex.EncodeToString(crypto.TaggedHash(crypto.TagContainerDigest, []byte(doc.Dump())))
+}
+
+// ThreatSpec TMv0.1 for Container.AddReference
+// Does recording of references to other containers for App:Document
+
+// AddReference records the digest of the other Container in the references option.
+// The other Container must not change afterwards and this Container should be signed so that the reference is covered by the signature.
+func (doc *Container) AddReference(other *Container) {
+	doc.Data.Options.References = append(doc.Data.Options.References, other.Digest())
+}
+
+// ThreatSpec TMv0.1 for Container.References
+// Returns whether container references another for App:Document
+
+// References checks whether the Container has a reference to the other Container. References recorded by versions
+// before crypto.TaggedHash was introduced are only accepted if crypto.AcceptLegacyDigests is set.
+func (doc *Container) References(other *Container) bool {
+	dump := []byte(other.Dump())
+	for _, reference := range doc.Data.Options.References {
+		if digestMatches(reference, crypto.TagContainerDigest, dump) {
+			return true
+		}
+	}
+	return false
+}
+
+// ThreatSpec TMv0.1 for Container.Verify
+// Does container signature verification with a public key for App:Document
+// Mitigates App:Document against signature forgery using a public key as MAC key with rejection of symmetric signature modes
+
+// Verify verifies the Container signature using the PEM encoded public key, without needing an entity.
+// Only public key signature modes are accepted. Verification failures, including a missing signature, return
+// ErrVerificationFailed. Containers whose signed message can't be built, such as with an unsupported signature version,
+// return ErrMalformedContainer, and public keys that can't be decoded return crypto.ErrMalformedKey or
+// crypto.ErrInvalidPublicKey.
+// If the signature verifies, the validity window set with SetValidity is checked with CheckValidity.
+// The signature is left in place whether or not it verifies.
+func (doc *Container) Verify(publicKeyPem string) error {
+	publicKey, err := crypto.PemDecodePublic([]byte(publicKeyPem))
+	if err != nil {
+		return fmt.Errorf("Could not decode public key: %w", err)
+	}
+	return doc.VerifyWithKey(publicKey)
+}
+
+// ThreatSpec TMv0.1 for Container.VerifyWithKey
+// Does container signature verification with a parsed public key for App:Document
+
+// VerifyWithKey is like Verify, but takes a parsed public key so that it doesn't need to be decoded for each verification.
+func (doc *Container) VerifyWithKey(publicKey gocrypto.PublicKey) error {
+	if !doc.IsSigned() {
+		return fmt.Errorf("Container isn't signed: %w", ErrVerificationFailed)
+	}
+
+	mode := crypto.Mode(doc.Data.Options.SignatureMode)
+	if scheme, err := crypto.LookupMode(mode); err != nil || !scheme.IsPublicKey() {
+		return fmt.Errorf("Signature mode '%s' isn't a public key mode: %w", mode, ErrVerificationFailed)
+	}
+
+	message, err := doc.SignatureMessage()
+	if err != nil {
+		return fmt.Errorf("%w: %w", err, ErrMalformedContainer)
+	}
+
+	signature := new(crypto.Signed)
+	signature.Mode = mode
+	if signature.Signature, err = doc.SignatureBase64(); err != nil {
+		return fmt.Errorf("%w: %w", err, ErrMalformedContainer)
+	}
+	signature.Message = message
+
+	if err := crypto.VerifyWithKey(signature, publicKey); err != nil {
+		return fmt.Errorf("Could not verify container signature: %s: %w", err, ErrVerificationFailed)
+	}
+	return doc.CheckValidity()
+}
+
+// ThreatSpec TMv0.1 for Container.SignatureMessage
+// Returns message covered by container signature for App:Document
+// Mitigates App:Document against breaking old signatures with versioned signature message rules
+
+// SignatureMessage returns the message covered by the Container signature, using the rules for the Container's signature
+// version so that containers signed by older versions still verify. It returns ErrUnsupportedSignatureVersion for unknown versions.
+// The Container isn't modified, so a Container can be verified from several goroutines at once.
+func (doc *Container) SignatureMessage() (string, error) {
+	switch doc.Data.Options.SignatureVersion {
+	case SignatureVersion0:
+		data := doc.Data
+		data.Options.Signature = ""
+		data.Options.CounterSignatures = nil
+		return doc.dumpData(data), nil
+	case SignatureVersionSignedFields:
+		return doc.signedFieldsMessage()
+	default:
+		return "", fmt.Errorf("Signature version %d: %w", doc.Data.Options.SignatureVersion, ErrUnsupportedSignatureVersion)
+	}
+}
+
+// ThreatSpec TMv0.1 for Container.CounterSignatureMessage
+// Returns message covered by counter-signatures for App:Document
+
+// CounterSignatureMessage returns the message that counter-signatures are made over: the dumped Container,
+// including its signature but without any counter-signatures, so that each counter-signature is independent of the others.
+// Counter-signatures are excluded from the message covered by the Container signature too.
+func (doc *Container) CounterSignatureMessage() string {
+	data := doc.Data
+	data.Options.CounterSignatures = nil
+	return doc.dumpData(data)
+}
+
+// ThreatSpec TMv0.1 for Container.Signatures
+// Returns all signatures on container for App:Document
+
+// Signatures returns every signature on the Container, each with its own signer and mode. The Container signature comes first,
+// with the source option as its signer, followed by the counter-signatures in the order they were made.
+// Containers with only a Container signature return a single entry.
+func (doc *Container) Signatures() []SignatureEntry {
+	var signatures []SignatureEntry
+	if doc.IsSigned() {
+		signatures = append(signatures, SignatureEntry{
+			Signer:    doc.Data.Options.Source,
+			Mode:      doc.Data.Options.SignatureMode,
+			Signature: doc.Data.Options.Signature,
+		})
+	}
+	for _, counterSignature := range doc.Data.Options.CounterSignatures {
+		signatures = append(signatures, SignatureEntry{
+			Signer:    counterSignature.Signer,
+			Mode:      counterSignature.Mode,
+			Signature: counterSignature.Signature,
+			Counter:   true,
+		})
+	}
+	return signatures
+}
+
+// CipherModeUnknown is returned by CipherMode when a container has no recorded encryption mode.
+const CipherModeUnknown = "unknown"
+
+// ThreatSpec TMv0.1 for Container.CipherMode
+// Returns symmetric cipher of container for App:Document
+
+// CipherMode returns the symmetric cipher that encrypted the Container body, such as "aes-gcm-256", from the encryption
+// mode recorded by Encrypt, without decrypting, so that a minimum cipher policy can be enforced on ingest. The key
+// wrapping part of the mode, such as "+rsa", is removed. Containers with no recorded mode, such as unencrypted
+// containers or containers produced before the mode was recorded, return CipherModeUnknown.
+func (doc *Container) CipherMode() string {
+	mode := doc.Data.Options.EncryptionMode
+	if len(mode) == 0 {
+		return CipherModeUnknown
+	}
+	return strings.SplitN(mode, "+", 2)[0]
+}
+
 // ThreatSpec TMv0.1 for Container.IsEncrypted
 // Returns whether container is encrypted for App:Document
 
@@ -224,6 +1012,86 @@ func (doc *Container) IsEncrypted() bool {
 	}
 }
 
+// ThreatSpec TMv0.1 for Container.SetSignatureEncoding
+// Does selection of container signature encoding for App:Document
+
+// SetSignatureEncoding sets the encoding used for the Container signature, SignatureEncodingBase64 or SignatureEncodingHex.
+// It must be set before signing, as the encoding is recorded in the options and covered by the signature.
+// It returns ErrUnsupportedSignatureEncoding for other encodings.
+func (doc *Container) SetSignatureEncoding(encoding string) error {
+	switch encoding {
+	case SignatureEncodingBase64:
+		doc.Data.Options.SignatureEncoding = ""
+	case SignatureEncodingHex:
+		doc.Data.Options.SignatureEncoding = encoding
+	default:
+		return fmt.Errorf("Signature encoding '%s': %w", encoding, ErrUnsupportedSignatureEncoding)
+	}
+	return nil
+}
+
+// ThreatSpec TMv0.1 for Container.SignatureBytes
+// Returns decoded container signature for App:Document
+
+// SignatureBytes returns the Container signature decoded with the recorded signature encoding.
+// It returns ErrUnsupportedSignatureEncoding if the encoding isn't known.
+func (doc *Container) SignatureBytes() ([]byte, error) {
+	signature := []byte(doc.Data.Options.Signature)
+	switch doc.Data.Options.SignatureEncoding {
+	case "", SignatureEncodingBase64:
+		decoded, err := crypto.Base64Decode(signature)
+		if err != nil {
+			return nil, fmt.Errorf("Could not base64 decode signature: %s", err)
+		}
+		return decoded, nil
+	case SignatureEncodingHex:
+		decoded, err := hex.DecodeString(string(signature))
+		if err != nil {
+			return nil, fmt.Errorf("Could not hex decode signature: %s", err)
+		}
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("Signature encoding '%s': %w", doc.Data.Options.SignatureEncoding, ErrUnsupportedSignatureEncoding)
+	}
+}
+
+// ThreatSpec TMv0.1 for Container.SignatureBase64
+// Returns base64 encoded container signature for App:Document
+
+// SignatureBase64 returns the Container signature base64 encoded, as used by crypto.Signed, whatever the recorded
+// signature encoding.
+func (doc *Container) SignatureBase64() (string, error) {
+	if len(doc.Data.Options.SignatureEncoding) == 0 {
+		return doc.Data.Options.Signature, nil
+	}
+	signature, err := doc.SignatureBytes()
+	if err != nil {
+		return "", err
+	}
+	return string(crypto.Base64Encode(signature)), nil
+}
+
+// ThreatSpec TMv0.1 for Container.SetSignatureBase64
+// Does setting of container signature with recorded encoding for App:Document
+
+// SetSignatureBase64 sets the Container signature from a base64 encoded signature, as made by crypto.Sign,
+// storing it with the recorded signature encoding.
+func (doc *Container) SetSignatureBase64(signature string) error {
+	switch doc.Data.Options.SignatureEncoding {
+	case "", SignatureEncodingBase64:
+		doc.Data.Options.Signature = signature
+	case SignatureEncodingHex:
+		decoded, err := crypto.Base64Decode([]byte(signature))
+		if err != nil {
+			return fmt.Errorf("Could not base64 decode signature: %s", err)
+		}
+		doc.Data.Options.Signature = hex.EncodeToString(decoded)
+	default:
+		return fmt.Errorf("Signature encoding '%s': %w", doc.Data.Options.SignatureEncoding, ErrUnsupportedSignatureEncoding)
+	}
+	return nil
+}
+
 // ThreatSpec TMv0.1 for Container.IsSigned
 // Returns whether container is signed for App:Document
 
@@ -236,3 +1104,204 @@ func (doc *Container) IsSigned() bool {
 		return true
 	}
 }
+
+// ContentTypeHeader is the application header recording the media type of the Container content.
+const ContentTypeHeader = "content-type"
+
+// ContentTypeJSON is the content type of JSON encoded content.
+const ContentTypeJSON = "application/json"
+
+// ContentTypeText is the content type of plain text content.
+const ContentTypeText = "text/plain"
+
+// ContentTypeBinary is the content type of arbitrary binary content.
+const ContentTypeBinary = "application/octet-stream"
+
+// ThreatSpec TMv0.1 for Container.SetType
+// Does setting of application container type for App:Document
+
+// SetType sets the type of the Container, which defaults to "container", so that applications can dispatch containers
+// by type without decrypting them. The type is covered by any signature added afterwards.
+func (doc *Container) SetType(containerType string) {
+	doc.Data.Type = containerType
+}
+
+// ThreatSpec TMv0.1 for Container.SetScope
+// Does setting of application container scope for App:Document
+
+// SetScope sets the scope of the Container, which defaults to "pki.io", so that applications can route containers
+// by scope without decrypting them. The scope is covered by any signature added afterwards.
+func (doc *Container) SetScope(scope string) {
+	doc.Data.Scope = scope
+}
+
+// ThreatSpec TMv0.1 for Container.SetHeader
+// Does setting of application headers for App:Document
+
+// SetHeader sets an application header on the Container. Headers are stored in the plaintext options,
+// so they are readable without decryption and are covered by any signature added afterwards.
+func (doc *Container) SetHeader(key, value string) {
+	if doc.Data.Options.Headers == nil {
+		doc.Data.Options.Headers = make(map[string]string)
+	}
+	doc.Data.Options.Headers[key] = value
+}
+
+// ThreatSpec TMv0.1 for Container.GetHeader
+// Returns application header for App:Document
+
+// GetHeader returns the application header for the given key, or an empty string if it isn't set.
+func (doc *Container) GetHeader(key string) string {
+	return doc.Data.Options.Headers[key]
+}
+
+// ThreatSpec TMv0.1 for EncryptSymmetric
+// Does authenticated symmetric encryption of container with a pre-shared key for App:Document
+// Mitigates App:Document against use of a weak shared secret as an encryption key with key expansion using a random salt
+
+// EncryptSymmetric encrypts the content directly under a pre-shared key, returning a new Container.
+// No recipient keys are wrapped, so the Container can only be decrypted with DecryptSymmetric and the same key.
+// The key is expanded with crypto.ExpandKey and the content is encrypted with AES in GCM mode.
+func EncryptSymmetric(content string, key []byte) (*Container, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("Key can't be empty")
+	}
+
+	newKey, salt, err := crypto.ExpandKey(key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not expand key: %s", err)
+	}
+
+	ciphertext, nonce, err := crypto.AESGCMEncrypt([]byte(content), newKey, []byte(crypto.EncryptionModeAesGcm256))
+	if err != nil {
+		return nil, fmt.Errorf("Could not encrypt content: %s", err)
+	}
+
+	doc, err := NewContainer(nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create container: %s", err)
+	}
+	doc.Data.Options.EncryptionMode = string(crypto.EncryptionModeAesGcm256)
+	doc.Data.Options.EncryptionInputs = map[string]string{
+		"salt":  string(crypto.Base64Encode(salt)),
+		"nonce": string(crypto.Base64Encode(nonce)),
+	}
+	doc.Data.Body = string(crypto.Base64Encode(ciphertext))
+	return doc, nil
+}
+
+// ThreatSpec TMv0.1 for DecryptSymmetric
+// Does authenticated symmetric decryption of container with a pre-shared key for App:Document
+
+// DecryptSymmetric decrypts a Container created by EncryptSymmetric using the pre-shared key, returning a plaintext string.
+// It returns crypto.ErrAuthenticationFailed if the key is wrong or the Container has been modified.
+func DecryptSymmetric(doc *Container, key []byte) (string, error) {
+	if doc.Data.Options.EncryptionMode != string(crypto.EncryptionModeAesGcm256) {
+		return "", fmt.Errorf("Invalid mode '%s'", doc.Data.Options.EncryptionMode)
+	}
+
+	if err := doc.checkDecryptedSize(); err != nil {
+		return "", err
+	}
+
+	if err := crypto.CheckCiphertextLength(doc.Encrypted()); err != nil {
+		return "", err
+	}
+
+	if err := crypto.CheckNonce(doc.Encrypted()); err != nil {
+		return "", err
+	}
+
+	ciphertext, err := crypto.Base64Decode([]byte(doc.Data.Body))
+	if err != nil {
+		return "", fmt.Errorf("Could not decode ciphertext: %s", err)
+	}
+	salt, err := crypto.Base64Decode([]byte(doc.Data.Options.EncryptionInputs["salt"]))
+	if err != nil || len(salt) == 0 {
+		return "", fmt.Errorf("Could not decode salt")
+	}
+	nonce, err := crypto.Base64Decode([]byte(doc.Data.Options.EncryptionInputs["nonce"]))
+	if err != nil {
+		return "", fmt.Errorf("Could not decode nonce: %s", err)
+	}
+
+	newKey, _, err := crypto.ExpandKey(key, salt)
+	if err != nil {
+		return "", fmt.Errorf("Could not expand key: %s", err)
+	}
+
+	plaintext, err := crypto.AESGCMDecrypt(ciphertext, nonce, newKey, []byte(crypto.EncryptionModeAesGcm256))
+	if err != nil {
+		return "", fmt.Errorf("Could not decrypt container: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// JWSTypeHeader is the JWS header holding the Container type.
+const JWSTypeHeader = "pki.io-type"
+
+// ThreatSpec TMv0.1 for Container.ToJWS
+// Does export of container as JWS for App:Document
+
+// ToJWS re-expresses the Container as a JWS compact serialization signed with the PEM encoded private key,
+// using RS256 for RSA keys and ES256 for P-256 ECDSA keys. The Container signature itself isn't carried over.
+//
+// The Container body is the JWS payload, and the options map to JWS headers as follows:
+//
+//   - the source option is the kid header
+//   - the content-type application header, if set, is the cty header
+//   - the Container type is the pki.io-type header
+//
+// Other options aren't represented, so encrypted Containers can't be exported.
+func (doc *Container) ToJWS(privateKeyPem string) (string, error) {
+	if doc.IsEncrypted() {
+		return "", fmt.Errorf("Encrypted container can't be exported as JWS")
+	}
+
+	privateKey, err := crypto.PemDecodePrivate([]byte(privateKeyPem))
+	if err != nil {
+		return "", fmt.Errorf("Could not decode private key: %s", err)
+	}
+
+	header := map[string]interface{}{JWSTypeHeader: doc.Data.Type}
+	if len(doc.Data.Options.Source) > 0 {
+		header["kid"] = doc.Data.Options.Source
+	}
+	if contentType := doc.GetHeader(ContentTypeHeader); len(contentType) > 0 {
+		header["cty"] = contentType
+	}
+	return crypto.SignJWS(header, []byte(doc.Data.Body), privateKey)
+}
+
+// ThreatSpec TMv0.1 for FromJWS
+// Does import of container from JWS for App:Document
+
+// FromJWS verifies a JWS compact serialization with the PEM encoded public key and returns it as an unsigned Container,
+// mapping the JWS headers back to options as described for ToJWS. Verification failures return crypto.ErrInvalidJWS.
+func FromJWS(jws string, publicKeyPem string) (*Container, error) {
+	publicKey, err := crypto.PemDecodePublic([]byte(publicKeyPem))
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode public key: %s", err)
+	}
+
+	header, payload, err := crypto.VerifyJWS(jws, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := NewContainer(nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create container: %s", err)
+	}
+	if docType, ok := header[JWSTypeHeader].(string); ok {
+		doc.Data.Type = docType
+	}
+	if source, ok := header["kid"].(string); ok {
+		doc.Data.Options.Source = source
+	}
+	if contentType, ok := header["cty"].(string); ok {
+		doc.SetHeader(ContentTypeHeader, contentType)
+	}
+	doc.Data.Body = string(payload)
+	return doc, nil
+}
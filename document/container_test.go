@@ -1,10 +1,17 @@
 package document
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"github.com/pki-io/core/crypto"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewContainer(t *testing.T) {
@@ -31,3 +38,540 @@ func TestSymmetricEncryptDecrypt(t *testing.T) {
 	assert.NotNil(t, newMessage)
 	assert.Equal(t, newMessage, message)
 }
+
+func TestContainerHeaders(t *testing.T) {
+	container, _ := NewContainer(nil)
+	assert.Equal(t, container.GetHeader("content-type"), "")
+
+	container.SetHeader("content-type", "application/json")
+	assert.Equal(t, container.GetHeader("content-type"), "application/json")
+
+	newContainer, err := NewContainer(container.Dump())
+	assert.Nil(t, err)
+	assert.Equal(t, newContainer.GetHeader("content-type"), "application/json")
+}
+
+func TestContainerTypeAndScope(t *testing.T) {
+	key, _ := crypto.GenerateECKey()
+	privateKey, _ := crypto.PemEncodePrivate(key)
+	publicKey, _ := crypto.PemEncodePublic(&key.PublicKey)
+
+	container, _ := NewContainer(nil)
+	assert.Equal(t, container.Data.Type, "container")
+	assert.Equal(t, container.Data.Scope, "pki.io")
+
+	container.SetType("invoice")
+	container.SetScope("example.com")
+	container.Data.Body = "this is a message"
+	container.Data.Options.SignatureMode = string(crypto.SignatureModeSha256Ecdsa)
+	signature := crypto.NewSignature(crypto.SignatureModeSha256Ecdsa)
+	crypto.Sign(container.Dump(), string(privateKey), signature)
+	container.Data.Options.Signature = signature.Signature
+
+	newContainer, err := NewContainer(container.Dump())
+	assert.NoError(t, err)
+	assert.Equal(t, newContainer.Data.Type, "invoice")
+	assert.Equal(t, newContainer.Data.Scope, "example.com")
+	assert.NoError(t, newContainer.Verify(string(publicKey)))
+
+	newContainer.SetType("receipt")
+	assert.True(t, errors.Is(newContainer.Verify(string(publicKey)), ErrVerificationFailed))
+
+	newContainer.SetType("invoice")
+	newContainer.SetScope("example.org")
+	assert.True(t, errors.Is(newContainer.Verify(string(publicKey)), ErrVerificationFailed))
+}
+
+func TestSignatureEncoding(t *testing.T) {
+	key, _ := crypto.GenerateECKey()
+	privateKey, _ := crypto.PemEncodePrivate(key)
+	publicKey, _ := crypto.PemEncodePublic(&key.PublicKey)
+
+	for _, encoding := range []string{SignatureEncodingBase64, SignatureEncodingHex} {
+		container, _ := NewContainer(nil)
+		container.Data.Body = "this is a message"
+		assert.NoError(t, container.SetSignatureEncoding(encoding))
+		container.Data.Options.SignatureMode = string(crypto.SignatureModeSha256Ecdsa)
+		signature := crypto.NewSignature(crypto.SignatureModeSha256Ecdsa)
+		crypto.Sign(container.Dump(), string(privateKey), signature)
+		assert.NoError(t, container.SetSignatureBase64(signature.Signature))
+
+		newContainer, err := NewContainer(container.Dump())
+		assert.NoError(t, err)
+		assert.NoError(t, newContainer.Verify(string(publicKey)))
+
+		raw, _ := crypto.Base64Decode([]byte(signature.Signature))
+		signatureBytes, err := newContainer.SignatureBytes()
+		assert.NoError(t, err)
+		assert.Equal(t, signatureBytes, raw)
+		if encoding == SignatureEncodingHex {
+			assert.Equal(t, newContainer.Data.Options.Signature, hex.EncodeToString(raw))
+		} else {
+			assert.Equal(t, newContainer.Data.Options.Signature, signature.Signature)
+		}
+	}
+
+	container, _ := NewContainer(nil)
+	assert.True(t, errors.Is(container.SetSignatureEncoding("base32"), ErrUnsupportedSignatureEncoding))
+	container.Data.Options.SignatureEncoding = "base32"
+	_, err := container.SignatureBytes()
+	assert.True(t, errors.Is(err, ErrUnsupportedSignatureEncoding))
+}
+
+func TestDecryptSizeLimit(t *testing.T) {
+	rawKey, _ := crypto.RandomBytes(16)
+	key := hex.EncodeToString(rawKey)
+
+	container, _ := NewContainer(nil)
+	container.SymmetricEncrypt("this is a secret that is longer than the limit", "1", key)
+
+	defer func(size int) { MaxDecryptedSize = size }(MaxDecryptedSize)
+	MaxDecryptedSize = 16
+	_, err := container.SymmetricDecrypt(key)
+	assert.Equal(t, err, ErrSizeLimitExceeded)
+
+	_, err = container.Decrypt("1", "")
+	assert.Equal(t, err, ErrSizeLimitExceeded)
+}
+
+func TestContainerLimits(t *testing.T) {
+	container, _ := NewContainer(nil)
+	container.Data.Options.EncryptionKeys = map[string]string{"1": "a", "2": "b", "3": "c"}
+	containerJson := container.Dump()
+
+	defer func(recipients, size int) {
+		MaxRecipients = recipients
+		MaxContainerSize = size
+	}(MaxRecipients, MaxContainerSize)
+
+	MaxRecipients = 2
+	_, err := NewContainer(containerJson)
+	assert.Equal(t, err, ErrTooManyRecipients)
+	_, err = container.Decrypt("1", "")
+	assert.Equal(t, err, ErrTooManyRecipients)
+
+	MaxRecipients = 3
+	_, err = NewContainer(containerJson)
+	assert.Nil(t, err)
+
+	MaxContainerSize = len(containerJson) - 1
+	_, err = NewContainer(containerJson)
+	assert.Equal(t, err, ErrContainerTooLarge)
+	_, err = NewContainer([]byte(containerJson))
+	assert.Equal(t, err, ErrContainerTooLarge)
+}
+
+func TestDecryptTruncatedCiphertext(t *testing.T) {
+	rawKey, _ := crypto.RandomBytes(16)
+	key := hex.EncodeToString(rawKey)
+
+	container, _ := NewContainer(nil)
+	container.SymmetricEncrypt("this is a secret", "1", key)
+
+	ciphertext, _ := crypto.Base64Decode([]byte(container.Data.Body))
+	container.Data.Body = string(crypto.Base64Encode(ciphertext[:len(ciphertext)-1]))
+	_, err := container.SymmetricDecrypt(key)
+	assert.True(t, errors.Is(err, crypto.ErrTruncatedCiphertext))
+	assert.True(t, errors.Is(err, ErrMalformedContainer))
+
+	container.Data.Body = ""
+	_, err = container.SymmetricDecrypt(key)
+	assert.True(t, errors.Is(err, crypto.ErrTruncatedCiphertext))
+}
+
+func TestCipherMode(t *testing.T) {
+	container, _ := NewContainer(nil)
+	assert.Equal(t, container.CipherMode(), CipherModeUnknown)
+
+	key, _ := crypto.GenerateECKey()
+	publicKey, _ := crypto.PemEncodePublic(key.Public())
+	keys := map[string]string{"1": string(publicKey)}
+	container.Encrypt("secret", keys)
+	assert.Equal(t, container.CipherMode(), string(crypto.EncryptionModeAesCbc256))
+
+	authenticated, _ := NewContainer(nil)
+	authenticated.EncryptWithAAD("secret", keys, "aad")
+	assert.Equal(t, authenticated.CipherMode(), string(crypto.EncryptionModeAesGcm256))
+
+	rawKey, _ := crypto.RandomBytes(16)
+	symmetric, _ := NewContainer(nil)
+	symmetric.SymmetricEncrypt("secret", "1", hex.EncodeToString(rawKey))
+	assert.Equal(t, symmetric.CipherMode(), string(crypto.EncryptionModeAesCbc256))
+
+	legacy, _ := NewContainer(container.Dump())
+	legacy.Data.Options.EncryptionMode = ""
+	assert.Equal(t, legacy.CipherMode(), CipherModeUnknown)
+}
+
+func TestContentDigest(t *testing.T) {
+	container, _ := NewContainer(nil)
+	container.Data.Body = "this is a message"
+	container.SetContentDigest()
+	assert.Equal(t, container.Data.Options.ContentDigest, "4f2394582ddff02d4cc49c86741e583f51ecb609580b0be2ae437ce5fa90ca55")
+
+	newContainer, err := NewContainer(container.Dump())
+	assert.NoError(t, err)
+	assert.Equal(t, newContainer.Data.Options.ContentDigest, container.ContentDigest())
+
+	newContainer.Data.Body = "this is another message"
+	assert.NotEqual(t, newContainer.ContentDigest(), newContainer.Data.Options.ContentDigest)
+
+	header, _ := NewContainer(nil)
+	header.Data.Options.ContentDigest = legacyDigest(string(crypto.Base64Encode([]byte("this is a message"))))
+	assert.True(t, errors.Is(header.Attach([]byte("this is a message")), ErrContentDigestMismatch))
+
+	defer func() { crypto.AcceptLegacyDigests = false }()
+	crypto.AcceptLegacyDigests = true
+	assert.NoError(t, header.Attach([]byte("this is a message")))
+
+	header.Data.Body = ""
+	assert.True(t, errors.Is(header.Attach([]byte("this is another message")), ErrContentDigestMismatch))
+}
+
+// legacyDigest returns the untagged digest recorded by versions before crypto.TaggedHash was introduced.
+func legacyDigest(data string) string {
+	digest := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(digest[:])
+}
+
+func TestContainerVerify(t *testing.T) {
+	key, _ := crypto.GenerateECKey()
+	privateKey, _ := crypto.PemEncodePrivate(key)
+	publicKey, _ := crypto.PemEncodePublic(&key.PublicKey)
+
+	container, _ := NewContainer(nil)
+	container.Data.Body = "this is a message"
+	container.Data.Options.SignatureMode = string(crypto.SignatureModeSha256Ecdsa)
+	signature := crypto.NewSignature(crypto.SignatureModeSha256Ecdsa)
+	crypto.Sign(container.Dump(), string(privateKey), signature)
+	container.Data.Options.Signature = signature.Signature
+
+	err := container.Verify(string(publicKey))
+	assert.NoError(t, err)
+	assert.Equal(t, container.Data.Options.Signature, signature.Signature)
+
+	container.Data.Body = "this is a tampered message"
+	err = container.Verify(string(publicKey))
+	assert.True(t, errors.Is(err, ErrVerificationFailed))
+
+	container.Data.Options.SignatureMode = string(crypto.SignatureModeSha256Hmac)
+	err = container.Verify(string(publicKey))
+	assert.True(t, errors.Is(err, ErrVerificationFailed))
+}
+
+func TestContainerVerifyConcurrent(t *testing.T) {
+	key, _ := crypto.GenerateECKey()
+	privateKey, _ := crypto.PemEncodePrivate(key)
+	publicKey, _ := crypto.PemEncodePublic(&key.PublicKey)
+
+	container, _ := NewContainer(nil)
+	container.Data.Body = "this is a message"
+	container.Data.Options.SignatureMode = string(crypto.SignatureModeSha256Ecdsa)
+	signature := crypto.NewSignature(crypto.SignatureModeSha256Ecdsa)
+	crypto.Sign(container.Dump(), string(privateKey), signature)
+	container.Data.Options.Signature = signature.Signature
+	container.Data.Options.CounterSignatures = []CounterSignature{{Signer: "other", Mode: string(signature.Mode), Signature: "c2lnbmF0dXJl"}}
+	counterSignatureMessage := container.CounterSignatureMessage()
+
+	// Run with -race to check that verification doesn't modify the container
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, container.Verify(string(publicKey)))
+			assert.Equal(t, container.CounterSignatureMessage(), counterSignatureMessage)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, container.Data.Options.Signature, signature.Signature)
+	assert.Equal(t, len(container.Data.Options.CounterSignatures), 1)
+}
+
+func TestContainerValidity(t *testing.T) {
+	key, _ := crypto.GenerateECKey()
+	privateKey, _ := crypto.PemEncodePrivate(key)
+	publicKey, _ := crypto.PemEncodePublic(&key.PublicKey)
+	issued := time.Unix(1500000000, 0)
+	current := issued
+	SetClock(ClockFunc(func() time.Time { return current }))
+	defer SetClock(nil)
+
+	container, _ := NewContainer(nil)
+	container.Data.Body = "this is a message"
+	container.SetValidity(issued, issued.Add(time.Hour))
+	container.Data.Options.SignatureMode = string(crypto.SignatureModeSha256Ecdsa)
+	signature := crypto.NewSignature(crypto.SignatureModeSha256Ecdsa)
+	crypto.Sign(container.Dump(), string(privateKey), signature)
+	container.Data.Options.Signature = signature.Signature
+	assert.NoError(t, container.Verify(string(publicKey)))
+
+	current = issued.Add(-ClockSkew)
+	assert.NoError(t, container.Verify(string(publicKey)))
+	current = issued.Add(-ClockSkew - time.Second)
+	assert.True(t, errors.Is(container.Verify(string(publicKey)), ErrNotYetValid))
+
+	current = issued.Add(time.Hour + ClockSkew)
+	assert.NoError(t, container.Verify(string(publicKey)))
+	current = issued.Add(time.Hour + ClockSkew + time.Second)
+	assert.True(t, errors.Is(container.Verify(string(publicKey)), ErrExpired))
+}
+
+func TestAddReference(t *testing.T) {
+	request, _ := NewContainer(nil)
+	request.Data.Body = "this is a request"
+	approval, _ := NewContainer(nil)
+	approval.Data.Body = "this is an approval"
+
+	assert.False(t, approval.References(request))
+	approval.AddReference(request)
+	assert.True(t, approval.References(request))
+
+	newApproval, err := NewContainer(approval.Dump())
+	assert.NoError(t, err)
+	assert.Equal(t, newApproval.Data.Options.References, []string{request.Digest()})
+
+	legacyApproval, _ := NewContainer(nil)
+	legacyApproval.Data.Options.References = []string{legacyDigest(request.Dump())}
+	assert.False(t, legacyApproval.References(request))
+	defer func() { crypto.AcceptLegacyDigests = false }()
+	crypto.AcceptLegacyDigests = true
+	assert.True(t, legacyApproval.References(request))
+
+	request.Data.Body = "this is a tampered request"
+	assert.False(t, approval.References(request))
+	assert.False(t, legacyApproval.References(request))
+}
+
+func TestEncryptSymmetric(t *testing.T) {
+	key := []byte("this is a shared secret")
+	container, err := EncryptSymmetric("this is a secret", key)
+	assert.NoError(t, err)
+	assert.Equal(t, container.Data.Options.EncryptionMode, string(crypto.EncryptionModeAesGcm256))
+	assert.Empty(t, container.Data.Options.EncryptionKeys)
+
+	newContainer, err := NewContainer(container.Dump())
+	assert.NoError(t, err)
+	plaintext, err := DecryptSymmetric(newContainer, key)
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, "this is a secret")
+
+	_, err = DecryptSymmetric(newContainer, []byte("this is the wrong secret"))
+	assert.True(t, errors.Is(err, crypto.ErrAuthenticationFailed))
+
+	_, err = EncryptSymmetric("this is a secret", nil)
+	assert.Error(t, err)
+}
+
+func TestDecryptInvalidNonce(t *testing.T) {
+	key, _ := crypto.GenerateECKey()
+	privateKey, _ := crypto.PemEncodePrivate(key)
+	publicKey, _ := crypto.PemEncodePublic(&key.PublicKey)
+
+	container, _ := NewContainer(nil)
+	container.EncryptWithAAD("this is a secret", map[string]string{"1": string(publicKey)}, "")
+	nonce := container.Data.Options.EncryptionInputs["nonce"]
+
+	container.Data.Options.EncryptionInputs["nonce"] = string(crypto.Base64Encode(make([]byte, 12)))
+	_, err := container.Decrypt("1", string(privateKey))
+	assert.True(t, errors.Is(err, crypto.ErrInvalidNonce))
+
+	container.Data.Options.EncryptionInputs["nonce"] = string(crypto.Base64Encode([]byte("short")))
+	_, err = container.Decrypt("1", string(privateKey))
+	assert.True(t, errors.Is(err, crypto.ErrInvalidNonce))
+
+	container.Data.Options.EncryptionInputs["nonce"] = nonce
+	plaintext, err := container.Decrypt("1", string(privateKey))
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, "this is a secret")
+}
+
+func TestDecryptSymmetricTestVector(t *testing.T) {
+	vectors, _ := crypto.TestVectors()
+	vector := vectors[2]
+	assert.Equal(t, vector.Mode, crypto.EncryptionModeAesGcm256)
+
+	container, _ := NewContainer(nil)
+	container.Data.Options.EncryptionMode = vector.Encrypted.Mode
+	container.Data.Options.EncryptionInputs = vector.Encrypted.Inputs
+	container.Data.Body = vector.Encrypted.Ciphertext
+
+	key, _ := hex.DecodeString(vector.Key)
+	plaintext, err := DecryptSymmetric(container, key)
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, vector.Plaintext)
+}
+
+func TestEncryptedOptions(t *testing.T) {
+	key, _ := crypto.GenerateECKey()
+	privateKey, _ := crypto.PemEncodePrivate(key)
+	publicKey, _ := crypto.PemEncodePublic(&key.PublicKey)
+
+	container, _ := NewContainer(nil)
+	err := container.SetEncryptedOption("recipient-name", "alice")
+	assert.NoError(t, err)
+	err = container.Encrypt("this is a secret", map[string]string{"1": string(publicKey)})
+	assert.NoError(t, err)
+	assert.NotEqual(t, container.Data.Options.EncryptedOptions, "")
+	assert.Equal(t, container.SetEncryptedOption("other", "value"), ErrEncryptedOptionsUnavailable)
+
+	newContainer, _ := NewContainer(container.Dump())
+	_, err = newContainer.GetEncryptedOption("recipient-name")
+	assert.Equal(t, err, ErrEncryptedOptionsUnavailable)
+
+	message, err := newContainer.Decrypt("1", string(privateKey))
+	assert.NoError(t, err)
+	assert.Equal(t, message, "this is a secret")
+	value, err := newContainer.GetEncryptedOption("recipient-name")
+	assert.NoError(t, err)
+	assert.Equal(t, value, "alice")
+
+	// The data key is unwrapped once for the body and options
+	decrypter := &countingDecrypter{Decrypter: crypto.NewPemDecrypter(string(privateKey))}
+	newContainer, _ = NewContainer(container.Dump())
+	_, err = newContainer.DecryptWith("1", decrypter)
+	assert.NoError(t, err)
+	assert.Equal(t, decrypter.unwraps, 1)
+
+	// Modified options fail authentication
+	newContainer, _ = NewContainer(container.Dump())
+	ciphertext, _ := crypto.Base64Decode([]byte(newContainer.Data.Options.EncryptedOptions))
+	ciphertext[0] ^= 1
+	newContainer.Data.Options.EncryptedOptions = string(crypto.Base64Encode(ciphertext))
+	_, err = newContainer.Decrypt("1", string(privateKey))
+	assert.True(t, errors.Is(err, ErrVerificationFailed))
+
+	// The options are bound to the body IV
+	newContainer, _ = NewContainer(container.Dump())
+	iv, _ := crypto.Base64Decode([]byte(newContainer.Data.Options.EncryptionInputs["iv"]))
+	iv[0] ^= 1
+	newContainer.Data.Options.EncryptionInputs["iv"] = string(crypto.Base64Encode(iv))
+	_, err = newContainer.Decrypt("1", string(privateKey))
+	assert.True(t, errors.Is(err, ErrVerificationFailed))
+
+	// The options nonce is checked like the body's
+	newContainer, _ = NewContainer(container.Dump())
+	newContainer.Data.Options.EncryptedOptionsInputs["nonce"] = string(crypto.Base64Encode(make([]byte, 12)))
+	_, err = newContainer.Decrypt("1", string(privateKey))
+	assert.True(t, errors.Is(err, crypto.ErrInvalidNonce))
+	assert.True(t, errors.Is(err, ErrMalformedContainer))
+
+	newContainer, _ = NewContainer(container.Dump())
+	newContainer.Data.Options.EncryptedOptionsInputs["nonce"] = "not base64!"
+	_, err = newContainer.Decrypt("1", string(privateKey))
+	assert.True(t, errors.Is(err, ErrMalformedContainer))
+}
+
+// countingDecrypter counts the data keys unwrapped by a crypto.Decrypter.
+type countingDecrypter struct {
+	crypto.Decrypter
+	unwraps int
+}
+
+func (decrypter *countingDecrypter) UnwrapKey(encrypted *crypto.Encrypted, keyID string) ([]byte, error) {
+	decrypter.unwraps++
+	return decrypter.Decrypter.UnwrapKey(encrypted, keyID)
+}
+
+func TestEncryptRecipientOrder(t *testing.T) {
+	key, _ := crypto.GenerateECKey()
+	privateKey, _ := crypto.PemEncodePrivate(key)
+	publicKey, _ := crypto.PemEncodePublic(&key.PublicKey)
+	ids := []string{"e", "a", "d", "b", "c"}
+	keys := make(map[string]string)
+	for _, id := range ids {
+		keys[id] = string(publicKey)
+	}
+
+	container, _ := NewContainer(nil)
+	err := container.Encrypt("this is a secret", keys)
+	assert.NoError(t, err)
+
+	var data struct {
+		Options struct {
+			EncryptionKeys json.RawMessage `json:"encryption-keys"`
+		} `json:"options"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(container.Dump()), &data))
+	recipients := string(data.Options.EncryptionKeys)
+	for i, id := range []string{"a", "b", "c", "d"} {
+		next := string(rune('b' + i))
+		assert.True(t, strings.Index(recipients, `"`+id+`"`) < strings.Index(recipients, `"`+next+`"`))
+	}
+
+	newContainer, _ := NewContainer(container.Dump())
+	message, err := newContainer.Decrypt("c", string(privateKey))
+	assert.NoError(t, err)
+	assert.Equal(t, message, "this is a secret")
+}
+
+func TestEncryptSignedContainer(t *testing.T) {
+	key, _ := crypto.GenerateECKey()
+	privateKey, _ := crypto.PemEncodePrivate(key)
+	publicKey, _ := crypto.PemEncodePublic(&key.PublicKey)
+
+	container, _ := NewContainer(nil)
+	container.Data.Body = "this is a message"
+	container.Data.Options.SignatureMode = string(crypto.SignatureModeSha256Ecdsa)
+	signature := crypto.NewSignature(crypto.SignatureModeSha256Ecdsa)
+	crypto.Sign(container.Dump(), string(privateKey), signature)
+	container.Data.Options.Signature = signature.Signature
+
+	err := container.Encrypt("this is a secret", map[string]string{"1": string(publicKey)})
+	assert.Equal(t, err, ErrAlreadySigned)
+	err = container.EncryptWithAAD("this is a secret", map[string]string{"1": string(publicKey)}, "routing-info")
+	assert.Equal(t, err, ErrAlreadySigned)
+	assert.NoError(t, container.Verify(string(publicKey)))
+}
+
+func TestVerifyGoldenContainer(t *testing.T) {
+	containerJson, err := ioutil.ReadFile("testdata/container-v0.json")
+	assert.NoError(t, err)
+	publicKey, err := ioutil.ReadFile("testdata/container-v0.pem")
+	assert.NoError(t, err)
+
+	container, err := NewContainer(containerJson)
+	assert.NoError(t, err)
+	assert.Equal(t, container.Data.Options.SignatureVersion, SignatureVersion0)
+	assert.NoError(t, container.Verify(string(publicKey)))
+
+	container.Data.Options.SignatureVersion = 99
+	err = container.Verify(string(publicKey))
+	assert.True(t, errors.Is(err, ErrUnsupportedSignatureVersion))
+}
+
+func TestFormatVersion(t *testing.T) {
+	container, _ := NewContainer(nil)
+	assert.Equal(t, container.FormatVersion(), WireVersion)
+
+	var dumped map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(container.Dump()), &dumped))
+	assert.Equal(t, dumped["version"], float64(WireVersion))
+
+	newContainer, err := NewContainer(container.Dump())
+	assert.NoError(t, err)
+	assert.Equal(t, newContainer.FormatVersion(), WireVersion)
+
+	delete(dumped, "version")
+	unversioned, _ := json.Marshal(dumped)
+	_, err = NewContainer(unversioned)
+	assert.Error(t, err)
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	version, err := NegotiateVersion(WireVersion + 1)
+	assert.NoError(t, err)
+	assert.Equal(t, version, WireVersion)
+
+	version, err = NegotiateVersion(MinWireVersion)
+	assert.NoError(t, err)
+	assert.Equal(t, version, MinWireVersion)
+
+	_, err = NegotiateVersion(MinWireVersion - 1)
+	assert.True(t, errors.Is(err, ErrNoCommonVersion))
+
+	container, _ := NewContainer(nil)
+	container.Data.Version = WireVersion + 1
+	_, err = NewContainer(container.Dump())
+	assert.True(t, errors.Is(err, ErrUnsupportedWireVersion))
+}
@@ -2,10 +2,12 @@
 package document
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/xeipuuv/gojsonschema"
+	"io"
 	"strings"
 )
 
@@ -14,40 +16,89 @@ type Documenter interface {
 	Load()
 }
 
+// ErrUnsupportedInput is returned when FromJson is given data of a type it can't parse.
+var ErrUnsupportedInput = errors.New("Unsupported input type")
+
+// ErrMalformedInput is returned when FromJson is given JSON that is too large, too deeply nested, has duplicate keys or is invalid.
+var ErrMalformedInput = errors.New("Malformed input")
+
+// MaxDocumentSize is the maximum size in bytes of JSON accepted by FromJson.
+var MaxDocumentSize = 96 * 1024 * 1024
+
+// MaxDocumentDepth is the maximum nesting depth of JSON objects and arrays accepted by FromJson.
+var MaxDocumentDepth = 32
+
 // Documents represents a generic JSON schema based document
 type Document struct {
 	Schema  string
 	Default string
+	// Validator is the compiled Schema. If it is nil, or was compiled from a different schema, Schema is compiled
+	// each time a document is validated.
+	Validator *Validator
+}
+
+// Validator is a compiled JSON schema. It is safe for concurrent use.
+type Validator struct {
+	source string
+	schema *gojsonschema.Schema
+}
+
+// ThreatSpec TMv0.1 for CompileSchema
+// Does JSON schema compilation for App:Document
+
+// CompileSchema compiles the JSON schema, so that it can be shared by documents as their Validator.
+func CompileSchema(schema string) (*Validator, error) {
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema))
+	if err != nil {
+		return nil, fmt.Errorf("Could not compile schema: %s", err)
+	}
+	return &Validator{source: schema, schema: compiled}, nil
+}
+
+// validate validates the JSON against the document's Validator, or its Schema if there is no Validator for it.
+func (doc *Document) validate(jsonData []byte) (*gojsonschema.Result, error) {
+	documentLoader := gojsonschema.NewBytesLoader(jsonData)
+	if doc.Validator != nil && doc.Validator.source == doc.Schema {
+		return doc.Validator.schema.Validate(documentLoader)
+	}
+	return gojsonschema.Validate(gojsonschema.NewStringLoader(doc.Schema), documentLoader)
 }
 
 // ThreatSpec TMv0.1 for Document.FromJson
 // Creates document from JSON for App:Document
 
 // FromJson parses the provided data after verifying the schema. If the data is nil, it uses the default values set for the document.
+//
+// The data can be a string, a []byte or a json.RawMessage. Byte slices are parsed without being copied to a string.
+// Any other type returns ErrUnsupportedInput. JSON larger than MaxDocumentSize, nested deeper than MaxDocumentDepth
+// or with duplicate object keys returns ErrMalformedInput before schema validation.
 func (doc *Document) FromJson(data interface{}, target interface{}) (interface{}, error) {
-	var jsonData string
+	var jsonData []byte
 	doValidation := true
 
 	switch t := data.(type) {
 	case []byte:
-		jsonData = string(t)
-	case string:
 		jsonData = t
+	case json.RawMessage:
+		jsonData = t
+	case string:
+		jsonData = []byte(t)
 	case nil:
-		jsonData = doc.Default
+		jsonData = []byte(doc.Default)
 		doValidation = false
 	default:
-		return nil, fmt.Errorf("Invalid input type: %T", t)
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedInput, t)
 	}
 
 	if doValidation {
-		documentLoader := gojsonschema.NewStringLoader(jsonData)
-		schemaLoader := gojsonschema.NewStringLoader(doc.Schema)
+		if err := checkJson(jsonData); err != nil {
+			return nil, err
+		}
 
-		if result, err := gojsonschema.Validate(schemaLoader, documentLoader); err != nil {
+		if result, err := doc.validate(jsonData); err != nil {
 			return nil, errors.New("Something went wrong when trying to validate json.")
 		} else if result.Valid() {
-			if err := json.Unmarshal([]byte(jsonData), target); err != nil {
+			if err := json.Unmarshal(jsonData, target); err != nil {
 				return nil, err
 			} else {
 				return target, nil
@@ -61,7 +112,7 @@ func (doc *Document) FromJson(data interface{}, target interface{}) (interface{}
 			return nil, errors.New(strings.Join(errs, "\n"))
 		}
 	} else {
-		if err := json.Unmarshal([]byte(jsonData), target); err != nil {
+		if err := json.Unmarshal(jsonData, target); err != nil {
 			return nil, err
 		} else {
 			return target, nil
@@ -69,6 +120,74 @@ func (doc *Document) FromJson(data interface{}, target interface{}) (interface{}
 	}
 }
 
+// ThreatSpec TMv0.1 for checkJson
+// Mitigates App:Document against resource exhaustion with limits on JSON size and depth
+// Mitigates App:Document against ambiguous documents with rejection of duplicate keys
+
+// checkJson returns ErrMalformedInput if the JSON is larger than MaxDocumentSize, nested deeper than MaxDocumentDepth,
+// has duplicate keys in an object or isn't valid.
+func checkJson(jsonData []byte) error {
+	if len(jsonData) > MaxDocumentSize {
+		return fmt.Errorf("%w: document is larger than %d bytes", ErrMalformedInput, MaxDocumentSize)
+	}
+
+	// Each open object or array has a frame. Objects track the keys seen and whether the next token is a key.
+	type frame struct {
+		keys      map[string]bool
+		expectKey bool
+	}
+	var stack []*frame
+
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			if len(stack) > 0 {
+				return fmt.Errorf("%w: unexpected end of JSON input", ErrMalformedInput)
+			}
+			break
+		} else if err != nil {
+			return fmt.Errorf("%w: %s", ErrMalformedInput, err)
+		}
+
+		if d, ok := token.(json.Delim); ok && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		var top *frame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+
+		if top != nil && top.expectKey {
+			key := token.(string)
+			if top.keys[key] {
+				return fmt.Errorf("%w: duplicate key '%s'", ErrMalformedInput, key)
+			}
+			top.keys[key] = true
+			top.expectKey = false
+			continue
+		}
+
+		if top != nil && top.keys != nil {
+			top.expectKey = true
+		}
+
+		if d, ok := token.(json.Delim); ok {
+			if len(stack) >= MaxDocumentDepth {
+				return fmt.Errorf("%w: document is nested deeper than %d levels", ErrMalformedInput, MaxDocumentDepth)
+			}
+			if d == '{' {
+				stack = append(stack, &frame{keys: make(map[string]bool), expectKey: true})
+			} else {
+				stack = append(stack, &frame{})
+			}
+		}
+	}
+	return nil
+}
+
 // ThreatSpec TMv0.1 for Document.ToJson
 // Returns document as JSON for App:Document
 
@@ -79,10 +198,8 @@ func (doc *Document) ToJson(data interface{}) (string, error) {
 		return "", err
 	}
 
-	documentLoader := gojsonschema.NewStringLoader(string(jsonData))
-	schemaLoader := gojsonschema.NewStringLoader(doc.Schema)
-
-	if result, err := gojsonschema.Validate(schemaLoader, documentLoader); err != nil {
+	// Validate the marshalled bytes directly so that large documents aren't copied before being returned
+	if result, err := doc.validate(jsonData); err != nil {
 		return "", errors.New("something went wrong when trying to validate json.")
 	} else if result.Valid() {
 		return string(jsonData), nil
@@ -1,6 +1,8 @@
 package document
 
 import (
+    "errors"
+    "strings"
     "testing"
     "github.com/stretchr/testify/assert"
 )
@@ -73,3 +75,30 @@ func TestDocumentJson(t *testing.T) {
     doc.Data = *d.(*TestData)
     assert.Equal(t, doc.Data.Test, "badgers")
 }
+
+func TestDocumentMalformedJson(t *testing.T) {
+    doc := new(Document)
+    doc.Schema = `{"$schema": "http://json-schema.org/draft-04/schema#", "type": "object"}`
+
+    inputs := []string{
+        `{"test":"a","test":"b"}`,
+        strings.Repeat(`{"a":`, 100) + `1` + strings.Repeat(`}`, 100),
+        strings.Repeat(`[`, 100) + strings.Repeat(`]`, 100),
+        `{"test":`,
+    }
+    for _, input := range inputs {
+        data := make(map[string]interface{})
+        _, err := doc.FromJson(input, &data)
+        assert.True(t, errors.Is(err, ErrMalformedInput), input)
+    }
+
+    defer func(size int) { MaxDocumentSize = size }(MaxDocumentSize)
+    MaxDocumentSize = 16
+    data := make(map[string]interface{})
+    _, err := doc.FromJson(`{"test":"this is too long"}`, &data)
+    assert.True(t, errors.Is(err, ErrMalformedInput))
+
+    MaxDocumentSize = 64
+    _, err = doc.FromJson(`{"a":{"test":1},"b":[{"test":2}],"test":3}`, &data)
+    assert.NoError(t, err)
+}
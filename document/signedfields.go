@@ -0,0 +1,166 @@
+// ThreatSpec package github.com/pki-io/core/document as document
+package document
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownSignedField is returned when a signed field isn't a field of the Container.
+var ErrUnknownSignedField = errors.New("Unknown signed field")
+
+// ErrMissingSignedField is returned when signed fields leave out a field that must be signed, see RequiredSignedFields.
+var ErrMissingSignedField = errors.New("Missing signed field")
+
+// alwaysSignedFields are covered by every signature over signed fields, so that the rules can't be changed without
+// invalidating the signature.
+var alwaysSignedFields = []string{"options.signature-mode", "options.signature-version", "options.signed-fields"}
+
+// unsignedFields are the transport-only fields that signed fields may leave out. Every other signable field affects how
+// the Container is decrypted or verified, so must be signed. New transport-only options must be added here, otherwise
+// they are required too.
+var unsignedFields = map[string]bool{"options.headers": true}
+
+// signableFields are the names that can be signed: the top level fields and the options, prefixed with "options.",
+// except the signature and counter-signatures.
+var signableFields = func() map[string]bool {
+	fields := map[string]bool{"scope": true, "version": true, "type": true, "body": true}
+	options, _ := reflect.TypeOf(ContainerData{}).FieldByName("Options")
+	for i := 0; i < options.Type.NumField(); i++ {
+		name := strings.Split(options.Type.Field(i).Tag.Get("json"), ",")[0]
+		fields["options."+name] = true
+	}
+	delete(fields, "options.signature")
+	delete(fields, "options.counter-signatures")
+	return fields
+}()
+
+// ThreatSpec TMv0.1 for RequiredSignedFields
+// Returns fields that signed fields must include for App:Document
+
+// RequiredSignedFields returns the fields, sorted, that signed fields must include: every signable field except the
+// transport-only fields, such as "options.headers", and the fields that are always covered.
+func RequiredSignedFields() []string {
+	always := make(map[string]bool)
+	for _, field := range alwaysSignedFields {
+		always[field] = true
+	}
+	var fields []string
+	for field := range signableFields {
+		if !unsignedFields[field] && !always[field] {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// checkSignedFields returns ErrUnknownSignedField if a field can't be signed, and ErrMissingSignedField if a required
+// field, see RequiredSignedFields, is left out.
+func checkSignedFields(fields []string) error {
+	listed := make(map[string]bool)
+	for _, field := range fields {
+		if !signableFields[field] {
+			return fmt.Errorf("Field '%s': %w", field, ErrUnknownSignedField)
+		}
+		listed[field] = true
+	}
+	for _, field := range RequiredSignedFields() {
+		if !listed[field] {
+			return fmt.Errorf("Field '%s': %w", field, ErrMissingSignedField)
+		}
+	}
+	return nil
+}
+
+// ThreatSpec TMv0.1 for Container.SetSignedFields
+// Does scoping of container signature to named fields for App:Document
+
+// SetSignedFields sets the fields that signatures on the Container cover, so that transport-only fields, such as
+// "options.headers", can be changed after signing without breaking verification. Option fields are prefixed with
+// "options.". The fields must include RequiredSignedFields, which covers everything that decryption and verification
+// act on, such as the encryption inputs, validity period and claims. The signature mode, signature version and signed
+// fields are always covered. It returns ErrUnknownSignedField for names that aren't Container fields, or are the
+// signature or counter-signatures, and ErrMissingSignedField if a required field is left out.
+// Without signed fields, signatures cover everything except the signature, see SignatureVersion0.
+func (doc *Container) SetSignedFields(fields ...string) error {
+	if err := checkSignedFields(fields); err != nil {
+		return err
+	}
+	doc.Data.Options.SignedFields = fields
+	return nil
+}
+
+// ThreatSpec TMv0.1 for Container.SignatureCovers
+// Returns whether container signature covers a field for App:Document
+
+// SignatureCovers checks whether the Container signature covers the named field, using the same names as
+// SetSignedFields. Signatures without signed fields cover every field except the signature and counter-signatures.
+// It doesn't verify the signature.
+func (doc *Container) SignatureCovers(field string) bool {
+	if !signableFields[field] {
+		return false
+	}
+	if doc.Data.Options.SignatureVersion != SignatureVersionSignedFields {
+		return true
+	}
+	for _, signedField := range append(append([]string(nil), alwaysSignedFields...), doc.Data.Options.SignedFields...) {
+		if signedField == field {
+			return true
+		}
+	}
+	return false
+}
+
+// SigningVersion returns the signature version that a new signature on the Container uses:
+// SignatureVersionSignedFields if signed fields are set, otherwise CurrentSignatureVersion.
+func (doc *Container) SigningVersion() int {
+	if len(doc.Data.Options.SignedFields) > 0 {
+		return SignatureVersionSignedFields
+	}
+	return CurrentSignatureVersion
+}
+
+// signedFieldsMessage returns the canonical JSON of the signed fields: an object of the field names, including
+// alwaysSignedFields, to their values, with keys sorted. Fields that aren't set have null values.
+// Signed fields that leave out a required field return ErrMissingSignedField, so such signatures never verify.
+func (doc *Container) signedFieldsMessage() (string, error) {
+	if len(doc.Data.Options.SignedFields) == 0 {
+		return "", fmt.Errorf("Container has no signed fields")
+	}
+	if err := checkSignedFields(doc.Data.Options.SignedFields); err != nil {
+		return "", err
+	}
+
+	dumped, err := json.Marshal(doc.Data)
+	if err != nil {
+		return "", fmt.Errorf("Could not marshal container: %s", err)
+	}
+	var data map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(dumped))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return "", fmt.Errorf("Could not decode container: %s", err)
+	}
+	options, _ := data["options"].(map[string]interface{})
+
+	canonical := make(map[string]interface{})
+	fields := append(append([]string(nil), alwaysSignedFields...), doc.Data.Options.SignedFields...)
+	for _, field := range fields {
+		if name := strings.TrimPrefix(field, "options."); name != field {
+			canonical[field] = options[name]
+		} else {
+			canonical[field] = data[field]
+		}
+	}
+	message, err := json.Marshal(canonical)
+	if err != nil {
+		return "", fmt.Errorf("Could not marshal signed fields: %s", err)
+	}
+	return string(message), nil
+}
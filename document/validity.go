@@ -0,0 +1,82 @@
+// ThreatSpec package github.com/pki-io/core/document as document
+package document
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ClockSkew is the tolerance applied to a Container's validity window, so that containers aren't rejected because of
+// small clock differences between the producer and the verifier.
+var ClockSkew = 2 * time.Minute
+
+var (
+	// ErrNotYetValid is returned when a container is verified before its not-before time, less ClockSkew.
+	ErrNotYetValid = errors.New("Container isn't valid yet")
+	// ErrExpired is returned when a container is verified after its not-after time, plus ClockSkew.
+	ErrExpired = errors.New("Container has expired")
+)
+
+// Clock provides the current time for validity checks.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc is an adapter to allow the use of an ordinary function as a Clock.
+type ClockFunc func() time.Time
+
+// Now calls f().
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+var clock Clock
+
+// SetClock sets the Clock used for validity checks, such as a fixed clock in tests. A nil Clock uses the system time.
+// It should be set during initialisation, before any operations take place.
+func SetClock(c Clock) {
+	clock = c
+}
+
+// now returns the current time from the Clock set with SetClock, or the system time.
+func now() time.Time {
+	if clock == nil {
+		return time.Now()
+	}
+	return clock.Now()
+}
+
+// ThreatSpec TMv0.1 for Container.SetValidity
+// Does setting of container validity window for App:Document
+
+// SetValidity sets the window in which the Container is valid, which is checked by Verify. A zero time leaves that
+// side of the window open. The window is stored in the options with one second precision, so it must be set before signing.
+func (doc *Container) SetValidity(notBefore, notAfter time.Time) {
+	doc.Data.Options.NotBefore = 0
+	if !notBefore.IsZero() {
+		doc.Data.Options.NotBefore = notBefore.Unix()
+	}
+	doc.Data.Options.NotAfter = 0
+	if !notAfter.IsZero() {
+		doc.Data.Options.NotAfter = notAfter.Unix()
+	}
+}
+
+// ThreatSpec TMv0.1 for Container.CheckValidity
+// Mitigates App:Document against replay of expired containers with validity window check
+// Mitigates App:Document against spurious rejection from clock differences with clock skew tolerance
+
+// CheckValidity checks the Container's validity window against the current time from the Clock. ClockSkew widens the
+// window at both ends: the Container is accepted from ClockSkew before its not-before time until ClockSkew after its
+// not-after time. Before that ErrNotYetValid is returned, and after it ErrExpired.
+func (doc *Container) CheckValidity() error {
+	t := now()
+	if notBefore := doc.Data.Options.NotBefore; notBefore != 0 && t.Add(ClockSkew).Before(time.Unix(notBefore, 0)) {
+		return fmt.Errorf("Not valid before %s: %w", time.Unix(notBefore, 0).UTC().Format(time.RFC3339), ErrNotYetValid)
+	}
+	if notAfter := doc.Data.Options.NotAfter; notAfter != 0 && t.Add(-ClockSkew).After(time.Unix(notAfter, 0)) {
+		return fmt.Errorf("Not valid after %s: %w", time.Unix(notAfter, 0).UTC().Format(time.RFC3339), ErrExpired)
+	}
+	return nil
+}
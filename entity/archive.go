@@ -0,0 +1,152 @@
+// ThreatSpec package github.com/pki-io/core/entity as entity
+package entity
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pki-io/core/crypto"
+)
+
+// ArchiveVersion is the version of the archive format written by ExportArchive.
+const ArchiveVersion byte = 1
+
+// archiveMagic identifies an entity archive.
+const archiveMagic string = "PKIIOARC"
+
+// archiveParamsSize is the size of the scrypt parameters in the archive header: N, r and p as big-endian uint32s.
+const archiveParamsSize int = 12
+const archiveNonceSize int = 12
+
+// ErrInvalidArchive is returned when an archive is malformed, corrupted or the passphrase is wrong.
+var ErrInvalidArchive = errors.New("Invalid archive")
+
+// ThreatSpec TMv0.1 for ExportArchive
+// Does encrypted backup of entities for App:Entity
+// Mitigates App:Entity against archive tampering with authenticated encryption over the archive and header
+// Mitigates App:Entity against passphrase brute forcing with recorded scrypt work factor
+
+// ExportArchive serializes the entities into a single archive encrypted and authenticated with a key derived from the
+// passphrase using scrypt with the given parameters, such as crypto.DefaultScryptParams.
+//
+// The archive consists of a header (magic, version, scrypt parameters, salt length and salt), a nonce and the AES-GCM
+// ciphertext of the entity documents. The header is authenticated as additional data so any change to it is detected on import.
+func ExportArchive(entities []*Entity, passphrase string, params crypto.ScryptParams) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("Passphrase can't be empty")
+	}
+
+	documents := make([]string, 0, len(entities))
+	for _, e := range entities {
+		entityJson := e.Dump()
+		if len(entityJson) == 0 {
+			return nil, fmt.Errorf("Could not dump entity %s", e.Id())
+		}
+		documents = append(documents, entityJson)
+	}
+
+	plaintext, err := json.Marshal(documents)
+	if err != nil {
+		return nil, fmt.Errorf("Could not marshal entities: %s", err)
+	}
+
+	salt, err := crypto.RandomBytes(crypto.DefaultSaltSize)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.DeriveKeyScrypt([]byte(passphrase), salt, params)
+	if err != nil {
+		return nil, fmt.Errorf("Could not derive key: %w", err)
+	}
+
+	header := archiveHeader(params, salt)
+	ciphertext, nonce, err := crypto.AESGCMEncrypt(plaintext, key, header)
+	if err != nil {
+		return nil, fmt.Errorf("Could not encrypt archive: %s", err)
+	}
+
+	archive := new(bytes.Buffer)
+	archive.Write(header)
+	archive.Write(nonce)
+	archive.Write(ciphertext)
+	return archive.Bytes(), nil
+}
+
+// ThreatSpec TMv0.1 for ImportArchive
+// Does restore of entities from an encrypted backup for App:Entity
+// Mitigates App:Entity against resource exhaustion with upper bound on recorded work factor
+
+// ImportArchive decrypts an archive created by ExportArchive and returns the entities it contains, using the scrypt
+// parameters and salt recorded in its header. Parameters above crypto.MaxScryptParams or crypto.MaxScryptCost return
+// ErrWorkFactorTooHigh without deriving a key. It returns ErrInvalidArchive if the archive is truncated, corrupted or
+// the passphrase is wrong.
+func ImportArchive(b []byte, passphrase string) ([]*Entity, error) {
+	prefixSize := len(archiveMagic) + 1 + archiveParamsSize + 1
+	if len(b) < prefixSize {
+		return nil, fmt.Errorf("Archive is too short: %w", ErrInvalidArchive)
+	}
+
+	if string(b[:len(archiveMagic)]) != archiveMagic {
+		return nil, fmt.Errorf("Not an archive: %w", ErrInvalidArchive)
+	}
+
+	if version := b[len(archiveMagic)]; version != ArchiveVersion {
+		return nil, fmt.Errorf("Unsupported archive version %d: %w", version, ErrInvalidArchive)
+	}
+
+	rawParams := b[len(archiveMagic)+1 : len(archiveMagic)+1+archiveParamsSize]
+	params := crypto.ScryptParams{
+		N: int(binary.BigEndian.Uint32(rawParams[0:4])),
+		R: int(binary.BigEndian.Uint32(rawParams[4:8])),
+		P: int(binary.BigEndian.Uint32(rawParams[8:12])),
+	}
+	headerSize := prefixSize + int(b[prefixSize-1])
+	if len(b) < headerSize+archiveNonceSize {
+		return nil, fmt.Errorf("Archive is too short: %w", ErrInvalidArchive)
+	}
+
+	header := b[:headerSize]
+	salt := header[prefixSize:]
+	nonce := b[headerSize : headerSize+archiveNonceSize]
+	ciphertext := b[headerSize+archiveNonceSize:]
+
+	key, err := crypto.DeriveKeyScrypt([]byte(passphrase), salt, params)
+	if errors.Is(err, ErrWorkFactorTooHigh) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not derive key: %s: %w", err, ErrInvalidArchive)
+	}
+
+	plaintext, err := crypto.AESGCMDecrypt(ciphertext, nonce, key, header)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decrypt archive: %w", ErrInvalidArchive)
+	}
+
+	var documents []string
+	if err := json.Unmarshal(plaintext, &documents); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal entities: %s", err)
+	}
+
+	entities := make([]*Entity, 0, len(documents))
+	for _, entityJson := range documents {
+		e, err := New(entityJson)
+		if err != nil {
+			return nil, fmt.Errorf("Could not load entity: %s", err)
+		}
+		entities = append(entities, e)
+	}
+	return entities, nil
+}
+
+// archiveHeader returns the archive header for the given scrypt parameters and salt.
+func archiveHeader(params crypto.ScryptParams, salt []byte) []byte {
+	header := new(bytes.Buffer)
+	header.WriteString(archiveMagic)
+	header.WriteByte(ArchiveVersion)
+	binary.Write(header, binary.BigEndian, [3]uint32{uint32(params.N), uint32(params.R), uint32(params.P)})
+	header.WriteByte(byte(len(salt)))
+	header.Write(salt)
+	return header.Bytes()
+}
@@ -0,0 +1,173 @@
+// ThreatSpec package github.com/pki-io/core/entity as entity
+package entity
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"github.com/pki-io/core/crypto"
+	"time"
+)
+
+// AuditSeverity ranks audit findings.
+type AuditSeverity string
+
+// Audit severities
+const (
+	AuditSeverityLow    AuditSeverity = "low"
+	AuditSeverityMedium AuditSeverity = "medium"
+	AuditSeverityHigh   AuditSeverity = "high"
+)
+
+// MinAuditRSABits is the smallest RSA key size that Audit doesn't flag.
+const MinAuditRSABits = 3072
+
+// MinAuditCurveBits is the smallest elliptic curve size that Audit doesn't flag.
+const MinAuditCurveBits = 256
+
+// AuditFinding is a weak configuration found by Audit.
+type AuditFinding struct {
+	// Severity is how serious the finding is.
+	Severity AuditSeverity
+	// Key names the key the finding is about, such as "public-signing-key", or is empty if the finding is about the entity.
+	Key string
+	// Message describes the finding.
+	Message string
+}
+
+// ThreatSpec TMv0.1 for Entity.Audit
+// Does key strength auditing for App:Entity
+// Mitigates App:Entity against use of weak keys with reporting of short keys, weak curves, weak signature modes and reused keys
+
+// Audit inspects the entity's key material and signature mode, returning findings for weak configurations:
+// RSA keys shorter than MinAuditRSABits, curves smaller than MinAuditCurveBits, signature modes below standard strength,
+// and keys that are used for more than one purpose. Keys that can't be parsed are also reported.
+// An entity with no findings returns an empty slice.
+func (entity *Entity) Audit() []AuditFinding {
+	findings := []AuditFinding{}
+
+	keys := []struct {
+		name string
+		pem  string
+	}{
+		{"public-signing-key", entity.Data.Body.PublicSigningKey},
+		{"public-encryption-key", entity.Data.Body.PublicEncryptionKey},
+	}
+	for i, previous := range entity.Data.Body.PreviousEncryptionKeys {
+		keys = append(keys, struct {
+			name string
+			pem  string
+		}{fmt.Sprintf("previous-encryption-keys[%d]", i), previous.PublicKey})
+	}
+	for i, previous := range entity.Data.Body.PreviousSigningKeys {
+		keys = append(keys, struct {
+			name string
+			pem  string
+		}{fmt.Sprintf("previous-signing-keys[%d]", i), previous.PublicKey})
+	}
+
+	seen := make(map[string]string)
+	for _, key := range keys {
+		if len(key.pem) == 0 {
+			continue
+		}
+		publicKey, err := crypto.PemDecodePublic([]byte(key.pem))
+		if err != nil {
+			findings = append(findings, AuditFinding{AuditSeverityHigh, key.name, fmt.Sprintf("Could not parse key: %s", err)})
+			continue
+		}
+		findings = append(findings, auditKey(key.name, publicKey)...)
+
+		if fingerprint, err := crypto.Fingerprint(publicKey); err == nil {
+			if other, ok := seen[fingerprint]; ok {
+				findings = append(findings, AuditFinding{AuditSeverityHigh, key.name, fmt.Sprintf("Key is reused as %s", other)})
+			} else {
+				seen[fingerprint] = key.name
+			}
+		}
+	}
+
+	if mode, err := entity.signatureMode(); err != nil {
+		findings = append(findings, AuditFinding{AuditSeverityHigh, "", err.Error()})
+	} else if crypto.ModeStrength(mode) < crypto.SignatureStrengthStandard {
+		findings = append(findings, AuditFinding{AuditSeverityLow, "", fmt.Sprintf("Signature mode '%s' is below standard strength", mode)})
+	}
+
+	return findings
+}
+
+// auditKey returns findings for the strength of a single public key.
+func auditKey(name string, publicKey interface{}) []AuditFinding {
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		if bits := k.N.BitLen(); bits < MinAuditRSABits {
+			return []AuditFinding{{AuditSeverityMedium, name, fmt.Sprintf("RSA key is %d bits, less than %d", bits, MinAuditRSABits)}}
+		}
+	case *ecdsa.PublicKey:
+		if bits := k.Curve.Params().BitSize; bits < MinAuditCurveBits {
+			return []AuditFinding{{AuditSeverityHigh, name, fmt.Sprintf("Curve %s is %d bits, less than %d", k.Curve.Params().Name, bits, MinAuditCurveBits)}}
+		}
+	default:
+		return []AuditFinding{{AuditSeverityHigh, name, fmt.Sprintf("Unsupported key type %T", k)}}
+	}
+	return nil
+}
+
+// Operations reported in AuditEvents
+const (
+	AuditOperationGenerateKeys         = crypto.OperationGenerateKeys
+	AuditOperationSign                 = crypto.OperationSign
+	AuditOperationVerify               = crypto.OperationVerify
+	AuditOperationDecrypt              = crypto.OperationDecrypt
+	AuditOperationRotateSigningKeys    = "rotate-signing-keys"
+	AuditOperationRotateEncryptionKeys = "rotate-encryption-keys"
+)
+
+// AuditEvent is a security relevant outcome reported to the logger set with SetAuditLogger.
+type AuditEvent struct {
+	// Time is when the operation finished.
+	Time time.Time
+	// Operation is the operation, such as AuditOperationVerify.
+	Operation string
+	// EntityId is the id of the entity performing the operation.
+	EntityId string
+	// SignerId is the source of the container for verification and decryption, and the entity id for signing.
+	// It is empty for key operations.
+	SignerId string
+	// Err is the error returned by the operation, or nil if it succeeded.
+	Err error
+}
+
+var auditLogger func(event AuditEvent)
+
+// ThreatSpec TMv0.1 for SetAuditLogger
+// Does reporting of security events for App:Entity
+
+// SetAuditLogger sets a function that is called with an AuditEvent for each signature verification, decryption and
+// signing, key generation and key rotation, whether it succeeds or fails, for example to forward to a SIEM. This
+// includes verification through VerifyAll, Verifier and MACs, and decryption through DecryptSplit and DecryptSession.
+// A nil logger disables reporting, and no events are built. It should be set during initialisation, before any
+// operations take place.
+func SetAuditLogger(logger func(event AuditEvent)) {
+	auditLogger = logger
+}
+
+// logAudit reports the outcome of an operation to the audit logger, if one is set.
+func (entity *Entity) logAudit(operation, signerId string, err error) {
+	logAuditEvent(entity.Data.Body.Id, operation, signerId, err)
+}
+
+// logAuditEvent reports the outcome of an operation by the entity with the given id to the audit logger, if one is set.
+// It is used where there is no Entity, such as by Verifier and DecryptSession.
+func logAuditEvent(entityId, operation, signerId string, err error) {
+	if auditLogger == nil {
+		return
+	}
+	auditLogger(AuditEvent{
+		Time:      time.Now(),
+		Operation: operation,
+		EntityId:  entityId,
+		SignerId:  signerId,
+		Err:       err,
+	})
+}
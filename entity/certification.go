@@ -0,0 +1,159 @@
+// ThreatSpec package github.com/pki-io/core/entity as entity
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pki-io/core/document"
+	"github.com/pki-io/core/revocation"
+)
+
+// CertificationType is the container type used for entity certifications.
+const CertificationType string = "entity-certification"
+
+// RevocationListType is the container type used for signed revocation lists.
+const RevocationListType string = "revocation-list"
+
+// ErrRevoked is returned when a certified entity has been revoked by its issuer.
+var ErrRevoked = errors.New("Entity has been revoked")
+
+// ThreatSpec TMv0.1 for Entity.Certify
+// Does certification of subject entities for App:Entity
+// Mitigates App:Entity against disclosure of subject private keys with certification of the public entity only
+
+// Certify vouches for the subject by signing its public entity document, returning an entity certification container.
+func (entity *Entity) Certify(subject *Entity) (*document.Container, error) {
+	publicJson := subject.DumpPublic()
+	if len(publicJson) == 0 {
+		return nil, fmt.Errorf("Could not dump public subject %s", subject.Id())
+	}
+
+	container, err := document.NewContainer(nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create container: %s", err)
+	}
+	container.Data.Type = CertificationType
+	container.Data.Options.Source = entity.Data.Body.Id
+	container.Data.Body = publicJson
+	container.SetContentDigest()
+	if err := entity.Sign(container); err != nil {
+		return nil, fmt.Errorf("Could not sign container: %s", err)
+	}
+	return container, nil
+}
+
+// ThreatSpec TMv0.1 for VerifyCertification
+// Does verification of entity certifications for App:Entity
+// Mitigates App:Entity against forged certifications with issuer signature verification
+
+// VerifyCertification verifies that the container is an entity certification signed by the issuer,
+// returning the certified public subject entity.
+// It returns ErrTypeMismatch if the container isn't an entity certification.
+//
+// If revocation lists are given, they must have been issued by the issuer, for example by using VerifyRevocationList,
+// and ErrRevoked is returned if any of them revokes the subject.
+func VerifyCertification(container *document.Container, issuer *Entity, lists ...*revocation.RevocationList) (*Entity, error) {
+	if container.Data.Type != CertificationType {
+		return nil, fmt.Errorf("Container isn't an entity certification: %w", ErrTypeMismatch)
+	}
+
+	if container.Data.Options.Source != issuer.Id() {
+		return nil, fmt.Errorf("Certification source '%s' isn't the issuer '%s': %w", container.Data.Options.Source, issuer.Id(), ErrVerificationFailed)
+	}
+
+	if err := issuer.Verify(container); err != nil {
+		return nil, fmt.Errorf("Could not verify certification: %w", err)
+	}
+
+	subject, err := New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create subject: %s", err)
+	}
+	if err := subject.LoadPublic(container.Data.Body); err != nil {
+		return nil, fmt.Errorf("Could not load subject: %w", err)
+	}
+
+	for _, list := range lists {
+		if list.IssuerId() != issuer.Id() {
+			return nil, fmt.Errorf("Revocation list issuer '%s' isn't the issuer '%s'", list.IssuerId(), issuer.Id())
+		}
+		if subject.IsRevoked(list) {
+			return nil, ErrRevoked
+		}
+	}
+	return subject, nil
+}
+
+// ThreatSpec TMv0.1 for Entity.ToSignedContainer
+// Does signed distribution of public entities for App:Entity
+
+// ToSignedContainer returns the entity's public document in a container signed by the issuer, for tamper-evident
+// distribution. It is the same as issuer.Certify(entity), and the container can be read with FromSignedContainer.
+func (entity *Entity) ToSignedContainer(issuer *Entity) (*document.Container, error) {
+	return issuer.Certify(entity)
+}
+
+// ThreatSpec TMv0.1 for FromSignedContainer
+// Does verification of signed public entities for App:Entity
+// Mitigates App:Entity against tampered entity distribution with issuer signature verification
+
+// FromSignedContainer verifies a container from ToSignedContainer with the issuer and returns the public entity.
+// It is the same as VerifyCertification without revocation lists.
+func FromSignedContainer(container *document.Container, issuer *Entity) (*Entity, error) {
+	return VerifyCertification(container, issuer)
+}
+
+// IsRevoked checks whether the entity is revoked by the revocation list.
+func (entity *Entity) IsRevoked(list *revocation.RevocationList) bool {
+	return list.IsRevoked(entity.Id())
+}
+
+// ThreatSpec TMv0.1 for Entity.SignRevocationList
+// Does revocation list signing for App:Entity
+
+// SignRevocationList sets the entity as the issuer of the revocation list and signs it, returning a revocation list container.
+func (entity *Entity) SignRevocationList(list *revocation.RevocationList) (*document.Container, error) {
+	list.Data.Body.IssuerId = entity.Data.Body.Id
+	listJson := list.Dump()
+	if len(listJson) == 0 {
+		return nil, fmt.Errorf("Could not dump revocation list")
+	}
+
+	container, err := document.NewContainer(nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create container: %s", err)
+	}
+	container.Data.Type = RevocationListType
+	container.Data.Options.Source = entity.Data.Body.Id
+	container.Data.Body = listJson
+	container.SetContentDigest()
+	if err := entity.Sign(container); err != nil {
+		return nil, fmt.Errorf("Could not sign container: %s", err)
+	}
+	return container, nil
+}
+
+// ThreatSpec TMv0.1 for VerifyRevocationList
+// Does verification of signed revocation lists for App:Entity
+// Mitigates App:Entity against forged revocation lists with issuer signature verification
+
+// VerifyRevocationList verifies that the container is a revocation list signed by the issuer, returning the revocation list.
+// It returns ErrTypeMismatch if the container isn't a revocation list.
+func VerifyRevocationList(container *document.Container, issuer *Entity) (*revocation.RevocationList, error) {
+	if container.Data.Type != RevocationListType {
+		return nil, fmt.Errorf("Container isn't a revocation list: %w", ErrTypeMismatch)
+	}
+
+	if err := issuer.Verify(container); err != nil {
+		return nil, fmt.Errorf("Could not verify revocation list: %w", err)
+	}
+
+	list, err := revocation.New(container.Data.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load revocation list: %w", err)
+	}
+	if list.IssuerId() != issuer.Id() {
+		return nil, fmt.Errorf("Revocation list issuer '%s' isn't the issuer '%s': %w", list.IssuerId(), issuer.Id(), ErrVerificationFailed)
+	}
+	return list, nil
+}
@@ -0,0 +1,29 @@
+// ThreatSpec package github.com/pki-io/core/entity as entity
+package entity
+
+import (
+	"fmt"
+	"github.com/pki-io/core/document"
+)
+
+// ThreatSpec TMv0.1 for VerifyChain
+// Does verification of container chains for App:Entity
+// Mitigates App:Entity against reordering or substitution of workflow steps with signed references to predecessors
+
+// VerifyChain checks that each container in the chain is signed and references the container before it,
+// returning ErrBrokenChain if a link is missing.
+// Only the links are checked: each container's signature must also be verified with its signer, for example by using Verify.
+func VerifyChain(containers []*document.Container) error {
+	for i, container := range containers {
+		if !container.IsSigned() {
+			return fmt.Errorf("Container %d isn't signed: %w", i, ErrBrokenChain)
+		}
+		if i == 0 {
+			continue
+		}
+		if !container.References(containers[i-1]) {
+			return fmt.Errorf("Container %d doesn't reference container %d: %w", i, i-1, ErrBrokenChain)
+		}
+	}
+	return nil
+}
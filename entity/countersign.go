@@ -0,0 +1,152 @@
+// ThreatSpec package github.com/pki-io/core/entity as entity
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pki-io/core/crypto"
+	"github.com/pki-io/core/document"
+)
+
+// ErrUnknownSigner is returned by VerifyAll when a signer isn't in the keyring.
+var ErrUnknownSigner = errors.New("Unknown signer")
+
+// ThreatSpec TMv0.1 for Entity.CounterSign
+// Does container counter-signing for App:Entity
+
+// CounterSign adds a counter-signature by the entity to a signed container, see document.Container.CounterSignatureMessage.
+// The container must have a public key signature, and each entity may only counter-sign once.
+// Signing the container again removes its counter-signatures.
+func (entity *Entity) CounterSign(container *document.Container) error {
+	defer crypto.Observe(crypto.OperationSign, crypto.StartTimer())
+	if container.IsSigned() == false {
+		return fmt.Errorf("Container isn't signed")
+	}
+	if scheme, err := crypto.LookupMode(crypto.Mode(container.Data.Options.SignatureMode)); err != nil || !scheme.IsPublicKey() {
+		return fmt.Errorf("Container with signature mode '%s' can't be counter-signed", container.Data.Options.SignatureMode)
+	}
+	for _, counterSignature := range container.Data.Options.CounterSignatures {
+		if counterSignature.Signer == entity.Data.Body.Id {
+			return fmt.Errorf("Container is already counter-signed by '%s'", entity.Data.Body.Id)
+		}
+	}
+
+	signatureMode, err := entity.signatureMode()
+	if err != nil {
+		return err
+	}
+	signature := crypto.NewSignature(signatureMode)
+	message := container.CounterSignatureMessage()
+	if err := entity.signer().Sign(message, signature); err != nil {
+		return fmt.Errorf("Could not counter-sign container json: %s", err)
+	}
+
+	container.Data.Options.CounterSignatures = append(container.Data.Options.CounterSignatures, document.CounterSignature{
+		Signer:    entity.Data.Body.Id,
+		Mode:      string(signature.Mode),
+		Signature: signature.Signature,
+	})
+	return nil
+}
+
+// ThreatSpec TMv0.1 for Entity.VerifyCounterSignature
+// Does container counter-signature verification for App:Entity
+
+// VerifyCounterSignature verifies the entity's counter-signature on the container. It doesn't verify the container signature.
+// The same mode and strength checks as Verify apply, and failures return ErrVerificationFailed.
+func (entity *Entity) VerifyCounterSignature(container *document.Container) error {
+	for _, counterSignature := range container.Data.Options.CounterSignatures {
+		if counterSignature.Signer == entity.Data.Body.Id {
+			return entity.verifyCounterSignature(container, counterSignature)
+		}
+	}
+	return fmt.Errorf("Container isn't counter-signed by '%s': %w", entity.Data.Body.Id, ErrVerificationFailed)
+}
+
+// verifyCounterSignature verifies a counter-signature on the container using the entity's public key.
+func (entity *Entity) verifyCounterSignature(container *document.Container, counterSignature document.CounterSignature) (err error) {
+	defer crypto.Observe(crypto.OperationVerify, crypto.StartTimer())
+	defer func() { entity.logAudit(AuditOperationVerify, counterSignature.Signer, err) }()
+	declaredMode := crypto.Mode(counterSignature.Mode)
+	if err := entity.checkSignatureMode(declaredMode); err != nil {
+		return err
+	}
+
+	signature := crypto.NewSignature(declaredMode)
+	signature.Message = container.CounterSignatureMessage()
+	signature.Signature = counterSignature.Signature
+	if err := crypto.Verify(signature, []byte(entity.Data.Body.PublicSigningKey)); err != nil {
+		return fmt.Errorf("Could not verify counter-signature: %s: %w", err, ErrVerificationFailed)
+	}
+	return nil
+}
+
+// SignatureReport summarises the verification of each signature on a container.
+type SignatureReport struct {
+	// Verified are the ids of signers whose signatures verified.
+	Verified []string
+	// Failed are the ids of signers whose signatures didn't verify.
+	Failed []string
+	// Unknown are the ids of signers that aren't in the keyring.
+	Unknown []string
+}
+
+// ThreatSpec TMv0.1 for VerifyReport
+// Does verification of all container signatures for App:Entity
+
+// VerifyReport verifies the container signature and each counter-signature using the signers in the keyring, such as a Keyring
+// or KeyringSnapshot, and reports which signers verified, which failed and which are unknown. The container signer is identified
+// by the source option and comes first, followed by the counter-signers in the order they signed.
+func VerifyReport(container *document.Container, keyring EntityLookup) *SignatureReport {
+	report := new(SignatureReport)
+	for _, entry := range container.Signatures() {
+		if signer, ok := keyring.Get(entry.Signer); !ok {
+			report.Unknown = append(report.Unknown, entry.Signer)
+		} else if err := signer.verifySignatureEntry(container, entry); err != nil {
+			report.Failed = append(report.Failed, signer.Id())
+		} else {
+			report.Verified = append(report.Verified, signer.Id())
+		}
+	}
+	return report
+}
+
+// ThreatSpec TMv0.1 for VerifyAll
+// Does verification of all container signatures for App:Entity
+// Mitigates App:Entity against partially verified multi-signed containers with every signature required to verify
+
+// VerifyAll verifies every signature on the container, see document.Container.Signatures, using the signers in the keyring.
+// Each signature is verified with the mode it records, which must suit its signer's key type, so signers with different
+// key types can sign the same container. Containers with only a container signature verify as before.
+// It returns ErrUnknownSigner if a signer isn't in the keyring and ErrVerificationFailed if any signature doesn't verify.
+func VerifyAll(container *document.Container, keyring EntityLookup) error {
+	signatures := container.Signatures()
+	if len(signatures) == 0 {
+		return fmt.Errorf("Container isn't signed")
+	}
+	for _, entry := range signatures {
+		signer, ok := keyring.Get(entry.Signer)
+		if !ok {
+			return fmt.Errorf("Signer '%s': %w", entry.Signer, ErrUnknownSigner)
+		}
+		if err := signer.verifySignatureEntry(container, entry); err != nil {
+			return fmt.Errorf("Signer '%s': %w", entry.Signer, err)
+		}
+	}
+	return nil
+}
+
+// verifySignatureEntry verifies a signature entry from document.Container.Signatures using the entity's public key,
+// reporting an audit event for it.
+func (entity *Entity) verifySignatureEntry(container *document.Container, entry document.SignatureEntry) error {
+	if !entry.Counter {
+		err := entity.verify(container)
+		entity.logAudit(AuditOperationVerify, entry.Signer, err)
+		return err
+	}
+	return entity.verifyCounterSignature(container, document.CounterSignature{
+		Signer:    entry.Signer,
+		Mode:      entry.Mode,
+		Signature: entry.Signature,
+	})
+}
@@ -2,12 +2,21 @@
 package entity
 
 import (
+	gocrypto "crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
 	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"github.com/pki-io/core/crypto"
 	"github.com/pki-io/core/document"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 // EntityDefault provides default values for Entity.
@@ -85,12 +94,323 @@ const EntitySchema string = `{
               "private-encryption-key" : {
                   "description": "Private encryption key",
                   "type": "string"
+              },
+              "roles" : {
+                  "description": "Roles asserted by the entity, such as ca, admin or node",
+                  "type": "array",
+                  "items": {
+                      "type": "string"
+                  }
+              },
+              "private-key-protection" : {
+                  "description": "Passphrase protection of the private keys",
+                  "type": "object",
+                  "required": ["kdf", "salt", "n", "r", "p"],
+                  "additionalProperties": false,
+                  "properties": {
+                      "kdf": {
+                          "description": "Key derivation function",
+                          "type": "string"
+                      },
+                      "salt": {
+                          "description": "Base64 encoded salt",
+                          "type": "string"
+                      },
+                      "n": {
+                          "description": "Scrypt CPU and memory cost",
+                          "type": "integer"
+                      },
+                      "r": {
+                          "description": "Scrypt block size",
+                          "type": "integer"
+                      },
+                      "p": {
+                          "description": "Scrypt parallelisation",
+                          "type": "integer"
+                      }
+                  }
+              },
+              "previous-encryption-keys" : {
+                  "description": "Encryption keys replaced by key rotation, oldest first",
+                  "type": "array",
+                  "items": {
+                      "type": "object",
+                      "required": ["public-key", "private-key", "retired"],
+                      "additionalProperties": false,
+                      "properties": {
+                          "public-key": {
+                              "description": "Public key",
+                              "type": "string"
+                          },
+                          "private-key": {
+                              "description": "Private key",
+                              "type": "string"
+                          },
+                          "activated": {
+                              "description": "Unix time the key became current",
+                              "type": "integer"
+                          },
+                          "retired": {
+                              "description": "Unix time the key was replaced",
+                              "type": "integer"
+                          }
+                      }
+                  }
+              },
+              "previous-signing-keys" : {
+                  "description": "Signing keys replaced by key rotation, oldest first",
+                  "type": "array",
+                  "items": {
+                      "type": "object",
+                      "required": ["public-key", "retired"],
+                      "additionalProperties": false,
+                      "properties": {
+                          "public-key": {
+                              "description": "Public key",
+                              "type": "string"
+                          },
+                          "activated": {
+                              "description": "Unix time the key became current",
+                              "type": "integer"
+                          },
+                          "retired": {
+                              "description": "Unix time the key was replaced",
+                              "type": "integer"
+                          }
+                      }
+                  }
+              }
+          }
+      }
+  }
+}`
+
+// EntityPublicSchema defines the JSON Schema for a public Entity, which has no private keys. The private key fields
+// may be present, as Dump writes them, but must be empty.
+const EntityPublicSchema string = `{
+  "$schema": "http://json-schema.org/draft-04/schema#",
+  "title": "EntityPublicDocument",
+  "description": "Public Entity Document",
+  "type": "object",
+  "required": ["scope","version","type","options","body"],
+  "additionalProperties": false,
+  "properties": {
+      "scope": {
+          "description": "Scope of the document",
+          "type": "string"
+      },
+      "version": {
+          "description": "Document schema version",
+          "type": "integer"
+      },
+      "type": {
+          "description": "Type of document",
+          "type": "string"
+      },
+      "options": {
+          "description": "Options data",
+          "type": "string"
+      },
+      "body": {
+          "description": "Body data",
+          "type": "object",
+          "required": ["id", "name", "key-type", "public-signing-key", "public-encryption-key"],
+          "additionalProperties": false,
+          "properties": {
+              "id" : {
+                  "description": "Entity ID",
+                  "type": "string"
+              },
+              "name" : {
+                  "description": "Entity name",
+                  "type": "string"
+              },
+              "key-type": {
+                  "description": "Key type. Either rsa or ec",
+                  "type": "string"
+              },
+              "public-signing-key" : {
+                  "description": "Public signing key",
+                  "type": "string"
+              },
+              "private-signing-key" : {
+                  "description": "Private signing key, which must be empty",
+                  "type": "string",
+                  "maxLength": 0
+              },
+              "public-encryption-key" : {
+                  "description": "Public encryption key",
+                  "type": "string"
+              },
+              "private-encryption-key" : {
+                  "description": "Private encryption key, which must be empty",
+                  "type": "string",
+                  "maxLength": 0
+              },
+              "roles" : {
+                  "description": "Roles asserted by the entity, such as ca, admin or node",
+                  "type": "array",
+                  "items": {
+                      "type": "string"
+                  }
+              },
+              "previous-encryption-keys" : {
+                  "description": "Encryption keys replaced by key rotation, oldest first",
+                  "type": "array",
+                  "items": {
+                      "type": "object",
+                      "required": ["public-key", "retired"],
+                      "additionalProperties": false,
+                      "properties": {
+                          "public-key": {
+                              "description": "Public key",
+                              "type": "string"
+                          },
+                          "activated": {
+                              "description": "Unix time the key became current",
+                              "type": "integer"
+                          },
+                          "retired": {
+                              "description": "Unix time the key was replaced",
+                              "type": "integer"
+                          }
+                      }
+                  }
+              },
+              "previous-signing-keys" : {
+                  "description": "Signing keys replaced by key rotation, oldest first",
+                  "type": "array",
+                  "items": {
+                      "type": "object",
+                      "required": ["public-key", "retired"],
+                      "additionalProperties": false,
+                      "properties": {
+                          "public-key": {
+                              "description": "Public key",
+                              "type": "string"
+                          },
+                          "activated": {
+                              "description": "Unix time the key became current",
+                              "type": "integer"
+                          },
+                          "retired": {
+                              "description": "Unix time the key was replaced",
+                              "type": "integer"
+                          }
+                      }
+                  }
               }
           }
       }
   }
 }`
 
+// Compiled entity schemas by schema, shared by all entities. See schemaValidator.
+var (
+	compileSchemasOnce sync.Once
+	schemaValidators   map[string]*document.Validator
+	compileSchemasErr  error
+)
+
+// schemaValidator returns the compiled schema, one of EntitySchema, EntityPublicSchema or EntityLenientSchema.
+// The schemas are compiled together on first use.
+func schemaValidator(schema string) (*document.Validator, error) {
+	compileSchemasOnce.Do(func() {
+		validators := make(map[string]*document.Validator)
+		for _, schema := range []string{EntitySchema, EntityPublicSchema, EntityLenientSchema} {
+			if validators[schema], compileSchemasErr = document.CompileSchema(schema); compileSchemasErr != nil {
+				return
+			}
+		}
+		schemaValidators = validators
+	})
+	if compileSchemasErr != nil {
+		return nil, compileSchemasErr
+	}
+	return schemaValidators[schema], nil
+}
+
+var (
+	// ErrVerificationFailed is returned when a container signature does not verify. It is the same error as document.ErrVerificationFailed.
+	ErrVerificationFailed = document.ErrVerificationFailed
+	// ErrMalformedContainer is returned when a container can't be decoded. It is the same error as document.ErrMalformedContainer.
+	ErrMalformedContainer = document.ErrMalformedContainer
+	// ErrMissingNonce is returned when a container expected to be fresh has no signed nonce.
+	ErrMissingNonce = errors.New("Container has no nonce")
+	// ErrReplayDetected is returned when a container's nonce has already been seen.
+	ErrReplayDetected = errors.New("Container nonce has already been seen")
+	// ErrKeysAlreadyExist is returned when generating keys for an entity that already has keys.
+	ErrKeysAlreadyExist = errors.New("Entity keys already exist")
+	// ErrChallengeMismatch is returned when a container isn't a response to the expected challenge.
+	ErrChallengeMismatch = errors.New("Container doesn't match challenge")
+	// ErrSignatureModeMismatch is returned when a container's signature mode doesn't match the signer's key type.
+	ErrSignatureModeMismatch = errors.New("Signature mode doesn't match key type")
+	// ErrSignatureTooWeak is returned when a container's signature mode is below the minimum signature strength.
+	ErrSignatureTooWeak = errors.New("Signature mode is too weak")
+	// ErrScopeMismatch is returned when a loaded document's scope isn't the expected scope.
+	ErrScopeMismatch = errors.New("Document scope doesn't match")
+	// ErrTypeMismatch is returned when a loaded document's type isn't the expected type.
+	ErrTypeMismatch = errors.New("Document type doesn't match")
+	// ErrContextMismatch is returned when a container wasn't signed with the expected context.
+	ErrContextMismatch = errors.New("Signature context doesn't match")
+	// ErrClaimMismatch is returned when a container's signed claims don't include a required claim.
+	ErrClaimMismatch = errors.New("Signed claim doesn't match")
+	// ErrBrokenChain is returned when a container in a chain doesn't reference its predecessor.
+	ErrBrokenChain = errors.New("Container chain is broken")
+	// ErrAlreadySigned is returned when a signed container is encrypted. It is the same error as document.ErrAlreadySigned.
+	ErrAlreadySigned = document.ErrAlreadySigned
+	// ErrNotSealedForSelf is returned by OpenSelf when a container isn't from the entity or isn't encrypted for it alone.
+	ErrNotSealedForSelf = errors.New("Container isn't sealed for self")
+	// ErrNoKeyAtTime is returned by VerifyAt when none of the entity's signing keys was current at the given time.
+	ErrNoKeyAtTime = errors.New("No signing key current at time")
+	// ErrContentTypeMismatch is returned when a container's content type isn't the expected content type.
+	ErrContentTypeMismatch = errors.New("Content type doesn't match")
+	// ErrWeakSalt is returned when a container's signature salt is too short. It is the same error as crypto.ErrWeakSalt.
+	ErrWeakSalt = crypto.ErrWeakSalt
+	// ErrFingerprintMismatch is returned by VerifyPinned when the signing key isn't the pinned key.
+	ErrFingerprintMismatch = errors.New("Key fingerprint doesn't match")
+	// ErrNoRecipients is returned when encrypting for an empty, non-nil set of recipients. It is the same error as crypto.ErrNoRecipients.
+	ErrNoRecipients = crypto.ErrNoRecipients
+	// ErrInvalidRecipient is returned when a recipient can't be encrypted for. It is the same error as crypto.ErrInvalidRecipient.
+	ErrInvalidRecipient = crypto.ErrInvalidRecipient
+	// ErrDuplicateRecipient is returned when recipients share an id. It is the same error as crypto.ErrDuplicateRecipient.
+	ErrDuplicateRecipient = crypto.ErrDuplicateRecipient
+)
+
+// minSignatureStrength is the minimum signature strength accepted by Verify.
+var minSignatureStrength = crypto.SignatureStrengthNone
+
+// ThreatSpec TMv0.1 for SetMinSignatureStrength
+// Mitigates App:Entity against signature downgrade with minimum signature strength policy
+
+// SetMinSignatureStrength sets the minimum signature strength that Verify accepts.
+// For example, crypto.SignatureStrengthStandard refuses PKCS#1 v1.5 RSA signatures.
+// It should be set during initialisation, before any verification takes place.
+func SetMinSignatureStrength(strength crypto.SignatureStrength) {
+	minSignatureStrength = strength
+}
+
+// defaultKeyType is the key type of new entities created without JSON input.
+var defaultKeyType = crypto.KeyTypeEC
+
+// ThreatSpec TMv0.1 for SetDefaultKeyType
+// Does setting of default key type for App:Entity
+
+// SetDefaultKeyType sets the key type of entities created without JSON input, such as with New(nil), instead of the
+// "ec" key type in EntityDefault. The key type is normalised as by crypto.ParseKeyType, which returns crypto.ErrInvalidKeyType
+// for unsupported key types. It should be set during initialisation, before any entities are created.
+func SetDefaultKeyType(kt string) error {
+	keyType, err := crypto.ParseKeyType(kt)
+	if err != nil {
+		return err
+	}
+	defaultKeyType = keyType
+	return nil
+}
+
+// ChallengeResponseType is the container type used for challenge responses.
+const ChallengeResponseType string = "challenge-response"
+
 type Encrypter interface {
 	Id() string
 	Body() EntityBody
@@ -105,14 +425,30 @@ type Decrypter interface {
 	VerifyThenDecrypt(*document.Container) (string, error)
 }
 
+// PreviousKey is a key pair that has been replaced by key rotation.
+type PreviousKey struct {
+	PublicKey  string `json:"public-key"`
+	PrivateKey string `json:"private-key,omitempty"`
+	// Activated is the Unix time the key became current. Zero means the key was current from the start.
+	Activated int64 `json:"activated,omitempty"`
+	Retired   int64 `json:"retired"`
+}
+
 type EntityBody struct {
-	Id                   string `json:"id"`
-	Name                 string `json:"name"`
-	KeyType              string `json:"key-type"`
-	PublicSigningKey     string `json:"public-signing-key"`
-	PrivateSigningKey    string `json:"private-signing-key"`
-	PublicEncryptionKey  string `json:"public-encryption-key"`
-	PrivateEncryptionKey string `json:"private-encryption-key"`
+	Id                     string        `json:"id"`
+	Name                   string        `json:"name"`
+	KeyType                string        `json:"key-type"`
+	PublicSigningKey       string        `json:"public-signing-key"`
+	PrivateSigningKey      string        `json:"private-signing-key"`
+	PublicEncryptionKey    string        `json:"public-encryption-key"`
+	PrivateEncryptionKey   string        `json:"private-encryption-key"`
+	PreviousEncryptionKeys []PreviousKey `json:"previous-encryption-keys,omitempty"`
+	PreviousSigningKeys    []PreviousKey `json:"previous-signing-keys,omitempty"`
+	Roles                  []string      `json:"roles,omitempty"`
+	// PrivateKeyProtection is set while the private keys are encrypted with a passphrase, see EncryptPrivateKeys.
+	PrivateKeyProtection *KeyProtection `json:"private-key-protection,omitempty"`
+	// Extra holds unknown body fields kept by LoadLenient, which are written back by Dump.
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 // EntityData represents parsed Entity JSON data.
@@ -127,7 +463,10 @@ type EntityData struct {
 // Entity participates in cryptographic operations, sending and receiving secured data.
 type Entity struct {
 	document.Document
-	Data EntityData
+	Data          EntityData
+	signerBackend crypto.Signer
+	expectedScope string
+	expectedType  string
 }
 
 // ThreatSpec TMv0.1 for New
@@ -137,7 +476,7 @@ type Entity struct {
 func New(jsonString interface{}) (*Entity, error) {
 	entity := new(Entity)
 	if err := entity.New(jsonString); err != nil {
-		return nil, fmt.Errorf("Couldn't create new entity: %s", err)
+		return nil, fmt.Errorf("Couldn't create new entity: %w", err)
 	} else {
 		return entity, nil
 	}
@@ -146,12 +485,17 @@ func New(jsonString interface{}) (*Entity, error) {
 // ThreatSpec TMv0.1 for Entity.New
 // Does entity initialisation for App:Entity
 
-// New initializes the entity.
+// New initializes the entity. The schema is compiled once and shared by all entities.
 func (entity *Entity) New(jsonString interface{}) error {
+	validator, err := schemaValidator(EntitySchema)
+	if err != nil {
+		return err
+	}
 	entity.Schema = EntitySchema
 	entity.Default = EntityDefault
+	entity.Validator = validator
 	if err := entity.Load(jsonString); err != nil {
-		return fmt.Errorf("Could not create new Entity: %s", err)
+		return fmt.Errorf("Could not create new Entity: %w", err)
 	} else {
 		return nil
 	}
@@ -160,17 +504,105 @@ func (entity *Entity) New(jsonString interface{}) error {
 // ThreatSpec TMv0.1 for Entity.Load
 // Does entity JSON loading for App:Entity
 
-// Load takes a JSON string and sets the entity data.
+// Load takes JSON as a string, []byte or json.RawMessage and sets the entity data.
+// Any other input type returns document.ErrUnsupportedInput.
+//
+// The key type is normalised, so that case, surrounding whitespace and aliases such as "ecdsa" are accepted.
+// An unsupported key type returns crypto.ErrInvalidKeyType. An empty key type is left as is.
+// Public keys that are malformed or weak, such as EC points not on the curve, return crypto.ErrInvalidPublicKey.
+// Without JSON input, the key type set by SetDefaultKeyType is used.
 func (entity *Entity) Load(jsonString interface{}) error {
+	return entity.load(&entity.Document, jsonString)
+}
+
+// ThreatSpec TMv0.1 for Entity.LoadPublic
+// Does public entity JSON loading for App:Entity
+// Mitigates App:Entity against accidental private key disclosure with schema rejecting private keys
+
+// LoadPublic is like Load, but validates the JSON against EntityPublicSchema, so documents containing private keys are rejected.
+// The entity keeps using EntityPublicSchema afterwards, so that it can be dumped without private keys.
+func (entity *Entity) LoadPublic(jsonString interface{}) error {
+	validator, err := schemaValidator(EntityPublicSchema)
+	if err != nil {
+		return err
+	}
+	entity.Schema = EntityPublicSchema
+	entity.Validator = validator
+	return entity.load(&entity.Document, jsonString)
+}
+
+// ThreatSpec TMv0.1 for Entity.ExpectScope
+// Mitigates App:Entity against loading of cross-tenant documents with scope check on load
+
+// ExpectScope sets the scope that documents must have to be loaded by Load and LoadPublic.
+// Documents with a different scope return ErrScopeMismatch. An empty scope disables the check.
+func (entity *Entity) ExpectScope(scope string) {
+	entity.expectedScope = scope
+}
+
+// ThreatSpec TMv0.1 for Entity.ExpectType
+// Mitigates App:Entity against loading of foreign documents with type check on load
+
+// ExpectType sets the type that documents must have to be loaded by Load and LoadPublic.
+// Documents with a different type return ErrTypeMismatch. An empty type disables the check.
+func (entity *Entity) ExpectType(docType string) {
+	entity.expectedType = docType
+}
+
+// load parses the JSON using the given document schema and sets the entity data.
+func (entity *Entity) load(doc *document.Document, jsonString interface{}) error {
 	data := new(EntityData)
-	if data, err := entity.FromJson(jsonString, data); err != nil {
-		return fmt.Errorf("Could not load entity JSON: %s", err)
+	if data, err := doc.FromJson(jsonString, data); err != nil {
+		return fmt.Errorf("Could not load entity JSON: %w", err)
 	} else {
-		entity.Data = *data.(*EntityData)
+		entityData := data.(*EntityData)
+		if len(entity.expectedScope) > 0 && entityData.Scope != entity.expectedScope {
+			return fmt.Errorf("Expected scope '%s' but got '%s': %w", entity.expectedScope, entityData.Scope, ErrScopeMismatch)
+		}
+		if len(entity.expectedType) > 0 && entityData.Type != entity.expectedType {
+			return fmt.Errorf("Expected type '%s' but got '%s': %w", entity.expectedType, entityData.Type, ErrTypeMismatch)
+		}
+		if jsonString == nil {
+			entityData.Body.KeyType = string(defaultKeyType)
+		} else if len(entityData.Body.KeyType) > 0 {
+			keyType, err := crypto.ParseKeyType(entityData.Body.KeyType)
+			if err != nil {
+				return fmt.Errorf("Could not load entity: %w", err)
+			}
+			entityData.Body.KeyType = string(keyType)
+		}
+		if err := validatePublicKeys(&entityData.Body); err != nil {
+			return fmt.Errorf("Could not load entity: %w", err)
+		}
+		entity.Data = *entityData
 		return nil
 	}
 }
 
+// ThreatSpec TMv0.1 for validatePublicKeys
+// Mitigates App:Entity against invalid curve attacks with validation of loaded public keys
+
+// validatePublicKeys decodes the body's current public keys, signing key first, returning crypto.ErrMalformedKey if
+// either can't be decoded and crypto.ErrInvalidPublicKey if either is weak or invalid.
+func validatePublicKeys(body *EntityBody) error {
+	keys := []struct {
+		name      string
+		publicKey string
+	}{
+		{"public signing key", body.PublicSigningKey},
+		{"public encryption key", body.PublicEncryptionKey},
+	}
+	for _, key := range keys {
+		if len(key.publicKey) == 0 {
+			continue
+		}
+		if _, err := crypto.PemDecodePublic([]byte(key.publicKey)); err != nil {
+			return fmt.Errorf("Invalid %s: %w", key.name, err)
+		}
+	}
+	return nil
+}
+
 func (entity *Entity) Id() string {
 	return entity.Data.Body.Id
 }
@@ -183,6 +615,103 @@ func (entity *Entity) Body() EntityBody {
 	return entity.Data.Body
 }
 
+// ShortKeyIdBytes is the number of fingerprint bytes in a short key id, giving 16 hex digits.
+const ShortKeyIdBytes = 8
+
+// ShortKeyId returns the last ShortKeyIdBytes bytes of the public signing key fingerprint, hex encoded, for compact
+// display in UIs and logs. It returns an empty string if the entity has no valid public signing key.
+//
+// Short key ids are display only. Colliding ids can be generated with modest effort, so they must never be used to
+// identify keys for security decisions. Compare full fingerprints from crypto.Fingerprint instead.
+func (entity *Entity) ShortKeyId() string {
+	fingerprint, err := entity.signingKeyFingerprint()
+	if err != nil {
+		return ""
+	}
+	return shortKeyId(fingerprint)
+}
+
+// shortKeyId returns the short key id for the hex encoded fingerprint.
+func shortKeyId(fingerprint string) string {
+	return fingerprint[len(fingerprint)-2*ShortKeyIdBytes:]
+}
+
+// signingKeyFingerprint returns the fingerprint of the public signing key, as returned by crypto.Fingerprint.
+func (entity *Entity) signingKeyFingerprint() (string, error) {
+	return keyFingerprint("public signing key", entity.Data.Body.PublicSigningKey)
+}
+
+// keyFingerprint returns the fingerprint of the named PEM encoded public key, as returned by crypto.Fingerprint.
+func keyFingerprint(name, publicKeyPem string) (string, error) {
+	publicKey, err := crypto.PemDecodePublic([]byte(publicKeyPem))
+	if err != nil {
+		return "", fmt.Errorf("Could not decode %s: %s", name, err)
+	}
+	return crypto.Fingerprint(publicKey)
+}
+
+// EntityThumbprint is a compact public summary of an entity, without key material, see Entity.Thumbprint.
+type EntityThumbprint struct {
+	Id                       string   `json:"id"`
+	Name                     string   `json:"name"`
+	KeyType                  string   `json:"key-type"`
+	SigningKeyFingerprint    string   `json:"signing-key-fingerprint"`
+	EncryptionKeyFingerprint string   `json:"encryption-key-fingerprint"`
+	Created                  string   `json:"created,omitempty"`
+	Roles                    []string `json:"roles,omitempty"`
+}
+
+// ThreatSpec TMv0.1 for Entity.Thumbprint
+// Does public summary of entity for App:Entity
+
+// Thumbprint returns a compact JSON record of the entity for indexing in a directory: its id, name, key type,
+// the fingerprints of its public signing and encryption keys, when its signing key was created and its roles, sorted.
+// The created time comes from the informational PEM header of the public signing key and is omitted for keys without one,
+// such as imported keys. The record contains no key material and is the same for the same entity.
+func (entity *Entity) Thumbprint() ([]byte, error) {
+	body := entity.Data.Body
+	signingFingerprint, err := keyFingerprint("public signing key", body.PublicSigningKey)
+	if err != nil {
+		return nil, err
+	}
+	encryptionFingerprint, err := keyFingerprint("public encryption key", body.PublicEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbprint := EntityThumbprint{
+		Id:                       body.Id,
+		Name:                     body.Name,
+		KeyType:                  body.KeyType,
+		SigningKeyFingerprint:    signingFingerprint,
+		EncryptionKeyFingerprint: encryptionFingerprint,
+	}
+	if block, _ := pem.Decode([]byte(body.PublicSigningKey)); block != nil {
+		thumbprint.Created = block.Headers["Created"]
+	}
+	if len(body.Roles) > 0 {
+		thumbprint.Roles = append([]string(nil), body.Roles...)
+		sort.Strings(thumbprint.Roles)
+	}
+	return json.Marshal(thumbprint)
+}
+
+// Roles returns the roles asserted by the entity.
+func (entity *Entity) Roles() []string {
+	return append([]string(nil), entity.Data.Body.Roles...)
+}
+
+// HasRole checks whether the entity asserts the given role.
+// Roles are part of the entity document, so they should only be trusted if the document is signed by a trusted issuer.
+func (entity *Entity) HasRole(role string) bool {
+	for _, r := range entity.Data.Body.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
 // ThreatSpec TMv0.1 for Entity.Dump
 // Does entity JSON dumping for App:Entity
 
@@ -267,7 +796,31 @@ func (entity *Entity) generateECKeys() (*ecdsa.PrivateKey, *ecdsa.PrivateKey, er
 // Does key generation for App:Entity
 
 // GenerateKeys generates RSA or EC keys for the entity, depending on the KeyType set.
+// It returns ErrKeysAlreadyExist if the entity already has keys, to avoid accidentally replacing its identity.
 func (entity *Entity) GenerateKeys() error {
+	body := entity.Data.Body
+	if len(body.PublicSigningKey) > 0 || len(body.PrivateSigningKey) > 0 ||
+		len(body.PublicEncryptionKey) > 0 || len(body.PrivateEncryptionKey) > 0 {
+		return ErrKeysAlreadyExist
+	}
+	err := entity.generateKeys()
+	entity.logAudit(AuditOperationGenerateKeys, "", err)
+	return err
+}
+
+// ThreatSpec TMv0.1 for Entity.ForceGenerateKeys
+// Does key generation replacing existing keys for App:Entity
+
+// ForceGenerateKeys generates RSA or EC keys for the entity, depending on the KeyType set, replacing any existing keys.
+func (entity *Entity) ForceGenerateKeys() error {
+	err := entity.generateKeys()
+	entity.logAudit(AuditOperationGenerateKeys, "", err)
+	return err
+}
+
+// generateKeys generates and sets the entity keys.
+func (entity *Entity) generateKeys() error {
+	defer crypto.Observe(crypto.OperationGenerateKeys, crypto.StartTimer())
 	var signingKey interface{}
 	var encryptionKey interface{}
 	var publicSigningKey interface{}
@@ -292,25 +845,31 @@ func (entity *Entity) GenerateKeys() error {
 		return fmt.Errorf("Invalid key type: %s", entity.Data.Body.KeyType)
 	}
 
-	if pub, err := crypto.PemEncodePublic(publicSigningKey); err != nil {
+	return entity.setKeys(signingKey, encryptionKey, publicSigningKey, publicEncryptionKey)
+}
+
+// setKeys PEM encodes and sets the entity keys.
+func (entity *Entity) setKeys(signingKey, encryptionKey, publicSigningKey, publicEncryptionKey interface{}) error {
+	headers := entity.pemHeaders()
+	if pub, err := crypto.PemEncodePublicWithHeaders(publicSigningKey, headers); err != nil {
 		return err
 	} else {
 		entity.Data.Body.PublicSigningKey = string(pub)
 	}
 
-	if key, err := crypto.PemEncodePrivate(signingKey); err != nil {
+	if key, err := crypto.PemEncodePrivateWithHeaders(signingKey, headers); err != nil {
 		return err
 	} else {
 		entity.Data.Body.PrivateSigningKey = string(key)
 	}
 
-	if pub, err := crypto.PemEncodePublic(publicEncryptionKey); err != nil {
+	if pub, err := crypto.PemEncodePublicWithHeaders(publicEncryptionKey, headers); err != nil {
 		return err
 	} else {
 		entity.Data.Body.PublicEncryptionKey = string(pub)
 	}
 
-	if key, err := crypto.PemEncodePrivate(encryptionKey); err != nil {
+	if key, err := crypto.PemEncodePrivateWithHeaders(encryptionKey, headers); err != nil {
 		return err
 	} else {
 		entity.Data.Body.PrivateEncryptionKey = string(key)
@@ -319,156 +878,747 @@ func (entity *Entity) GenerateKeys() error {
 	return nil
 }
 
-// ThreatSpec TMv0.1 for Entity.Sign
-// Does container using for App:Entity
-
-// Sign takes a Container and signs it using its private signing key.
-func (entity *Entity) Sign(container *document.Container) error {
-	var signatureMode crypto.Mode
-	switch crypto.KeyType(entity.Data.Body.KeyType) {
-	case crypto.KeyTypeRSA:
-		signatureMode = crypto.SignatureModeSha256Rsa
-	case crypto.KeyTypeEC:
-		signatureMode = crypto.SignatureModeSha256Ecdsa
-	default:
-		return fmt.Errorf("Invalid key type: %s", entity.Data.Body.KeyType)
+// ThreatSpec TMv0.1 for Entity.ImportKeys
+// Does import of existing private keys for App:Entity
+// Mitigates App:Entity against reuse of a key for signing and encryption with distinct key check
+
+// ImportKeys sets the entity keys from existing PEM or DER encoded private signing and encryption keys, deriving the public keys.
+// The encoding of each key is detected, see crypto.DecodePrivate.
+// Both keys must be of the same type, which becomes the entity's key type, and must be distinct.
+// It returns ErrKeysAlreadyExist if the entity already has keys, crypto.ErrMalformedKey if a key can't be decoded,
+// and crypto.ErrInvalidPublicKey if a key is weak.
+func (entity *Entity) ImportKeys(signingKeyData, encryptionKeyData string) error {
+	body := entity.Data.Body
+	if len(body.PublicSigningKey) > 0 || len(body.PrivateSigningKey) > 0 ||
+		len(body.PublicEncryptionKey) > 0 || len(body.PrivateEncryptionKey) > 0 {
+		return ErrKeysAlreadyExist
 	}
 
-	signature := crypto.NewSignature(signatureMode)
-	container.Data.Options.SignatureMode = string(signature.Mode)
-	// Force a clear of any existing signature values as that doesn't make sense
-	container.Data.Options.Signature = ""
+	signingKey, err := crypto.DecodePrivate([]byte(signingKeyData))
+	if err != nil {
+		return fmt.Errorf("Could not decode signing key: %w", err)
+	}
+	encryptionKey, err := crypto.DecodePrivate([]byte(encryptionKeyData))
+	if err != nil {
+		return fmt.Errorf("Could not decode encryption key: %w", err)
+	}
 
-	containerJson := container.Dump()
+	signingKeyType, err := crypto.GetKeyType(signingKey)
+	if err != nil {
+		return err
+	}
+	encryptionKeyType, err := crypto.GetKeyType(encryptionKey)
+	if err != nil {
+		return err
+	}
+	if signingKeyType != encryptionKeyType {
+		return fmt.Errorf("Signing key type '%s' doesn't match encryption key type '%s'", signingKeyType, encryptionKeyType)
+	}
 
-	if err := crypto.Sign(containerJson, entity.Data.Body.PrivateSigningKey, signature); err != nil {
-		return fmt.Errorf("Could not sign container json: %s", err)
+	publicSigningKey := signingKey.(gocrypto.Signer).Public()
+	publicEncryptionKey := encryptionKey.(gocrypto.Signer).Public()
+	if err := crypto.ValidatePublicKey(publicSigningKey); err != nil {
+		return fmt.Errorf("Invalid signing key: %w", err)
 	}
-	if signature.Message != containerJson {
-		return fmt.Errorf("Signed message doesn't match input")
+	if err := crypto.ValidatePublicKey(publicEncryptionKey); err != nil {
+		return fmt.Errorf("Invalid encryption key: %w", err)
+	}
+	signingFingerprint, err := crypto.Fingerprint(publicSigningKey)
+	if err != nil {
+		return err
+	}
+	encryptionFingerprint, err := crypto.Fingerprint(publicEncryptionKey)
+	if err != nil {
+		return err
+	}
+	if signingFingerprint == encryptionFingerprint {
+		return fmt.Errorf("Signing and encryption keys must be different")
 	}
 
-	container.Data.Options.SignatureMode = string(signature.Mode)
-	container.Data.Options.Signature = signature.Signature
-	return nil
+	entity.Data.Body.KeyType = string(signingKeyType)
+	return entity.setKeys(signingKey, encryptionKey, publicSigningKey, publicEncryptionKey)
 }
 
-// ThreatSpec TMv0.1 for Entity.Authenticate
-// Does container authentication with shared keys for App:Entity
-
-// Authenticate takes a Container and MACs it using the provided key.
-func (entity *Entity) Authenticate(container *document.Container, id, key string) error {
+// ThreatSpec TMv0.1 for FromPEMFiles
+// Creates new entity from private key files for App:Entity
 
-	// Have to expand key here as we need to add the salt to the container before we turn it into json
-	rawKey, err := hex.DecodeString(key)
+// FromPEMFiles returns a new entity with the given name and keys imported from PEM encoded private key files, see ImportKeys.
+// The id is derived from the fingerprint of the public signing key, so the same keys always give the same id.
+// Versions before crypto.TaggedHash was introduced derived it from crypto.LegacyFingerprint, so their ids differ.
+func FromPEMFiles(name, signingPrivPath, encryptionPrivPath string) (*Entity, error) {
+	signingKeyPem, err := ioutil.ReadFile(signingPrivPath)
 	if err != nil {
-		return fmt.Errorf("Could not decode key: %s", err)
+		return nil, fmt.Errorf("Could not read signing key: %s", err)
 	}
-
-	newKey, salt, err := crypto.ExpandKey(rawKey, nil)
+	encryptionKeyPem, err := ioutil.ReadFile(encryptionPrivPath)
 	if err != nil {
-		return fmt.Errorf("Cold not expand key: %s", err)
+		return nil, fmt.Errorf("Could not read encryption key: %s", err)
 	}
 
-	signature := crypto.NewSignature(crypto.SignatureModeSha256Hmac)
-	container.Data.Options.SignatureMode = string(signature.Mode)
-	signatureInputs := make(map[string]string)
-	signatureInputs["key-id"] = id
-	signatureInputs["signature-salt"] = string(crypto.Base64Encode(salt))
-	container.Data.Options.SignatureInputs = signatureInputs
-
-	// Force a clear of any existing signature values as that doesn't make sense
-	container.Data.Options.Signature = ""
-
-	containerJson := container.Dump()
+	entity, err := New(nil)
+	if err != nil {
+		return nil, err
+	}
+	entity.Data.Body.Name = name
 
-	if err := crypto.Authenticate(containerJson, newKey, signature); err != nil {
-		return fmt.Errorf("Couldn't authenticate container: %s", err)
+	signingKey, err := crypto.PemDecodePrivate(signingKeyPem)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode signing key: %s", err)
+	}
+	signer, ok := signingKey.(gocrypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported signing key type: %T", signingKey)
+	}
+	fingerprint, err := crypto.Fingerprint(signer.Public())
+	if err != nil {
+		return nil, err
 	}
+	entity.Data.Body.Id = fingerprint[:32]
 
-	if signature.Message != containerJson {
-		return fmt.Errorf("Authenticated message doesn't match")
+	if err := entity.ImportKeys(string(signingKeyPem), string(encryptionKeyPem)); err != nil {
+		return nil, err
 	}
+	return entity, nil
+}
 
-	container.Data.Options.Signature = signature.Signature
-	return nil
+// pemHeaders returns informational PEM headers identifying the entity and the time its keys were created.
+func (entity *Entity) pemHeaders() map[string]string {
+	headers := map[string]string{"Created": time.Now().UTC().Format(time.RFC3339)}
+	if len(entity.Data.Body.Id) > 0 {
+		headers["Entity-Id"] = entity.Data.Body.Id
+	}
+	// Header values must be on a single line
+	if name := strings.Join(strings.Fields(entity.Data.Body.Name), " "); len(name) > 0 {
+		headers["Entity-Name"] = name
+	}
+	return headers
 }
 
-// ThreatSpec TMv0.1 for Entity.VerifyAuthentication
-// Does authenticated container verification for App:Entity
+// ThreatSpec TMv0.1 for Entity.RotateEncryptionKeys
+// Does encryption key rotation for App:Entity
 
-// VerifyAuthentication takes a Container and verifies the MAC for the given key.
-func (entity *Entity) VerifyAuthentication(container *document.Container, key string) error {
-	rawKey, err := hex.DecodeString(key)
+// RotateEncryptionKeys generates a new encryption key pair, keeping the current one as a previous encryption key
+// so that existing containers can still be decrypted.
+func (entity *Entity) RotateEncryptionKeys() (err error) {
+	defer func() { entity.logAudit(AuditOperationRotateEncryptionKeys, "", err) }()
+	pub, key, err := entity.generateKeyPair()
 	if err != nil {
-		return fmt.Errorf("Could not decode key: %s", err)
+		return err
 	}
 
-	salt, err := crypto.Base64Decode([]byte(container.Data.Options.SignatureInputs["signature-salt"]))
-	if err != nil {
-		fmt.Errorf("Could not base64 decode signature salt: %s", err)
+	previousKey := PreviousKey{
+		PublicKey:  entity.Data.Body.PublicEncryptionKey,
+		PrivateKey: entity.Data.Body.PrivateEncryptionKey,
+		Activated:  activated(entity.Data.Body.PreviousEncryptionKeys),
+		Retired:    time.Now().Unix(),
 	}
+	entity.Data.Body.PreviousEncryptionKeys = append(entity.Data.Body.PreviousEncryptionKeys, previousKey)
+	entity.Data.Body.PublicEncryptionKey = pub
+	entity.Data.Body.PrivateEncryptionKey = key
+	return nil
+}
 
-	newKey, _, err := crypto.ExpandKey(rawKey, salt)
+// ThreatSpec TMv0.1 for Entity.RotateSigningKeys
+// Does signing key rotation for App:Entity
+
+// RotateSigningKeys generates a new signing key pair, keeping the current public key as a previous signing key
+// so that containers signed before the rotation can still be verified with VerifyAt. The previous private signing key
+// is discarded. Entities using an external signer must update the signer to match the new key.
+func (entity *Entity) RotateSigningKeys() (err error) {
+	defer func() { entity.logAudit(AuditOperationRotateSigningKeys, "", err) }()
+	pub, key, err := entity.generateKeyPair()
 	if err != nil {
-		return fmt.Errorf("Could not expand key: %s", err)
+		return err
 	}
-	mac := crypto.NewSignature(crypto.SignatureModeSha256Hmac)
-
-	mac.Signature = container.Data.Options.Signature
-	container.Data.Options.Signature = ""
-
-	mac.Message = container.Dump()
 
-	if err := crypto.Verify(mac, newKey); err != nil {
-		return fmt.Errorf("Couldn't verify container: %s", err)
-	} else {
-		return nil
+	previousKey := PreviousKey{
+		PublicKey: entity.Data.Body.PublicSigningKey,
+		Activated: activated(entity.Data.Body.PreviousSigningKeys),
+		Retired:   time.Now().Unix(),
 	}
+	entity.Data.Body.PreviousSigningKeys = append(entity.Data.Body.PreviousSigningKeys, previousKey)
+	entity.Data.Body.PublicSigningKey = pub
+	entity.Data.Body.PrivateSigningKey = key
+	return nil
 }
 
-// ThreatSpec TMv0.1 for Entity.Verify
-// Does container signature verification for App:Entity
+// UnknownKeyAge is returned by KeyAge when the creation time of a current key isn't recorded.
+const UnknownKeyAge time.Duration = -1
 
-// Verify takes a Container and verifies the signature using the entities public key.
-func (entity *Entity) Verify(container *document.Container) error {
+// ThreatSpec TMv0.1 for Entity.KeyAge
+// Returns age of current keys for App:Entity
 
-	if container.IsSigned() == false {
-		return fmt.Errorf("Container isn't signed")
+// KeyAge returns the age of the older of the entity's current signing and encryption keys. A key was created when
+// the previous key was retired by a rotation, or otherwise at the time in its informational PEM Created header.
+// If either key has no recorded creation time, such as an imported key, UnknownKeyAge is returned rather than zero.
+func (entity *Entity) KeyAge() time.Duration {
+	body := entity.Data.Body
+	signingCreated, ok := keyCreated(body.PublicSigningKey, body.PreviousSigningKeys)
+	if !ok {
+		return UnknownKeyAge
+	}
+	encryptionCreated, ok := keyCreated(body.PublicEncryptionKey, body.PreviousEncryptionKeys)
+	if !ok {
+		return UnknownKeyAge
 	}
+	if encryptionCreated.Before(signingCreated) {
+		signingCreated = encryptionCreated
+	}
+	return time.Since(signingCreated)
+}
 
-	signature := new(crypto.Signed)
-	signature.Signature = container.Data.Options.Signature
+// ThreatSpec TMv0.1 for Entity.RotationDue
+// Mitigates App:Entity against long lived keys with rotation policy check
 
-	container.Data.Options.Signature = ""
-	containerJson := container.Dump()
-	signature.Message = containerJson
+// RotationDue returns whether the entity's keys are older than maxAge, as returned by KeyAge, and should be rotated.
+// Keys of unknown age are always due, as they can't be shown to be within the policy.
+func (entity *Entity) RotationDue(maxAge time.Duration) bool {
+	age := entity.KeyAge()
+	return age == UnknownKeyAge || age > maxAge
+}
 
-	if err := crypto.Verify(signature, []byte(entity.Data.Body.PublicSigningKey)); err != nil {
-		return fmt.Errorf("Could not verify org container signature: %s", err)
-	} else {
-		return nil
+// keyCreated returns when the PEM encoded public key was created and whether it is known, from the newest previous key's
+// retirement or else the key's PEM Created header.
+func keyCreated(publicKeyPem string, previousKeys []PreviousKey) (time.Time, bool) {
+	if retired := activated(previousKeys); retired != 0 {
+		return time.Unix(retired, 0), true
 	}
+	block, _ := pem.Decode([]byte(publicKeyPem))
+	if block == nil {
+		return time.Time{}, false
+	}
+	created, err := time.Parse(time.RFC3339, block.Headers["Created"])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return created, true
+}
+
+// activated returns the time the current key became current, which is when the newest previous key was retired.
+func activated(previousKeys []PreviousKey) int64 {
+	if len(previousKeys) == 0 {
+		return 0
+	}
+	return previousKeys[len(previousKeys)-1].Retired
+}
+
+// generateKeyPair generates a key pair of the entity's key type, returning the PEM encoded public and private keys.
+func (entity *Entity) generateKeyPair() (string, string, error) {
+	privateKey, publicKey, err := generateKey(crypto.KeyType(entity.Data.Body.KeyType))
+	if err != nil {
+		return "", "", err
+	}
+
+	headers := entity.pemHeaders()
+	pub, err := crypto.PemEncodePublicWithHeaders(publicKey, headers)
+	if err != nil {
+		return "", "", err
+	}
+
+	key, err := crypto.PemEncodePrivateWithHeaders(privateKey, headers)
+	if err != nil {
+		return "", "", err
+	}
+	return string(pub), string(key), nil
+}
+
+// generateKey generates a private key of the given key type, returning it with its public key.
+func generateKey(keyType crypto.KeyType) (interface{}, interface{}, error) {
+	switch keyType {
+	case crypto.KeyTypeRSA:
+		key, err := crypto.GenerateRSAKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		key.Precompute()
+		if err := key.Validate(); err != nil {
+			return nil, nil, fmt.Errorf("Could not validate key: %s", err)
+		}
+		return key, &key.PublicKey, nil
+	case crypto.KeyTypeEC:
+		key, err := crypto.GenerateECKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, &key.PublicKey, nil
+	default:
+		return nil, nil, fmt.Errorf("Invalid key type: %s", keyType)
+	}
+}
+
+// ThreatSpec TMv0.1 for Entity.Sign
+// Does container using for App:Entity
+
+// Sign takes a Container and signs it using its private signing key, with the default signature mode for the key type.
+// The signature is stored base64 encoded unless another encoding is set with document.Container.SetSignatureEncoding.
+func (entity *Entity) Sign(container *document.Container) (err error) {
+	defer crypto.Observe(crypto.OperationSign, crypto.StartTimer())
+	defer func() { entity.logAudit(AuditOperationSign, entity.Data.Body.Id, err) }()
+	signatureMode, err := entity.signatureMode()
+	if err != nil {
+		return err
+	}
+	return entity.signWithMode(container, signatureMode)
+}
+
+// ThreatSpec TMv0.1 for Entity.SignWithMode
+// Does container signing with a chosen signature mode for App:Entity
+
+// SignWithMode is like Sign, but signs with the given signature mode, such as crypto.SignatureModeSha256RsaPss for
+// an RSA entity. The mode must be registered for the entity's key type.
+func (entity *Entity) SignWithMode(container *document.Container, mode crypto.Mode) (err error) {
+	defer crypto.Observe(crypto.OperationSign, crypto.StartTimer())
+	defer func() { entity.logAudit(AuditOperationSign, entity.Data.Body.Id, err) }()
+	keyType, err := entity.keyType()
+	if err != nil {
+		return err
+	}
+	scheme, err := crypto.LookupMode(mode)
+	if err != nil {
+		return err
+	}
+	if scheme.KeyType != keyType {
+		return fmt.Errorf("Can't sign with mode '%s' using key type '%s'", mode, keyType)
+	}
+	return entity.signWithMode(container, mode)
+}
+
+// signWithMode signs the container with the given signature mode, which the signer must use.
+func (entity *Entity) signWithMode(container *document.Container, mode crypto.Mode) error {
+	signature := crypto.NewSignature(mode)
+	container.Data.Options.SignatureMode = string(signature.Mode)
+	container.Data.Options.SignatureVersion = container.SigningVersion()
+	// Force a clear of any existing signature values as that doesn't make sense
+	container.Data.Options.Signature = ""
+	container.Data.Options.CounterSignatures = nil
+
+	containerJson, err := container.SignatureMessage()
+	if err != nil {
+		return err
+	}
+
+	if err := entity.signer().Sign(containerJson, signature); err != nil {
+		return fmt.Errorf("Could not sign container json: %s", err)
+	}
+	if signature.Message != containerJson {
+		return fmt.Errorf("Signed message doesn't match input")
+	}
+	// The mode is covered by the signature, so the signer can't change it
+	if signature.Mode != mode {
+		return fmt.Errorf("Signed with mode '%s' instead of '%s'", signature.Mode, mode)
+	}
+
+	return container.SetSignatureBase64(signature.Signature)
+}
+
+// ThreatSpec TMv0.1 for Entity.Resign
+// Does container re-signing for App:Entity
+// Mitigates App:Entity against re-signing tampered content with verification before signing
+
+// Resign verifies the container signature under the mode it declares and then signs it again using the given
+// signature mode, for migrating signatures between modes, such as from crypto.SignatureModeSha256Rsa to
+// crypto.SignatureModeSha256RsaPss. The mode must be registered for the entity's key type. Counter-signatures are
+// over the old signature, so they are removed. If verification or signing fails, the container is left unchanged.
+func (entity *Entity) Resign(container *document.Container, newMode crypto.Mode) error {
+	options := container.Data.Options
+	restore := func() {
+		container.Data.Options.Signature = options.Signature
+		container.Data.Options.SignatureMode = options.SignatureMode
+		container.Data.Options.SignatureVersion = options.SignatureVersion
+		container.Data.Options.CounterSignatures = options.CounterSignatures
+	}
+
+	if err := entity.Verify(container); err != nil {
+		restore()
+		return fmt.Errorf("Could not verify container: %w", err)
+	}
+
+	if err := entity.SignWithMode(container, newMode); err != nil {
+		restore()
+		return fmt.Errorf("Could not sign container: %w", err)
+	}
+	return nil
+}
+
+// ThreatSpec TMv0.1 for Entity.SetSigner
+// Does setting of external signing backend for App:Entity
+
+// SetSigner sets an external signing backend, such as a PKCS#11 token, to be used instead of the private signing key.
+// The private signing key can then be left empty, but the public signing key must still be set for verification.
+func (entity *Entity) SetSigner(signer crypto.Signer) {
+	entity.signerBackend = signer
+}
+
+// signer returns the signing backend for the entity's private signing key.
+func (entity *Entity) signer() crypto.Signer {
+	if entity.signerBackend != nil {
+		return entity.signerBackend
+	}
+	return crypto.NewPemSigner(entity.Data.Body.PrivateSigningKey)
+}
+
+// decrypter returns the decryption backend for the entity's private encryption key.
+func (entity *Entity) decrypter() crypto.Decrypter {
+	return crypto.NewPemDecrypter(entity.Data.Body.PrivateEncryptionKey)
+}
+
+// ThreatSpec TMv0.1 for Entity.Authenticate
+// Does container authentication with shared keys for App:Entity
+
+// Authenticate takes a Container and MACs it using the provided key.
+func (entity *Entity) Authenticate(container *document.Container, id, key string) error {
+	return entity.AuthenticateWithSaltSize(container, id, key, crypto.DefaultSaltSize)
+}
+
+// ThreatSpec TMv0.1 for Entity.AuthenticateWithSaltSize
+// Does container authentication with shared keys and a given salt size for App:Entity
+
+// AuthenticateWithSaltSize is like Authenticate, but expands the key with a salt of the given size in bytes.
+// It returns ErrWeakSalt if the size is less than crypto.MinSaltSize.
+func (entity *Entity) AuthenticateWithSaltSize(container *document.Container, id, key string, saltSize int) error {
+
+	// Have to expand key here as we need to add the salt to the container before we turn it into json
+	rawKey, err := hex.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("Could not decode key: %s", err)
+	}
+
+	newKey, salt, err := crypto.ExpandKeyWithSaltSize(rawKey, saltSize)
+	if err != nil {
+		return fmt.Errorf("Could not expand key: %w", err)
+	}
+	return authenticateWithExpandedKey(container, id, newKey, salt)
+}
+
+// authenticateWithExpandedKey MACs the container with a key already expanded with the given salt.
+func authenticateWithExpandedKey(container *document.Container, id string, newKey, salt []byte) error {
+	signature := crypto.NewSignature(crypto.SignatureModeSha256Hmac)
+	container.Data.Options.SignatureMode = string(signature.Mode)
+	signatureInputs := make(map[string]string)
+	signatureInputs["key-id"] = id
+	signatureInputs["signature-salt"] = string(crypto.Base64Encode(salt))
+	container.Data.Options.SignatureInputs = signatureInputs
+	container.Data.Options.SignatureVersion = container.SigningVersion()
+
+	// Force a clear of any existing signature values as that doesn't make sense
+	container.Data.Options.Signature = ""
+	container.Data.Options.CounterSignatures = nil
+
+	containerJson, err := container.SignatureMessage()
+	if err != nil {
+		return err
+	}
+
+	if err := crypto.Authenticate(containerJson, newKey, signature); err != nil {
+		return fmt.Errorf("Couldn't authenticate container: %s", err)
+	}
+
+	if signature.Message != containerJson {
+		return fmt.Errorf("Authenticated message doesn't match")
+	}
+
+	return container.SetSignatureBase64(signature.Signature)
+}
+
+// ThreatSpec TMv0.1 for Entity.signatureMode
+// Returns signature mode for key type for App:Entity
+
+// signatureMode returns the signature mode used with the entity's key type. If the key type isn't set, it is inferred
+// from the signing key with inferKeyType.
+func (entity *Entity) signatureMode() (crypto.Mode, error) {
+	keyType, err := entity.keyType()
+	if err != nil {
+		return "", err
+	}
+	return crypto.ModeForKeyType(keyType)
+}
+
+// keyType returns the entity's key type, inferring it from the signing key with inferKeyType if it isn't set.
+func (entity *Entity) keyType() (crypto.KeyType, error) {
+	if keyType := crypto.KeyType(entity.Data.Body.KeyType); len(keyType) > 0 {
+		return keyType, nil
+	}
+	return entity.inferKeyType()
+}
+
+// inferKeyType returns the key type of the entity's private signing key, or of the public signing key if the private
+// key isn't held, for example when signing with an HSM. It is used when an entity was loaded without a key type.
+func (entity *Entity) inferKeyType() (crypto.KeyType, error) {
+	var key interface{}
+	var err error
+	if privateKey := entity.Data.Body.PrivateSigningKey; len(privateKey) > 0 {
+		key, err = crypto.PemDecodePrivate([]byte(privateKey))
+	} else {
+		key, err = crypto.PemDecodePublic([]byte(entity.Data.Body.PublicSigningKey))
+	}
+	if err != nil {
+		return "", fmt.Errorf("Could not infer key type: %w", err)
+	}
+	return crypto.GetKeyType(key)
+}
+
+// checkSignatureMode checks that the declared signature mode is registered for the entity's key type and meets the minimum strength.
+func (entity *Entity) checkSignatureMode(declaredMode crypto.Mode) error {
+	return checkSignatureMode(crypto.KeyType(entity.Data.Body.KeyType), declaredMode)
+}
+
+// checkSignatureMode checks that the declared signature mode is registered for the key type, if it is set, and meets the minimum strength.
+func checkSignatureMode(keyType crypto.KeyType, declaredMode crypto.Mode) error {
+	if len(keyType) > 0 {
+		scheme, err := crypto.LookupMode(declaredMode)
+		if err != nil {
+			return fmt.Errorf("%s: %w: %w", err, ErrSignatureModeMismatch, ErrVerificationFailed)
+		}
+		if scheme.KeyType != keyType {
+			return fmt.Errorf("Signature mode '%s' doesn't match key type '%s': %w: %w", declaredMode, keyType, ErrSignatureModeMismatch, ErrVerificationFailed)
+		}
+	}
+
+	if crypto.ModeStrength(declaredMode) < minSignatureStrength {
+		return fmt.Errorf("Signature mode '%s' is below the minimum strength: %w: %w", declaredMode, ErrSignatureTooWeak, ErrVerificationFailed)
+	}
+	return nil
+}
+
+// ThreatSpec TMv0.1 for Entity.VerifyAuthentication
+// Does authenticated container verification for App:Entity
+
+// VerifyAuthentication takes a Container and verifies the MAC for the given key.
+// It returns ErrWeakSalt if the signature salt is shorter than crypto.MinSaltSize, ErrMalformedContainer if the salt
+// or signed message can't be decoded and ErrVerificationFailed if the MAC doesn't verify.
+func (entity *Entity) VerifyAuthentication(container *document.Container, key string) (err error) {
+	defer func() { entity.logAudit(AuditOperationVerify, container.Data.Options.Source, err) }()
+	rawKey, err := hex.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("Could not decode key: %s", err)
+	}
+
+	salt, err := crypto.Base64Decode([]byte(container.Data.Options.SignatureInputs["signature-salt"]))
+	if err != nil {
+		return fmt.Errorf("Could not base64 decode signature salt: %s: %w", err, ErrMalformedContainer)
+	}
+	if len(salt) < crypto.MinSaltSize {
+		return fmt.Errorf("Signature salt of %d bytes is less than %d: %w", len(salt), crypto.MinSaltSize, ErrWeakSalt)
+	}
+
+	newKey, _, err := crypto.ExpandKey(rawKey, salt)
+	if err != nil {
+		return fmt.Errorf("Could not expand key: %s", err)
+	}
+	mac := crypto.NewSignature(crypto.SignatureModeSha256Hmac)
+
+	if mac.Signature, err = container.SignatureBase64(); err != nil {
+		return fmt.Errorf("%w: %w", err, ErrMalformedContainer)
+	}
+	if mac.Message, err = container.SignatureMessage(); err != nil {
+		return fmt.Errorf("%w: %w", err, ErrMalformedContainer)
+	}
+
+	if err := crypto.Verify(mac, newKey); err != nil {
+		return fmt.Errorf("Couldn't verify container: %s: %w", err, ErrVerificationFailed)
+	} else {
+		return nil
+	}
+}
+
+// ThreatSpec TMv0.1 for Entity.Verify
+// Does container signature verification for App:Entity
+
+// Verify takes a Container and verifies the signature using the entities public key.
+//
+// The signature mode declared by the container must match the entity's key type, otherwise ErrSignatureModeMismatch is returned.
+// Modes weaker than the minimum set by SetMinSignatureStrength return ErrSignatureTooWeak.
+// Containers signed with a context return ErrContextMismatch; use VerifyCtx to verify them.
+func (entity *Entity) Verify(container *document.Container) error {
+	return entity.VerifyCtx(container, "")
+}
+
+// ThreatSpec TMv0.1 for Entity.VerifyCtx
+// Does container signature verification with context for App:Entity
+// Mitigates App:Entity against cross-protocol signature replay with signed context check
+
+// VerifyCtx is like Verify, but also checks that the container was signed with the given context,
+// returning ErrContextMismatch if it wasn't.
+func (entity *Entity) VerifyCtx(container *document.Container, context string) (err error) {
+	defer func() { entity.logAudit(AuditOperationVerify, container.Data.Options.Source, err) }()
+	if err := entity.verify(container); err != nil {
+		return err
+	}
+	return checkContext(container, context)
+}
+
+// checkContext returns ErrContextMismatch if the container wasn't signed with the given context.
+func checkContext(container *document.Container, context string) error {
+	if signedContext := container.Data.Options.SignatureInputs["context"]; signedContext != context {
+		return fmt.Errorf("Expected context '%s' but got '%s': %w", context, signedContext, ErrContextMismatch)
+	}
+	return nil
+}
+
+// VerifyResult describes a successfully verified container signature.
+type VerifyResult struct {
+	// SignerId is the id of the verifying entity.
+	SignerId string
+	// Mode is the signature mode of the container.
+	Mode crypto.Mode
+	// VerifiedAt is the time the signature was verified.
+	VerifiedAt time.Time
+	// KeyFingerprint is the fingerprint of the public signing key, as returned by crypto.Fingerprint.
+	KeyFingerprint string
+}
+
+// ThreatSpec TMv0.1 for Entity.VerifyDetailed
+// Does container signature verification with provenance for App:Entity
+
+// VerifyDetailed is like Verify, but returns details of the verified signature for recording provenance.
+func (entity *Entity) VerifyDetailed(container *document.Container) (*VerifyResult, error) {
+	if err := entity.Verify(container); err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := entity.signingKeyFingerprint()
+	if err != nil {
+		return nil, err
+	}
+
+	return &VerifyResult{
+		SignerId:       entity.Data.Body.Id,
+		Mode:           crypto.Mode(container.Data.Options.SignatureMode),
+		VerifiedAt:     time.Now(),
+		KeyFingerprint: fingerprint,
+	}, nil
+}
+
+// ThreatSpec TMv0.1 for Entity.VerifyPinned
+// Does container signature verification with a pinned key for App:Entity
+// Mitigates App:Entity against key substitution with fingerprint pinning
+
+// VerifyPinned is like Verify, but first checks that the fingerprint of the entity's public signing key, as returned
+// by crypto.Fingerprint, is the expected fingerprint, returning ErrFingerprintMismatch if it isn't. This stops a
+// correctly signed container being accepted from a different key, such as one substituted after trust on first use.
+// The expected fingerprint is compared case insensitively. Fingerprints pinned by versions before crypto.TaggedHash
+// was introduced, see crypto.LegacyFingerprint, are only accepted if crypto.AcceptLegacyDigests is set.
+func (entity *Entity) VerifyPinned(container *document.Container, expectedFingerprint string) error {
+	publicKey, err := crypto.PemDecodePublic([]byte(entity.Data.Body.PublicSigningKey))
+	if err != nil {
+		return fmt.Errorf("Could not decode public signing key: %s", err)
+	}
+	fingerprint, err := crypto.Fingerprint(publicKey)
+	if err != nil {
+		return err
+	}
+	expected := strings.ToLower(strings.TrimSpace(expectedFingerprint))
+	matches := fingerprint == expected
+	if !matches && crypto.AcceptLegacyDigests {
+		legacyFingerprint, err := crypto.LegacyFingerprint(publicKey)
+		if err != nil {
+			return err
+		}
+		matches = legacyFingerprint == expected
+	}
+	if !matches {
+		return fmt.Errorf("Expected fingerprint '%s' but got '%s': %w", expectedFingerprint, fingerprint, ErrFingerprintMismatch)
+	}
+	return entity.Verify(container)
+}
+
+// ThreatSpec TMv0.1 for Entity.VerifyAt
+// Does container signature verification with historical keys for App:Entity
+// Mitigates App:Entity against accepting signatures from retired keys with key validity windows
+
+// VerifyAt verifies the container signature using the public signing key that was current at time t, which may be
+// a previous signing key kept by RotateSigningKeys. A key is current from when it was activated until it was retired,
+// and the current key from when the newest previous key was retired. If no key was current at t, ErrNoKeyAtTime is returned.
+//
+// VerifyAt is only meaningful if t is a trustworthy signing time, such as from a timestamp authority, as a signer
+// holding a retired key can otherwise claim any time during that key's validity.
+// Like Verify, containers signed with a context return ErrContextMismatch.
+func (entity *Entity) VerifyAt(container *document.Container, t time.Time) (err error) {
+	defer func() { entity.logAudit(AuditOperationVerify, container.Data.Options.Source, err) }()
+	publicKey, err := entity.signingKeyAt(t)
+	if err != nil {
+		return err
+	}
+	if err := entity.verifyWithKey(container, publicKey); err != nil {
+		return err
+	}
+	return checkContext(container, "")
+}
+
+// signingKeyAt returns the public signing key that was current at time t.
+func (entity *Entity) signingKeyAt(t time.Time) (string, error) {
+	unix := t.Unix()
+	previousKeys := entity.Data.Body.PreviousSigningKeys
+	for _, previous := range previousKeys {
+		if unix >= previous.Activated && unix < previous.Retired {
+			return previous.PublicKey, nil
+		}
+	}
+	if unix >= activated(previousKeys) {
+		return entity.Data.Body.PublicSigningKey, nil
+	}
+	return "", fmt.Errorf("No signing key at %s: %w", t.UTC().Format(time.RFC3339), ErrNoKeyAtTime)
+}
+
+// verify verifies the container signature using the entities public key.
+func (entity *Entity) verify(container *document.Container) error {
+	return entity.verifyWithKey(container, entity.Data.Body.PublicSigningKey)
+}
+
+// verifyWithKey verifies the container signature using the given PEM encoded public signing key of the entity.
+func (entity *Entity) verifyWithKey(container *document.Container, publicKey string) error {
+	defer crypto.Observe(crypto.OperationVerify, crypto.StartTimer())
+	if container.IsSigned() == false {
+		return fmt.Errorf("Container isn't signed: %w", ErrVerificationFailed)
+	}
+
+	if err := entity.checkSignatureMode(crypto.Mode(container.Data.Options.SignatureMode)); err != nil {
+		return err
+	}
+
+	return container.Verify(publicKey)
 }
 
 // ThreatSpec TMv0.1 for Entity.Decrypt
 // Does container decryption using private keys for App:Entity
 
 // Decrypt takes a Container and decrypts the content using the entities private decryption key.
+// If that fails, the previous encryption keys are tried, newest first, so that containers encrypted before a key rotation can still be decrypted.
 // It returns a plaintext string.
-func (entity *Entity) Decrypt(container *document.Container) (string, error) {
+func (entity *Entity) Decrypt(container *document.Container) (_ string, err error) {
+	defer func() { entity.logAudit(AuditOperationDecrypt, container.Data.Options.Source, err) }()
+	return entity.decrypt(container)
+}
 
+// decrypt is Decrypt without the audit event, for callers that report their own.
+func (entity *Entity) decrypt(container *document.Container) (string, error) {
+	defer crypto.Observe(crypto.OperationDecrypt, crypto.StartTimer())
 	if container.IsEncrypted() == false {
-		return "", fmt.Errorf("Container isn't encrypted")
+		return "", fmt.Errorf("Container isn't encrypted: %w", ErrMalformedContainer)
 	}
 
 	id := entity.Data.Body.Id
-	key := entity.Data.Body.PrivateEncryptionKey
-	if decryptedJson, err := container.Decrypt(id, key); err != nil {
-		return "", fmt.Errorf("Could not decrypt: %s", err)
-	} else {
+	decryptedJson, err := container.DecryptWith(id, entity.decrypter())
+	if err == nil {
 		return decryptedJson, nil
 	}
+
+	previousKeys := entity.Data.Body.PreviousEncryptionKeys
+	for i := len(previousKeys) - 1; i >= 0; i-- {
+		if decryptedJson, previousErr := container.DecryptWith(id, crypto.NewPemDecrypter(previousKeys[i].PrivateKey)); previousErr == nil {
+			return decryptedJson, nil
+		}
+	}
+	return "", fmt.Errorf("Could not decrypt: %w", err)
+}
+
+// ThreatSpec TMv0.1 for Entity.CanDecrypt
+// Returns whether entity is a recipient of a container for App:Entity
+
+// CanDecrypt checks whether the Container is encrypted for the entity. It only checks recipient membership by id
+// and doesn't use the private key.
+func (entity *Entity) CanDecrypt(container *document.Container) bool {
+	return container.IsEncrypted() && container.HasRecipient(entity.Data.Body.Id)
 }
 
 // ThreatSpec TMv0.1 for Entity.SymmetricDecrypt
@@ -480,7 +1630,7 @@ func (entity *Entity) SymmetricDecrypt(container *document.Container, key string
 
 	// TODO - check container is encrypted
 	if decryptedJson, err := container.SymmetricDecrypt(key); err != nil {
-		return "", fmt.Errorf("Could not decrypt: %s", err)
+		return "", fmt.Errorf("Could not decrypt: %w", err)
 	} else {
 		return decryptedJson, nil
 	}
@@ -489,34 +1639,266 @@ func (entity *Entity) SymmetricDecrypt(container *document.Container, key string
 // ThreatSpec  TMv0.1 for Entity.Public
 // Returns public version of entity for App:Entity
 
-// Public returns the public entity data.
+// Public returns the public entity data. It is built by copying the entity data rather than through JSON, so nothing
+// but the private keys is lost. Unknown body fields kept by LoadLenient are dropped, as they might not be public.
+// The public entity uses EntityPublicSchema.
 func (entity *Entity) Public() (*Entity, error) {
-	selfJson := entity.Dump()
-	publicEntity, err := New(selfJson)
+	publicEntity, err := New(nil)
 	if err != nil {
 		return nil, fmt.Errorf("Could not create public entity: %s", err)
 	}
-	publicEntity.Data.Body.PrivateSigningKey = ""
-	publicEntity.Data.Body.PrivateEncryptionKey = ""
+
+	validator, err := schemaValidator(EntityPublicSchema)
+	if err != nil {
+		return nil, err
+	}
+	publicEntity.Schema = EntityPublicSchema
+	publicEntity.Validator = validator
+	publicEntity.Data = entity.Data
+	body := &publicEntity.Data.Body
+	body.PrivateSigningKey = ""
+	body.PrivateEncryptionKey = ""
+	body.PrivateKeyProtection = nil
+	body.Extra = nil
+	// Copy slices so that the public entity doesn't share them with the entity
+	if entity.Data.Body.PreviousEncryptionKeys != nil {
+		body.PreviousEncryptionKeys = make([]PreviousKey, len(entity.Data.Body.PreviousEncryptionKeys))
+		for i, previous := range entity.Data.Body.PreviousEncryptionKeys {
+			body.PreviousEncryptionKeys[i] = PreviousKey{PublicKey: previous.PublicKey, Activated: previous.Activated, Retired: previous.Retired}
+		}
+	}
+	if entity.Data.Body.PreviousSigningKeys != nil {
+		body.PreviousSigningKeys = append([]PreviousKey(nil), entity.Data.Body.PreviousSigningKeys...)
+	}
+	if entity.Data.Body.Roles != nil {
+		body.Roles = append([]string(nil), entity.Data.Body.Roles...)
+	}
 	return publicEntity, nil
 }
 
+// ThreatSpec TMv0.1 for Entity.ToJWS
+// Does export of signed container as JWS for App:Entity
+// Mitigates App:Entity against exporting tampered content with verification before signing
+
+// ToJWS verifies that the container is signed by the entity and re-expresses it as a JWS signed with the entity's
+// private signing key, see document.Container.ToJWS. The private signing key must be available, so entities using
+// an external signer can't export JWS.
+func (entity *Entity) ToJWS(container *document.Container) (string, error) {
+	if len(entity.Data.Body.PrivateSigningKey) == 0 {
+		return "", fmt.Errorf("Entity has no private signing key")
+	}
+	if err := entity.Verify(container); err != nil {
+		return "", fmt.Errorf("Could not verify container: %w", err)
+	}
+	return container.ToJWS(entity.Data.Body.PrivateSigningKey)
+}
+
+// ThreatSpec TMv0.1 for Entity.ToSSHPublicKey
+// Does conversion of public signing key to SSH format for App:Entity
+
+// ToSSHPublicKey returns the entity's public signing key as an OpenSSH authorized_keys line, with the entity name as the comment.
+// An error is returned if the key doesn't match the entity's key type.
+func (entity *Entity) ToSSHPublicKey() (string, error) {
+	publicKey, err := crypto.PemDecodePublic([]byte(entity.Data.Body.PublicSigningKey))
+	if err != nil {
+		return "", fmt.Errorf("Could not decode public signing key: %s", err)
+	}
+
+	var keyType crypto.KeyType
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		keyType = crypto.KeyTypeRSA
+	case *ecdsa.PublicKey:
+		keyType = crypto.KeyTypeEC
+	}
+	if keyType != crypto.KeyType(entity.Data.Body.KeyType) {
+		return "", fmt.Errorf("Public signing key of type %T doesn't match key type '%s'", publicKey, entity.Data.Body.KeyType)
+	}
+
+	return crypto.SSHPublicKey(publicKey, entity.Data.Body.Name)
+}
+
 // ThreatSpec TMv0.1 for Entity.SignString
 // Does string signing for App:Entity
 
 // SignString takes a message string and signs it.
 func (entity *Entity) SignString(content string) (*document.Container, error) {
+	return entity.SignStringCtx(content, "")
+}
+
+// ThreatSpec TMv0.1 for Entity.SignStringWithNonce
+// Does string signing with a freshness nonce for App:Entity
+// Mitigates App:Entity against replay of signed containers with random nonce covered by the signature
+
+// SignStringWithNonce takes a message string and signs it, embedding a random nonce in the signature inputs.
+// The nonce is returned so that the verifier can keep track of the nonces it has seen.
+func (entity *Entity) SignStringWithNonce(content string) (*document.Container, string, error) {
+	rawNonce, err := crypto.RandomBytes(16)
+	if err != nil {
+		return nil, "", fmt.Errorf("Could not generate nonce: %s", err)
+	}
+	nonce := hex.EncodeToString(rawNonce)
+
+	container, err := document.NewContainer(nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("Could not create container: %s", err)
+	}
+	container.Data.Options.Source = entity.Data.Body.Id
+	container.Data.Options.SignatureInputs = map[string]string{"nonce": nonce}
+	container.Data.Body = content
+	if err := entity.Sign(container); err != nil {
+		return nil, "", fmt.Errorf("Could not sign container: %s", err)
+	}
+	return container, nonce, nil
+}
+
+// ThreatSpec TMv0.1 for Entity.SignStringCtx
+// Does string signing with context for App:Entity
+
+// SignStringCtx takes a message string and signs it, binding the signature to the context label, such as "pki.io/enrollment/v1".
+// The context is stored in the signature inputs and must be given to VerifyCtx. With an empty context, no context is stored.
+// The content-digest option is set to the digest of the content and is covered by the signature.
+func (entity *Entity) SignStringCtx(content, context string) (*document.Container, error) {
 	container, err := document.NewContainer(nil)
 	if err != nil {
 		return nil, fmt.Errorf("Could not create container: %s", err)
 	}
 	container.Data.Options.Source = entity.Data.Body.Id
+	if len(context) > 0 {
+		container.Data.Options.SignatureInputs = map[string]string{"context": context}
+	}
 	container.Data.Body = content
+	container.SetContentDigest()
 	if err := entity.Sign(container); err != nil {
 		return nil, fmt.Errorf("Could not sign container: %s", err)
-	} else {
-		return container, nil
 	}
+	return container, nil
+}
+
+// ThreatSpec TMv0.1 for Entity.SignStringWithClaims
+// Does string signing with claims for App:Entity
+
+// SignStringWithClaims takes a message string and signs it along with the claims, such as an audience or purpose.
+// The claims are stored in the claims option, so they are covered by the signature; use VerifyClaims to check them.
+// The content-digest option is set to the digest of the content and is covered by the signature.
+func (entity *Entity) SignStringWithClaims(content string, claims map[string]string) (*document.Container, error) {
+	container, err := document.NewContainer(nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create container: %s", err)
+	}
+	container.Data.Options.Source = entity.Data.Body.Id
+	if len(claims) > 0 {
+		container.Data.Options.Claims = make(map[string]string, len(claims))
+		for name, value := range claims {
+			container.Data.Options.Claims[name] = value
+		}
+	}
+	container.Data.Body = content
+	container.SetContentDigest()
+	if err := entity.Sign(container); err != nil {
+		return nil, fmt.Errorf("Could not sign container: %s", err)
+	}
+	return container, nil
+}
+
+// ThreatSpec TMv0.1 for Entity.VerifyClaims
+// Does container signature and claims verification for App:Entity
+// Mitigates App:Entity against use of signed containers for unintended purposes with signed claims check
+
+// VerifyClaims verifies the container signature and then checks that each of the required claims is present in the
+// signed claims with the same value, returning ErrClaimMismatch if not. Claims that aren't required are ignored.
+// If the signature doesn't cover the claims, such as with signed fields that leave them out, ErrVerificationFailed is returned.
+func (entity *Entity) VerifyClaims(container *document.Container, required map[string]string) error {
+	if !container.SignatureCovers("options.claims") {
+		return fmt.Errorf("Claims aren't covered by the signature: %w", ErrVerificationFailed)
+	}
+	if err := entity.Verify(container); err != nil {
+		return fmt.Errorf("Could not verify container: %w", err)
+	}
+
+	names := make([]string, 0, len(required))
+	for name := range required {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, ok := container.Data.Options.Claims[name]
+		if !ok {
+			return fmt.Errorf("Claim '%s' is missing: %w", name, ErrClaimMismatch)
+		}
+		if value != required[name] {
+			return fmt.Errorf("Expected claim '%s' to be '%s' but got '%s': %w", name, required[name], value, ErrClaimMismatch)
+		}
+	}
+	return nil
+}
+
+// ThreatSpec TMv0.1 for Entity.VerifyFresh
+// Does container signature and freshness verification for App:Entity
+
+// VerifyFresh verifies the container signature and then checks the signed nonce against the caller's seen-set.
+// It returns ErrMissingNonce if the container has no nonce and ErrReplayDetected if seen reports the nonce as already seen.
+func (entity *Entity) VerifyFresh(container *document.Container, seen func(nonce string) bool) error {
+	if err := entity.Verify(container); err != nil {
+		return fmt.Errorf("Could not verify container: %w", err)
+	}
+
+	nonce := container.Data.Options.SignatureInputs["nonce"]
+	if len(nonce) == 0 {
+		return ErrMissingNonce
+	}
+
+	if seen(nonce) {
+		return ErrReplayDetected
+	}
+	return nil
+}
+
+// ThreatSpec TMv0.1 for Entity.SignChallenge
+// Does challenge signing for App:Entity
+// Mitigates App:Entity against cross-protocol use of signatures with dedicated container type for challenge responses
+
+// SignChallenge signs a challenge, such as a server provided nonce, returning a challenge response container.
+// The container body is the base64 encoded tagged hash of the challenge, see crypto.TaggedHash, so that the signature
+// is bound to the challenge without signing caller supplied bytes directly.
+func (entity *Entity) SignChallenge(challenge []byte) (*document.Container, error) {
+	if len(challenge) == 0 {
+		return nil, fmt.Errorf("Challenge can't be empty")
+	}
+
+	container, err := document.NewContainer(nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create container: %s", err)
+	}
+	container.Data.Type = ChallengeResponseType
+	container.Data.Options.Source = entity.Data.Body.Id
+	container.Data.Body = challengeBody(challenge)
+	if err := entity.Sign(container); err != nil {
+		return nil, fmt.Errorf("Could not sign container: %s", err)
+	}
+	return container, nil
+}
+
+// ThreatSpec TMv0.1 for Entity.VerifyChallenge
+// Does challenge response verification for App:Entity
+
+// VerifyChallenge verifies that the container is a challenge response signed by the entity for exactly the given challenge.
+// It returns ErrChallengeMismatch if the container is for a different challenge or isn't a challenge response.
+func (entity *Entity) VerifyChallenge(container *document.Container, challenge []byte) error {
+	if err := entity.Verify(container); err != nil {
+		return fmt.Errorf("Could not verify container: %w", err)
+	}
+
+	if container.Data.Type != ChallengeResponseType || len(challenge) == 0 ||
+		container.Data.Body != challengeBody(challenge) {
+		return ErrChallengeMismatch
+	}
+	return nil
+}
+
+// challengeBody returns the challenge response container body for the challenge.
+func challengeBody(challenge []byte) string {
+	return string(crypto.Base64Encode(crypto.TaggedHash(crypto.TagChallenge, challenge)))
 }
 
 // ThreatSpec TMv0.1 for Entity.AuthenticateString
@@ -537,11 +1919,169 @@ func (entity *Entity) AuthenticateString(content, id, key string) (*document.Con
 	}
 }
 
+// ThreatSpec TMv0.1 for Entity.AuthenticateBatch
+// Does batch string authentication using shared keys for App:Entity
+
+// AuthenticateBatch is like AuthenticateString for many messages, but expands the key only once. The expansion is the
+// expensive part of authentication, so all returned containers share a single fresh salt and expanded key.
+// VerifyAuthentication checks each container on its own.
+func (entity *Entity) AuthenticateBatch(contents []string, id, key string) ([]*document.Container, error) {
+	rawKey, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode key: %s", err)
+	}
+
+	newKey, salt, err := crypto.ExpandKeyWithSaltSize(rawKey, crypto.DefaultSaltSize)
+	if err != nil {
+		return nil, fmt.Errorf("Could not expand key: %w", err)
+	}
+
+	containers := make([]*document.Container, len(contents))
+	for i, content := range contents {
+		container, err := document.NewContainer(nil)
+		if err != nil {
+			return nil, fmt.Errorf("Could not create container: %s", err)
+		}
+		container.Data.Options.Source = entity.Data.Body.Id
+		container.Data.Body = content
+		if err := authenticateWithExpandedKey(container, id, newKey, salt); err != nil {
+			return nil, fmt.Errorf("Could not sign container %d: %w", i, err)
+		}
+		containers[i] = container
+	}
+	return containers, nil
+}
+
 // ThreatSpec TMv0.1 for Entity.Encrypt
 // Does public key encryption for App:Entity
 
-// Encrypt takes a plaintext string and encrypts it for each provided entity.
-func (entity *Entity) Encrypt(content string, entities []Encrypter) (*document.Container, error) {
+// Encrypt takes a plaintext string and encrypts it for each provided entity, or for the entity itself if entities is nil.
+// An empty, non-nil slice of entities without other recipients returns ErrNoRecipients, as no one could decrypt the container.
+// The content-digest option is set to the digest of the ciphertext, see document.Container.ContentDigest.
+//
+// Additional recipients, such as a crypto.PSKRecipient for a service holding a pre-shared key, can be given and are
+// mixed with the entities in the same container. Their ids must not clash with the entity ids.
+// It returns ErrDuplicateRecipient if an id is repeated, rather than encrypting for only one of the keys.
+func (entity *Entity) Encrypt(content string, entities []Encrypter, recipients ...crypto.Recipient) (*document.Container, error) {
+	defer crypto.Observe(crypto.OperationEncrypt, crypto.StartTimer())
+	container, err := document.NewContainer(nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create container: %s", err)
+	}
+
+	container.Data.Options.Source = entity.Data.Body.Id
+	encryptionKeys, err := entity.encryptionKeys(entities)
+	if err != nil {
+		return nil, err
+	}
+	recipients = append(crypto.PublicKeyRecipients(encryptionKeys), recipients...)
+	if _, err := container.EncryptForRecipients(content, recipients); err != nil {
+		return nil, fmt.Errorf("Could not encrypt container: %w", err)
+	}
+	container.SetContentDigest()
+	return container, nil
+}
+
+// ThreatSpec TMv0.1 for Entity.EncryptForEscrow
+// Does public key encryption returning the data key for escrow for App:Entity
+
+// EncryptForEscrow is like Encrypt, but also returns the raw data key, separately from the container, so that it can be
+// escrowed with a separate custodian. The data key can decrypt the container without any private key, using
+// document.Container.DecryptWithDataKey, so it must be protected at least as well as the recipients' private keys
+// and never stored alongside the container.
+func (entity *Entity) EncryptForEscrow(content string, entities []Encrypter) (*document.Container, []byte, error) {
+	defer crypto.Observe(crypto.OperationEncrypt, crypto.StartTimer())
+	container, err := document.NewContainer(nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not create container: %s", err)
+	}
+
+	container.Data.Options.Source = entity.Data.Body.Id
+	encryptionKeys, err := entity.encryptionKeys(entities)
+	if err != nil {
+		return nil, nil, err
+	}
+	dataKey, err := container.EncryptForEscrow(content, encryptionKeys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not encrypt container: %w", err)
+	}
+	container.SetContentDigest()
+	return container, dataKey, nil
+}
+
+// ThreatSpec TMv0.1 for Entity.EncryptSplit
+// Does public key encryption with detached ciphertext for App:Entity
+
+// EncryptSplit is like Encrypt, but returns the ciphertext separately from a small header container, so that large
+// payloads can be stored apart from the header, such as in object storage. The header holds the wrapped data keys and
+// everything else needed to decrypt, including the content digest of the ciphertext. It is signed by the entity, so that
+// the ciphertext is bound to the signature. DecryptSplit recombines them.
+func (entity *Entity) EncryptSplit(content string, entities []Encrypter) (*document.Container, []byte, error) {
+	header, err := entity.Encrypt(content, entities)
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphertext, err := header.Detach()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not detach ciphertext: %s", err)
+	}
+	if err := entity.Sign(header); err != nil {
+		return nil, nil, fmt.Errorf("Could not sign header: %w", err)
+	}
+	return header, ciphertext, nil
+}
+
+// ThreatSpec TMv0.1 for Entity.DecryptSplit
+// Does public key decryption of detached ciphertext for App:Entity
+// Mitigates App:Entity against substitution of detached ciphertext with header verification before the content digest is used
+
+// DecryptSplit verifies a header from EncryptSplit, then decrypts the ciphertext using it, like VerifyThenDecrypt.
+// The header is verified as signed, before the ciphertext is attached, so that the content digest is authenticated
+// and headers signed with any signature version verify. The header isn't modified.
+// It returns ErrVerificationFailed if the header doesn't verify and document.ErrContentDigestMismatch if the
+// ciphertext doesn't belong to the header.
+func (entity *Entity) DecryptSplit(header *document.Container, ciphertext []byte) (_ string, err error) {
+	if err := entity.Verify(header); err != nil {
+		return "", fmt.Errorf("Could not verify header: %w", err)
+	}
+	defer func() { entity.logAudit(AuditOperationDecrypt, header.Data.Options.Source, err) }()
+	container, err := document.NewContainer(header.Dump())
+	if err != nil {
+		return "", fmt.Errorf("Could not load header: %w", err)
+	}
+	if err := container.Attach(ciphertext); err != nil {
+		return "", fmt.Errorf("Could not attach ciphertext: %w", err)
+	}
+	return entity.decrypt(container)
+}
+
+// ThreatSpec TMv0.1 for Entity.EncryptWithAAD
+// Does public key authenticated encryption for App:Entity
+
+// EncryptWithAAD takes a plaintext string and encrypts it for each provided entity using an authenticated cipher,
+// binding the additional data to the ciphertext.
+func (entity *Entity) EncryptWithAAD(content string, entities []Encrypter, additionalData string) (*document.Container, error) {
+	defer crypto.Observe(crypto.OperationEncrypt, crypto.StartTimer())
+	container, err := document.NewContainer(nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create container: %s", err)
+	}
+
+	container.Data.Options.Source = entity.Data.Body.Id
+	encryptionKeys, err := entity.encryptionKeys(entities)
+	if err != nil {
+		return nil, err
+	}
+	if err := container.EncryptWithAAD(content, encryptionKeys, additionalData); err != nil {
+		return nil, fmt.Errorf("Could not encrypt container: %w", err)
+	}
+	container.SetContentDigest()
+	return container, nil
+}
+
+// encryptionKeys returns the public encryption keys of the provided entities by id. If entities is nil, the entity's own key is used.
+// It returns ErrDuplicateRecipient if an id is repeated.
+func (entity *Entity) encryptionKeys(entities []Encrypter) (map[string]string, error) {
 	encryptionKeys := make(map[string]string)
 
 	if entities == nil {
@@ -549,21 +2089,169 @@ func (entity *Entity) Encrypt(content string, entities []Encrypter) (*document.C
 		encryptionKeys[entity.Id()] = body.PublicEncryptionKey
 	} else {
 		for _, e := range entities {
+			if _, ok := encryptionKeys[e.Id()]; ok {
+				return nil, fmt.Errorf("Recipient '%s': %w", e.Id(), ErrDuplicateRecipient)
+			}
 			body := e.Body()
 			encryptionKeys[e.Id()] = body.PublicEncryptionKey
 		}
 
 	}
+	return encryptionKeys, nil
+}
+
+// ThreatSpec TMv0.1 for Entity.ValidateRecipients
+// Does recipient validation before encryption for App:Entity
+// Mitigates App:Entity against partially completed large encryptions with recipient checks before key wrapping
+
+// ValidateRecipients checks the recipients as Encrypt would, but stops before wrapping any keys, so that a bad recipient
+// is found before an expensive encryption. The recipients can be nil for the entity itself, an Encrypter, a []Encrypter
+// or a []*Entity. It returns ErrDuplicateRecipient if an id is repeated and ErrInvalidRecipient if an id is empty or a
+// public encryption key is missing or can't be decoded. See crypto.ValidateRecipients.
+func (entity *Entity) ValidateRecipients(recipients interface{}) error {
+	entities, err := encrypters(recipients)
+	if err != nil {
+		return err
+	}
+	if entities == nil {
+		entities = []Encrypter{entity}
+	}
+
+	cryptoRecipients := make([]crypto.Recipient, len(entities))
+	for i, e := range entities {
+		cryptoRecipients[i] = crypto.PublicKeyRecipient{Id: e.Id(), PublicKey: e.Body().PublicEncryptionKey}
+	}
+	return crypto.ValidateRecipients(cryptoRecipients)
+}
+
+// encrypters converts recipients to a slice of Encrypters. The recipients can be nil, an Encrypter, a []Encrypter or a []*Entity.
+func encrypters(recipients interface{}) ([]Encrypter, error) {
+	var entities []Encrypter
+	switch r := recipients.(type) {
+	case nil:
+		return nil, nil
+	case Encrypter:
+		entities = []Encrypter{r}
+	case []Encrypter:
+		entities = r
+	case []*Entity:
+		entities = make([]Encrypter, len(r))
+		for i, e := range r {
+			entities[i] = e
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported recipients type: %T", r)
+	}
+	if len(entities) == 0 {
+		return nil, ErrNoRecipients
+	}
+	return entities, nil
+}
+
+// ThreatSpec TMv0.1 for Entity.EncryptJSON
+// Does public key encryption of structured data for App:Entity
+
+// EncryptJSON marshals v to JSON and encrypts it for the recipients, recording the JSON content type in the container headers.
+// The recipients can be nil for the entity itself, an Encrypter, a []Encrypter or a []*Entity.
+func (entity *Entity) EncryptJSON(v interface{}, recipients interface{}) (*document.Container, error) {
+	entities, err := encrypters(recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("Could not marshal content: %s", err)
+	}
+
+	return entity.EncryptWithType(string(content), document.ContentTypeJSON, entities)
+}
+
+// ThreatSpec TMv0.1 for Entity.EncryptWithType
+// Does public key encryption with a content type for App:Entity
+
+// EncryptWithType is like Encrypt, but records the media type of the content, such as document.ContentTypeText, in the
+// content-type header, so that DecryptWithType can return it. An empty content type isn't recorded.
+//
+// The content type is a plaintext header rather than an encrypted option, like the one recorded by EncryptJSON, so that
+// it can be used for routing without decrypting and is covered by a signature added afterwards. It is visible to anyone
+// holding the container; use Container.SetEncryptedOption for metadata that must stay confidential.
+func (entity *Entity) EncryptWithType(content, contentType string, entities []Encrypter, recipients ...crypto.Recipient) (*document.Container, error) {
+	container, err := entity.Encrypt(content, entities, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if len(contentType) > 0 {
+		container.SetHeader(document.ContentTypeHeader, contentType)
+	}
+	return container, nil
+}
+
+// ThreatSpec TMv0.1 for Entity.DecryptWithType
+// Does container decryption with a content type for App:Entity
+
+// DecryptWithType is like Decrypt, but also returns the content type recorded by EncryptWithType or EncryptJSON,
+// or an empty string if none was recorded.
+func (entity *Entity) DecryptWithType(container *document.Container) (string, string, error) {
+	content, err := entity.Decrypt(container)
+	if err != nil {
+		return "", "", err
+	}
+	return content, container.GetHeader(document.ContentTypeHeader), nil
+}
+
+// ThreatSpec TMv0.1 for Entity.DecryptJSON
+// Does container decryption of structured data for App:Entity
+
+// DecryptJSON decrypts a container created by EncryptJSON and unmarshals the content into v, which must be a pointer.
+// It returns ErrContentTypeMismatch if the container content type isn't JSON.
+func (entity *Entity) DecryptJSON(container *document.Container, v interface{}) error {
+	if contentType := container.GetHeader(document.ContentTypeHeader); contentType != document.ContentTypeJSON {
+		return fmt.Errorf("Expected content type '%s' but got '%s': %w", document.ContentTypeJSON, contentType, ErrContentTypeMismatch)
+	}
+
+	content, err := entity.Decrypt(container)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal([]byte(content), v); err != nil {
+		return fmt.Errorf("Could not unmarshal content: %s", err)
+	}
+	return nil
+}
+
+// ThreatSpec TMv0.1 for Entity.EncryptAnonymous
+// Does public key encryption without sender identity for App:Entity
+// Mitigates App:Entity against disclosure of sender identity with omitted source
+
+// EncryptAnonymous takes a plaintext string and encrypts it for the recipients without recording the entity as the source.
+// The recipients can be nil for the entity itself, an Encrypter, a []Encrypter or a []*Entity.
+//
+// Key wrapping never involves the sender's keys: RSA uses OAEP and EC uses ECIES with an ephemeral key, so recipients
+// can decrypt but can't learn the sender from the container. The tradeoff is that recipients have no way of knowing who
+// sent the content either, so it must not be trusted on the basis of its origin. The container mustn't be signed, as that
+// would identify the sender. Recipient ids are still visible to anyone who sees the container.
+func (entity *Entity) EncryptAnonymous(content string, recipients interface{}) (*document.Container, error) {
+	defer crypto.Observe(crypto.OperationEncrypt, crypto.StartTimer())
+	entities, err := encrypters(recipients)
+	if err != nil {
+		return nil, err
+	}
 
 	container, err := document.NewContainer(nil)
 	if err != nil {
 		return nil, fmt.Errorf("Could not create container: %s", err)
 	}
 
-	container.Data.Options.Source = entity.Data.Body.Id
+	encryptionKeys, err := entity.encryptionKeys(entities)
+	if err != nil {
+		return nil, err
+	}
 	if err := container.Encrypt(content, encryptionKeys); err != nil {
-		return nil, fmt.Errorf("Could not encrypt container: %s", err)
+		return nil, fmt.Errorf("Could not encrypt container: %w", err)
 	}
+	container.SetContentDigest()
 	return container, nil
 }
 
@@ -588,8 +2276,12 @@ func (entity *Entity) SymmetricEncrypt(content, id, key string) (*document.Conta
 
 // ThreatSpec TMv0.1 for Entity.EncryptThenSignString
 // Does public key encrypt-then-sign of strings for App:Entity
+// Mitigates App:Entity against signatures over discarded plaintext with signing only after encryption
 
-// EncryptThenSignString takes a plaintext string, encrypts it then signs the ciphertext.
+// EncryptThenSignString takes a plaintext string, encrypts it into a new container then signs the ciphertext,
+// so the signature covers the ciphertext. Signing and encrypting separately should be done in the same order:
+// the document.Container encrypt methods return document.ErrAlreadySigned for a signed container, rather than
+// replacing a signed body.
 func (entity *Entity) EncryptThenSignString(content string, entities []Encrypter) (*document.Container, error) {
 
 	container, err := entity.Encrypt(content, entities)
@@ -604,6 +2296,29 @@ func (entity *Entity) EncryptThenSignString(content string, entities []Encrypter
 	return container, nil
 }
 
+// ThreatSpec TMv0.1 for Entity.SealSelf
+// Does encrypt-then-sign to self for App:Entity
+
+// SealSelf encrypts the content for the entity alone and signs the container, for storing notes that only the entity can read.
+// It is the same as EncryptThenSignString with the entity as the only recipient. Use OpenSelf to open the container.
+func (entity *Entity) SealSelf(content string) (*document.Container, error) {
+	return entity.EncryptThenSignString(content, []Encrypter{entity})
+}
+
+// ThreatSpec TMv0.1 for Entity.OpenSelf
+// Does verify-then-decrypt from self for App:Entity
+// Mitigates App:Entity against opening containers from others as own notes with source and recipient checks
+
+// OpenSelf verifies and decrypts a container from SealSelf. If the container's source isn't the entity or it is encrypted
+// for anyone else, ErrNotSealedForSelf is returned.
+func (entity *Entity) OpenSelf(container *document.Container) (string, error) {
+	keys := container.Data.Options.EncryptionKeys
+	if _, ok := keys[entity.Data.Body.Id]; container.Data.Options.Source != entity.Data.Body.Id || len(keys) != 1 || !ok {
+		return "", ErrNotSealedForSelf
+	}
+	return entity.VerifyThenDecrypt(container)
+}
+
 // ThreatSpec TMv0.1 for Entity.EncryptThenAuthenticateString
 // Does symmetric encrypt-then-mac of strings for App:Entity
 
@@ -626,19 +2341,65 @@ func (entity *Entity) EncryptThenAuthenticateString(content, id, key string) (*d
 // Does public key verify-then-decrypt for App:Entity
 
 // VerifyThenDecrypt takes a container, verifies the signature then decrypts, returning a plaintext string.
+//
+// If the container was encrypted with additional data, the additional data recorded in the (signed) options is supplied on decryption.
+// A signature failure is reported as ErrVerificationFailed and an additional data or ciphertext failure as crypto.ErrAuthenticationFailed,
+// which is also ErrVerificationFailed. Containers that can't be decoded return ErrMalformedContainer instead, so that
+// callers can tell a possible forgery, to be rejected, from an operational failure, which may be retried.
 func (entity *Entity) VerifyThenDecrypt(container *document.Container) (string, error) {
 	if err := entity.Verify(container); err != nil {
-		return "", fmt.Errorf("Could not verify container: %s", err)
+		return "", fmt.Errorf("Could not verify container: %w", err)
 	}
 
 	content, err := entity.Decrypt(container)
 	if err != nil {
-		return "", fmt.Errorf("Could not decrypt container: %s", err)
+		return "", fmt.Errorf("Could not decrypt container: %w", err)
 	}
 	return content, nil
 
 }
 
+// ThreatSpec TMv0.1 for Entity.DecryptThenVerify
+// Does public key decrypt-then-verify for App:Entity
+// Exposes App:Entity to processing of unauthenticated plaintext by decrypting before signature verification
+
+// DecryptThenVerify is like VerifyThenDecrypt, but decrypts first and only then verifies the signature, so that
+// containers the entity isn't a recipient of are rejected without the cost of verifying a signature.
+//
+// This is a tradeoff: the container is decrypted, and the plaintext exists in memory, before it is known to be
+// authentic, so decryption errors from forged containers are visible to the caller and may leak information about
+// the private key or plaintext through timing or error differences. The plaintext is only returned if the signature
+// verifies. Prefer VerifyThenDecrypt unless most containers come from untrusted sources and the entity is rarely a recipient.
+func (entity *Entity) DecryptThenVerify(container *document.Container) (string, error) {
+	content, err := entity.Decrypt(container)
+	if err != nil {
+		return "", fmt.Errorf("Could not decrypt container: %w", err)
+	}
+
+	if err := entity.Verify(container); err != nil {
+		return "", fmt.Errorf("Could not verify container: %w", err)
+	}
+	return content, nil
+}
+
+// ThreatSpec TMv0.1 for Entity.DecryptUnverified
+// Does public key decryption without required verification for App:Entity
+// Mitigates App:Entity against accidental trust of unverified content with an explicit verified flag
+
+// DecryptUnverified decrypts the container like Decrypt, without requiring a valid signature, so that content from
+// a signer that isn't trusted yet can be inspected. The returned bool is true only if the container is signed and
+// the signature verifies with the entity's public signing key, as in VerifyThenDecrypt. If it's false, the content
+// must be treated as unauthenticated. A verification failure isn't an error.
+func (entity *Entity) DecryptUnverified(container *document.Container) (string, bool, error) {
+	verified := container.IsSigned() && entity.Verify(container) == nil
+
+	content, err := entity.Decrypt(container)
+	if err != nil {
+		return "", false, fmt.Errorf("Could not decrypt container: %w", err)
+	}
+	return content, verified, nil
+}
+
 // ThreatSpec TMv0.1 for Entity.VerifyAuthenticationThenDecrypt
 // Does symmetric verify-then-decrypt for App:Entity
 
@@ -647,12 +2408,12 @@ func (entity *Entity) VerifyThenDecrypt(container *document.Container) (string,
 // Note: under the hood, the key is expanded into two separate keys, one for encryption and one for signing.
 func (entity *Entity) VerifyAuthenticationThenDecrypt(container *document.Container, key string) (string, error) {
 	if err := entity.VerifyAuthentication(container, key); err != nil {
-		return "", fmt.Errorf("Could not verify container: %s", err)
+		return "", fmt.Errorf("Could not verify container: %w", err)
 	}
 
 	content, err := entity.SymmetricDecrypt(container, key)
 	if err != nil {
-		return "", fmt.Errorf("Could not decrypt container: %s", err)
+		return "", fmt.Errorf("Could not decrypt container: %w", err)
 	}
 	return content, nil
 }
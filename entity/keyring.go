@@ -0,0 +1,114 @@
+// ThreatSpec package github.com/pki-io/core/entity as entity
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNotInKeyring is returned when an entity id isn't in a keyring.
+var ErrNotInKeyring = errors.New("Entity not in keyring")
+
+// EntityLookup finds entities by id, such as a Keyring or a KeyringSnapshot.
+type EntityLookup interface {
+	Get(id string) (*Entity, bool)
+}
+
+// entityMap holds entities by id.
+type entityMap map[string]*Entity
+
+// recipients returns the entities with the given ids as Encrypters.
+func (entities entityMap) recipients(ids []string) ([]Encrypter, error) {
+	recipients := make([]Encrypter, len(ids))
+	for i, id := range ids {
+		entity, ok := entities[id]
+		if !ok {
+			return nil, fmt.Errorf("Unknown recipient '%s': %w", id, ErrNotInKeyring)
+		}
+		recipients[i] = entity
+	}
+	return recipients, nil
+}
+
+// Keyring holds known entities by id, for verifying containers from several signers.
+// It is safe for concurrent use, so that it can be shared by goroutines while entities are added and removed.
+type Keyring struct {
+	mutex    sync.RWMutex
+	entities entityMap
+}
+
+// ThreatSpec TMv0.1 for NewKeyring
+// Creates new keyring for App:Entity
+
+// NewKeyring returns an empty Keyring.
+func NewKeyring() *Keyring {
+	return &Keyring{entities: make(entityMap)}
+}
+
+// Add adds the entities to the keyring, replacing any entity with the same id.
+func (keyring *Keyring) Add(entities ...*Entity) {
+	keyring.mutex.Lock()
+	defer keyring.mutex.Unlock()
+	for _, entity := range entities {
+		keyring.entities[entity.Id()] = entity
+	}
+}
+
+// Remove removes the entities with the given ids from the keyring. Ids that aren't in the keyring are ignored.
+func (keyring *Keyring) Remove(ids ...string) {
+	keyring.mutex.Lock()
+	defer keyring.mutex.Unlock()
+	for _, id := range ids {
+		delete(keyring.entities, id)
+	}
+}
+
+// Get returns the entity with the given id, and whether it is in the keyring.
+func (keyring *Keyring) Get(id string) (*Entity, bool) {
+	keyring.mutex.RLock()
+	defer keyring.mutex.RUnlock()
+	entity, ok := keyring.entities[id]
+	return entity, ok
+}
+
+// Recipients returns the entities with the given ids for encrypting to, see Entity.Encrypt.
+// If any id isn't in the keyring, ErrNotInKeyring is returned.
+func (keyring *Keyring) Recipients(ids ...string) ([]Encrypter, error) {
+	keyring.mutex.RLock()
+	defer keyring.mutex.RUnlock()
+	return keyring.entities.recipients(ids)
+}
+
+// ThreatSpec TMv0.1 for Keyring.Snapshot
+// Does snapshot of keyring for App:Entity
+// Mitigates App:Entity against inconsistent batch operations with immutable keyring snapshot
+
+// Snapshot returns an immutable view of the entities currently in the keyring, so that a batch of operations sees the same
+// entities even if the keyring changes. The entities themselves are shared with the keyring and shouldn't be modified.
+func (keyring *Keyring) Snapshot() *KeyringSnapshot {
+	keyring.mutex.RLock()
+	defer keyring.mutex.RUnlock()
+	entities := make(entityMap, len(keyring.entities))
+	for id, entity := range keyring.entities {
+		entities[id] = entity
+	}
+	return &KeyringSnapshot{entities: entities}
+}
+
+// KeyringSnapshot is an immutable view of a Keyring, returned by Keyring.Snapshot.
+type KeyringSnapshot struct {
+	entities entityMap
+}
+
+// Get returns the entity with the given id, and whether it is in the snapshot.
+func (snapshot *KeyringSnapshot) Get(id string) (*Entity, bool) {
+	entity, ok := snapshot.entities[id]
+	return entity, ok
+}
+
+// Recipients returns the entities with the given ids for encrypting to, see Entity.Encrypt.
+// If any id isn't in the snapshot, ErrNotInKeyring is returned.
+func (snapshot *KeyringSnapshot) Recipients(ids ...string) ([]Encrypter, error) {
+	return snapshot.entities.recipients(ids)
+}
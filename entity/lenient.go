@@ -0,0 +1,100 @@
+// ThreatSpec package github.com/pki-io/core/entity as entity
+package entity
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// EntityLenientSchema is EntitySchema, but allowing unknown body fields. It is used by LoadLenient.
+var EntityLenientSchema = lenientSchema(EntitySchema)
+
+// lenientSchema returns the schema with additional body properties allowed.
+func lenientSchema(schema string) string {
+	var s map[string]interface{}
+	if err := json.Unmarshal([]byte(schema), &s); err != nil {
+		panic(err)
+	}
+	body := s["properties"].(map[string]interface{})["body"].(map[string]interface{})
+	body["additionalProperties"] = true
+	lenient, err := json.Marshal(s)
+	if err != nil {
+		panic(err)
+	}
+	return string(lenient)
+}
+
+// ThreatSpec TMv0.1 for Entity.LoadLenient
+// Does lenient entity JSON loading for App:Entity
+
+// LoadLenient is like Load, but tolerates unknown body fields, for example from newer producers. The unknown fields
+// are kept in the body's Extra field and written back by Dump. The entity keeps using EntityLenientSchema afterwards,
+// so that it can be dumped. Unknown fields are dropped by Public, as they might not be public.
+func (entity *Entity) LoadLenient(jsonString interface{}) error {
+	validator, err := schemaValidator(EntityLenientSchema)
+	if err != nil {
+		return err
+	}
+	entity.Schema = EntityLenientSchema
+	entity.Validator = validator
+	return entity.load(&entity.Document, jsonString)
+}
+
+// entityBody has the fields of EntityBody without its JSON methods.
+type entityBody EntityBody
+
+// entityBodyFields are the JSON names of the known body fields.
+var entityBodyFields = jsonFields(reflect.TypeOf(EntityBody{}))
+
+// jsonFields returns the JSON names of the struct type's fields.
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; len(name) > 0 && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// MarshalJSON marshals the body, including any unknown fields in Extra.
+func (body EntityBody) MarshalJSON() ([]byte, error) {
+	known, err := json.Marshal(entityBody(body))
+	if err != nil || len(body.Extra) == 0 {
+		return known, err
+	}
+
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(known, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range body.Extra {
+		if !entityBodyFields[name] {
+			fields[name] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON unmarshals the body, keeping any unknown fields in Extra.
+func (body *EntityBody) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*entityBody)(body)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	body.Extra = nil
+	for name, value := range fields {
+		if !entityBodyFields[name] {
+			if body.Extra == nil {
+				body.Extra = make(map[string]json.RawMessage)
+			}
+			body.Extra[name] = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// ThreatSpec package github.com/pki-io/core/entity as entity
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pki-io/core/crypto"
+)
+
+// KeyProtectionScrypt is the key derivation function used by EncryptPrivateKeys.
+const KeyProtectionScrypt string = "scrypt"
+
+const keyProtectionNonceSize int = 12
+
+var (
+	// ErrPrivateKeysEncrypted is returned when private keys are encrypted again, or split while encrypted.
+	ErrPrivateKeysEncrypted = errors.New("Private keys are encrypted")
+	// ErrPrivateKeysNotEncrypted is returned by DecryptPrivateKeys when the private keys aren't encrypted.
+	ErrPrivateKeysNotEncrypted = errors.New("Private keys aren't encrypted")
+	// ErrInvalidPassphrase is returned by DecryptPrivateKeys when the passphrase is wrong or the keys have been modified.
+	ErrInvalidPassphrase = errors.New("Invalid passphrase")
+	// ErrWorkFactorTooHigh is returned when recorded key protection parameters exceed crypto.MaxScryptParams or crypto.MaxScryptCost.
+	// It is the same error as crypto.ErrWorkFactorTooHigh.
+	ErrWorkFactorTooHigh = crypto.ErrWorkFactorTooHigh
+)
+
+// KeyProtection records how the private keys were encrypted with a passphrase, so that DecryptPrivateKeys can reproduce the key.
+type KeyProtection struct {
+	KDF  string `json:"kdf"`
+	Salt string `json:"salt"`
+	crypto.ScryptParams
+}
+
+// ThreatSpec TMv0.1 for Entity.EncryptPrivateKeys
+// Does passphrase encryption of private keys for App:Entity
+// Mitigates App:Entity against private key disclosure from stolen entity documents with passphrase encryption
+// Mitigates App:Entity against passphrase brute forcing with recorded scrypt work factor
+
+// EncryptPrivateKeys encrypts the private keys, including previous encryption keys, with a key derived from the passphrase
+// using scrypt with the given parameters, such as crypto.DefaultScryptParams. The parameters and salt are recorded in the
+// entity so that DecryptPrivateKeys can derive the same key. The entity can't sign or decrypt until the keys are decrypted.
+func (entity *Entity) EncryptPrivateKeys(passphrase string, params crypto.ScryptParams) error {
+	if entity.Data.Body.PrivateKeyProtection != nil {
+		return ErrPrivateKeysEncrypted
+	}
+	if len(passphrase) == 0 {
+		return fmt.Errorf("Passphrase can't be empty")
+	}
+
+	salt, err := crypto.RandomBytes(crypto.DefaultSaltSize)
+	if err != nil {
+		return err
+	}
+	key, err := crypto.DeriveKeyScrypt([]byte(passphrase), salt, params)
+	if err != nil {
+		return err
+	}
+
+	protected := make(map[*string]string)
+	for name, privateKey := range entity.privateKeys() {
+		ciphertext, nonce, err := crypto.AESGCMEncrypt([]byte(*privateKey), key, entity.keyProtectionAAD(name))
+		if err != nil {
+			return fmt.Errorf("Could not encrypt %s: %s", name, err)
+		}
+		protected[privateKey] = string(crypto.Base64Encode(append(nonce, ciphertext...)))
+	}
+
+	for privateKey, ciphertext := range protected {
+		*privateKey = ciphertext
+	}
+	entity.Data.Body.PrivateKeyProtection = &KeyProtection{
+		KDF:          KeyProtectionScrypt,
+		Salt:         string(crypto.Base64Encode(salt)),
+		ScryptParams: params,
+	}
+	return nil
+}
+
+// ThreatSpec TMv0.1 for Entity.DecryptPrivateKeys
+// Does passphrase decryption of private keys for App:Entity
+// Mitigates App:Entity against resource exhaustion with upper bound on recorded work factor
+
+// DecryptPrivateKeys decrypts private keys encrypted by EncryptPrivateKeys, using the recorded parameters.
+// Parameters above crypto.MaxScryptParams or crypto.MaxScryptCost return ErrWorkFactorTooHigh without deriving a key.
+// A wrong passphrase returns ErrInvalidPassphrase and leaves the keys encrypted.
+func (entity *Entity) DecryptPrivateKeys(passphrase string) error {
+	protection := entity.Data.Body.PrivateKeyProtection
+	if protection == nil {
+		return ErrPrivateKeysNotEncrypted
+	}
+	if protection.KDF != KeyProtectionScrypt {
+		return fmt.Errorf("Unsupported key derivation function '%s'", protection.KDF)
+	}
+
+	salt, err := crypto.Base64Decode([]byte(protection.Salt))
+	if err != nil {
+		return fmt.Errorf("Could not decode salt: %s", err)
+	}
+	key, err := crypto.DeriveKeyScrypt([]byte(passphrase), salt, protection.ScryptParams)
+	if err != nil {
+		return err
+	}
+
+	decrypted := make(map[*string]string)
+	for name, privateKey := range entity.privateKeys() {
+		raw, err := crypto.Base64Decode([]byte(*privateKey))
+		if err != nil || len(raw) < keyProtectionNonceSize {
+			return fmt.Errorf("Could not decode %s: %w", name, ErrInvalidPassphrase)
+		}
+		plaintext, err := crypto.AESGCMDecrypt(raw[keyProtectionNonceSize:], raw[:keyProtectionNonceSize], key, entity.keyProtectionAAD(name))
+		if err != nil {
+			return fmt.Errorf("Could not decrypt %s: %w", name, ErrInvalidPassphrase)
+		}
+		decrypted[privateKey] = string(plaintext)
+	}
+
+	for privateKey, plaintext := range decrypted {
+		*privateKey = plaintext
+	}
+	entity.Data.Body.PrivateKeyProtection = nil
+	return nil
+}
+
+// PrivateKeysEncrypted returns whether the private keys are encrypted with a passphrase.
+func (entity *Entity) PrivateKeysEncrypted() bool {
+	return entity.Data.Body.PrivateKeyProtection != nil
+}
+
+// privateKeys returns the entity's non-empty private keys by field name.
+func (entity *Entity) privateKeys() map[string]*string {
+	body := &entity.Data.Body
+	keys := make(map[string]*string)
+	if len(body.PrivateSigningKey) > 0 {
+		keys["private-signing-key"] = &body.PrivateSigningKey
+	}
+	if len(body.PrivateEncryptionKey) > 0 {
+		keys["private-encryption-key"] = &body.PrivateEncryptionKey
+	}
+	for i := range body.PreviousEncryptionKeys {
+		if len(body.PreviousEncryptionKeys[i].PrivateKey) > 0 {
+			keys[fmt.Sprintf("previous-encryption-keys[%d]", i)] = &body.PreviousEncryptionKeys[i].PrivateKey
+		}
+	}
+	return keys
+}
+
+// keyProtectionAAD returns the additional data binding an encrypted private key to the entity and field.
+func (entity *Entity) keyProtectionAAD(name string) []byte {
+	return []byte(entity.Data.Body.Id + "/" + name)
+}
@@ -0,0 +1,49 @@
+// ThreatSpec package github.com/pki-io/core/entity as entity
+package entity
+
+import (
+	"fmt"
+	"github.com/pki-io/core/crypto"
+	"github.com/pki-io/core/document"
+)
+
+// DecryptSession decrypts containers for an entity using a private encryption key that is parsed once, for bulk decryption.
+type DecryptSession struct {
+	id        string
+	decrypter *crypto.KeyDecrypter
+}
+
+// ThreatSpec TMv0.1 for Entity.OpenSession
+// Creates decryption session for App:Entity
+
+// OpenSession parses the entity's private encryption key and returns a session that reuses it to decrypt containers.
+// Previous encryption keys aren't used by the session. The session should be closed when done.
+func (entity *Entity) OpenSession() (*DecryptSession, error) {
+	decrypter, err := crypto.NewKeyDecrypter(entity.Data.Body.PrivateEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse private encryption key: %s", err)
+	}
+	return &DecryptSession{id: entity.Data.Body.Id, decrypter: decrypter}, nil
+}
+
+// ThreatSpec TMv0.1 for DecryptSession.Decrypt
+// Does container decryption using a parsed private key for App:Entity
+
+// Decrypt takes a Container and decrypts the content using the session's private key, returning a plaintext string.
+// It returns crypto.ErrKeyZeroed if the session has been closed.
+func (session *DecryptSession) Decrypt(container *document.Container) (_ string, err error) {
+	defer crypto.Observe(crypto.OperationDecrypt, crypto.StartTimer())
+	defer func() { logAuditEvent(session.id, AuditOperationDecrypt, container.Data.Options.Source, err) }()
+	if container.IsEncrypted() == false {
+		return "", fmt.Errorf("Container isn't encrypted")
+	}
+	return container.DecryptWith(session.id, session.decrypter)
+}
+
+// ThreatSpec TMv0.1 for DecryptSession.Close
+// Mitigates App:Entity against private key disclosure from memory with zeroing of key on close
+
+// Close zeroes the parsed private key. The session can't be used afterwards.
+func (session *DecryptSession) Close() {
+	session.decrypter.Zero()
+}
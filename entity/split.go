@@ -0,0 +1,256 @@
+// ThreatSpec package github.com/pki-io/core/entity as entity
+package entity
+
+import (
+	gocrypto "crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pki-io/core/crypto"
+	"github.com/pki-io/core/document"
+)
+
+// PrivateKeyDocumentDefault sets default values for a PrivateKeyDocument.
+const PrivateKeyDocumentDefault string = `{
+    "scope": "pki.io",
+    "version": 1,
+    "type": "entity-private-key-document",
+    "options": "",
+    "body": {
+      "id": "",
+      "private-signing-key": "",
+      "private-encryption-key": ""
+    }
+}`
+
+// PrivateKeyDocumentSchema defines the JSON Schema for a PrivateKeyDocument.
+const PrivateKeyDocumentSchema string = `{
+  "$schema": "http://json-schema.org/draft-04/schema#",
+  "title": "EntityPrivateKeyDocument",
+  "description": "Entity Private Key Document",
+  "type": "object",
+  "required": ["scope","version","type","options","body"],
+  "additionalProperties": false,
+  "properties": {
+      "scope": {
+          "description": "Scope of the document",
+          "type": "string"
+      },
+      "version": {
+          "description": "Document schema version",
+          "type": "integer"
+      },
+      "type": {
+          "description": "Type of document",
+          "type": "string"
+      },
+      "options": {
+          "description": "Options data",
+          "type": "string"
+      },
+      "body": {
+          "description": "Body data",
+          "type": "object",
+          "required": ["id", "private-signing-key", "private-encryption-key"],
+          "additionalProperties": false,
+          "properties": {
+              "id" : {
+                  "description": "Entity ID",
+                  "type": "string"
+              },
+              "private-signing-key" : {
+                  "description": "Private signing key",
+                  "type": "string"
+              },
+              "private-encryption-key" : {
+                  "description": "Private encryption key",
+                  "type": "string"
+              },
+              "previous-encryption-keys" : {
+                  "description": "Private keys of the entity's previous encryption keys, in the same order",
+                  "type": "array",
+                  "items": {
+                      "type": "string"
+                  }
+              },
+              "extra" : {
+                  "description": "Unknown entity body fields kept by lenient loading",
+                  "type": "object"
+              }
+          }
+      }
+  }
+}`
+
+// ErrKeyDocumentMismatch is returned by Join when the private key document doesn't belong to the public entity.
+var ErrKeyDocumentMismatch = errors.New("Private key document doesn't match entity")
+
+// PrivateKeyDocumentData represents parsed PrivateKeyDocument JSON data.
+type PrivateKeyDocumentData struct {
+	Scope   string `json:"scope"`
+	Version int    `json:"version"`
+	Type    string `json:"type"`
+	Options string `json:"options"`
+	Body    struct {
+		Id                     string                     `json:"id"`
+		PrivateSigningKey      string                     `json:"private-signing-key"`
+		PrivateEncryptionKey   string                     `json:"private-encryption-key"`
+		PreviousEncryptionKeys []string                   `json:"previous-encryption-keys,omitempty"`
+		Extra                  map[string]json.RawMessage `json:"extra,omitempty"`
+	} `json:"body"`
+}
+
+// PrivateKeyDocument holds an entity's private keys separately from its public metadata, see Entity.SplitDocuments.
+type PrivateKeyDocument struct {
+	document.Document
+	Data PrivateKeyDocumentData
+}
+
+// ThreatSpec TMv0.1 for NewPrivateKeyDocument
+// Creates new private key document for App:Entity
+
+// NewPrivateKeyDocument returns a new PrivateKeyDocument, loaded from the JSON if given.
+func NewPrivateKeyDocument(jsonString interface{}) (*PrivateKeyDocument, error) {
+	doc := new(PrivateKeyDocument)
+	doc.Schema = PrivateKeyDocumentSchema
+	doc.Default = PrivateKeyDocumentDefault
+	data := new(PrivateKeyDocumentData)
+	if data, err := doc.FromJson(jsonString, data); err != nil {
+		return nil, fmt.Errorf("Could not load private key document json: %s", err)
+	} else {
+		doc.Data = *data.(*PrivateKeyDocumentData)
+		return doc, nil
+	}
+}
+
+// Id returns the id of the entity the keys belong to.
+func (doc *PrivateKeyDocument) Id() string {
+	return doc.Data.Body.Id
+}
+
+// Dump serializes the PrivateKeyDocument, returning a JSON string.
+func (doc *PrivateKeyDocument) Dump() string {
+	if jsonString, err := doc.ToJson(doc.Data); err != nil {
+		return ""
+	} else {
+		return jsonString
+	}
+}
+
+// ThreatSpec TMv0.1 for Entity.SplitDocuments
+// Does splitting of entity into public and private documents for App:Entity
+// Mitigates App:Entity against private key exposure with private keys stored separately from public metadata
+
+// SplitDocuments returns the entity's public metadata, as returned by Public, and a separate document with its private keys,
+// so that they can be stored with different access controls. The documents are linked by the entity id and can be
+// recombined with Join. Unknown body fields kept by LoadLenient go in the private key document, as they might not be public.
+// The public document must be loaded with LoadPublic, as Load requires the private keys.
+func (entity *Entity) SplitDocuments() (*Entity, *PrivateKeyDocument, error) {
+	if entity.PrivateKeysEncrypted() {
+		return nil, nil, ErrPrivateKeysEncrypted
+	}
+	if len(entity.Data.Body.PrivateSigningKey) == 0 || len(entity.Data.Body.PrivateEncryptionKey) == 0 {
+		return nil, nil, fmt.Errorf("Entity has no private keys")
+	}
+
+	public, err := entity.Public()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	private, err := NewPrivateKeyDocument(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	body := &private.Data.Body
+	body.Id = entity.Data.Body.Id
+	body.PrivateSigningKey = entity.Data.Body.PrivateSigningKey
+	body.PrivateEncryptionKey = entity.Data.Body.PrivateEncryptionKey
+	for _, previous := range entity.Data.Body.PreviousEncryptionKeys {
+		body.PreviousEncryptionKeys = append(body.PreviousEncryptionKeys, previous.PrivateKey)
+	}
+	body.Extra = entity.Data.Body.Extra
+	return public, private, nil
+}
+
+// ThreatSpec TMv0.1 for Join
+// Does recombining of public and private entity documents for App:Entity
+// Mitigates App:Entity against mismatched keys with id and key pair checks
+
+// Join recombines public metadata and a private key document from SplitDocuments into a full entity.
+// It returns ErrKeyDocumentMismatch if the ids differ or the private keys don't match the public keys.
+func Join(public *Entity, private *PrivateKeyDocument) (*Entity, error) {
+	if public.Data.Body.Id != private.Data.Body.Id {
+		return nil, fmt.Errorf("Expected id '%s' but got '%s': %w", public.Data.Body.Id, private.Data.Body.Id, ErrKeyDocumentMismatch)
+	}
+	if len(public.Data.Body.PreviousEncryptionKeys) != len(private.Data.Body.PreviousEncryptionKeys) {
+		return nil, fmt.Errorf("Previous encryption key counts differ: %w", ErrKeyDocumentMismatch)
+	}
+
+	pairs := [][2]string{
+		{private.Data.Body.PrivateSigningKey, public.Data.Body.PublicSigningKey},
+		{private.Data.Body.PrivateEncryptionKey, public.Data.Body.PublicEncryptionKey},
+	}
+	for i, previous := range public.Data.Body.PreviousEncryptionKeys {
+		pairs = append(pairs, [2]string{private.Data.Body.PreviousEncryptionKeys[i], previous.PublicKey})
+	}
+	for _, pair := range pairs {
+		if err := checkKeyPair(pair[0], pair[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	entity, err := New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create entity: %s", err)
+	}
+	entity.Data = public.Data
+	body := &entity.Data.Body
+	body.PrivateSigningKey = private.Data.Body.PrivateSigningKey
+	body.PrivateEncryptionKey = private.Data.Body.PrivateEncryptionKey
+	body.PreviousEncryptionKeys = nil
+	for i, previous := range public.Data.Body.PreviousEncryptionKeys {
+		previous.PrivateKey = private.Data.Body.PreviousEncryptionKeys[i]
+		body.PreviousEncryptionKeys = append(body.PreviousEncryptionKeys, previous)
+	}
+	if public.Data.Body.Roles != nil {
+		body.Roles = append([]string(nil), public.Data.Body.Roles...)
+	}
+	if public.Data.Body.PreviousSigningKeys != nil {
+		body.PreviousSigningKeys = append([]PreviousKey(nil), public.Data.Body.PreviousSigningKeys...)
+	}
+	if len(private.Data.Body.Extra) > 0 {
+		body.Extra = private.Data.Body.Extra
+		entity.Schema = EntityLenientSchema
+	}
+	return entity, nil
+}
+
+// checkKeyPair returns ErrKeyDocumentMismatch if the PEM encoded private key isn't the pair of the PEM encoded public key.
+func checkKeyPair(privateKeyPem, publicKeyPem string) error {
+	privateKey, err := crypto.PemDecodePrivate([]byte(privateKeyPem))
+	if err != nil {
+		return fmt.Errorf("Could not decode private key: %s", err)
+	}
+	publicKey, err := crypto.PemDecodePublic([]byte(publicKeyPem))
+	if err != nil {
+		return fmt.Errorf("Could not decode public key: %s", err)
+	}
+
+	signer, ok := privateKey.(gocrypto.Signer)
+	if !ok {
+		return fmt.Errorf("Unsupported private key type %T", privateKey)
+	}
+	privateFingerprint, err := crypto.Fingerprint(signer.Public())
+	if err != nil {
+		return err
+	}
+	publicFingerprint, err := crypto.Fingerprint(publicKey)
+	if err != nil {
+		return err
+	}
+	if privateFingerprint != publicFingerprint {
+		return fmt.Errorf("Private key doesn't match public key: %w", ErrKeyDocumentMismatch)
+	}
+	return nil
+}
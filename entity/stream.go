@@ -0,0 +1,100 @@
+// ThreatSpec package github.com/pki-io/core/entity as entity
+package entity
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/pki-io/core/crypto"
+	"github.com/pki-io/core/document"
+	"hash"
+)
+
+// StreamSignatureType is the container type of stream signatures, see Entity.NewStreamSigner.
+const StreamSignatureType = "stream-signature"
+
+// ErrStreamMismatch is returned when a stream doesn't match the digest in its stream signature.
+var ErrStreamMismatch = errors.New("Stream doesn't match signature")
+
+// StreamSigner signs a stream in one pass without buffering it. Data written to it is hashed incrementally, and
+// Finalize signs a container over the digest.
+type StreamSigner struct {
+	entity *Entity
+	hash   hash.Hash
+}
+
+// ThreatSpec TMv0.1 for Entity.NewStreamSigner
+// Does creation of incremental stream signer for App:Entity
+
+// NewStreamSigner returns a StreamSigner that signs with the entity's private signing key.
+func (entity *Entity) NewStreamSigner() *StreamSigner {
+	return &StreamSigner{entity: entity, hash: crypto.NewTaggedHash(crypto.TagStreamDigest)}
+}
+
+// Write adds data to the signed stream. It never returns an error.
+func (signer *StreamSigner) Write(p []byte) (int, error) {
+	return signer.hash.Write(p)
+}
+
+// ThreatSpec TMv0.1 for StreamSigner.Finalize
+// Does signing of stream digest for App:Entity
+// Mitigates App:Entity against confusing stream signatures with other containers with a dedicated container type and hash tag
+
+// Finalize returns a signed container of type StreamSignatureType whose body is the hex encoded tagged hash of the
+// stream, see crypto.NewTaggedHash, so the signature covers the pre-hashed stream. Nothing should be written afterwards.
+func (signer *StreamSigner) Finalize() (*document.Container, error) {
+	container, err := document.NewContainer(nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create container: %s", err)
+	}
+	container.SetType(StreamSignatureType)
+	container.Data.Options.Source = signer.entity.Data.Body.Id
+	container.Data.Body = hex.EncodeToString(signer.hash.Sum(nil))
+	if err := signer.entity.Sign(container); err != nil {
+		return nil, fmt.Errorf("Could not sign container: %w", err)
+	}
+	return container, nil
+}
+
+// StreamVerifier checks a stream against a stream signature in one pass without buffering it.
+type StreamVerifier struct {
+	digest []byte
+	hash   hash.Hash
+}
+
+// ThreatSpec TMv0.1 for Entity.NewStreamVerifier
+// Does verification of stream signature for App:Entity
+
+// NewStreamVerifier verifies the stream signature container with Verify and returns a StreamVerifier for the stream.
+// It returns ErrMalformedContainer if the container isn't a stream signature.
+func (entity *Entity) NewStreamVerifier(container *document.Container) (*StreamVerifier, error) {
+	if container.Data.Type != StreamSignatureType {
+		return nil, fmt.Errorf("Container type '%s' isn't '%s': %w", container.Data.Type, StreamSignatureType, ErrMalformedContainer)
+	}
+	if err := entity.Verify(container); err != nil {
+		return nil, err
+	}
+	digest, err := hex.DecodeString(container.Data.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode stream digest: %s: %w", err, ErrMalformedContainer)
+	}
+	return &StreamVerifier{digest: digest, hash: crypto.NewTaggedHash(crypto.TagStreamDigest)}, nil
+}
+
+// Write adds data to the verified stream. It never returns an error.
+func (verifier *StreamVerifier) Write(p []byte) (int, error) {
+	return verifier.hash.Write(p)
+}
+
+// ThreatSpec TMv0.1 for StreamVerifier.Verify
+// Does comparison of stream with signed digest for App:Entity
+
+// Verify checks that the data written matches the signed stream digest, returning ErrStreamMismatch and
+// ErrVerificationFailed if it doesn't.
+func (verifier *StreamVerifier) Verify() error {
+	if subtle.ConstantTimeCompare(verifier.hash.Sum(nil), verifier.digest) != 1 {
+		return fmt.Errorf("%w: %w", ErrStreamMismatch, ErrVerificationFailed)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// ThreatSpec package github.com/pki-io/core/entity as entity
+package entity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pki-io/core/crypto"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrInvalidVanityPrefix is returned when a vanity prefix isn't lowercase hex or is longer than a short key id.
+	ErrInvalidVanityPrefix = errors.New("Invalid vanity prefix")
+	// ErrVanityNotFound is returned when no key matching a vanity prefix was found within the maximum attempts.
+	ErrVanityNotFound = errors.New("No key found for vanity prefix")
+)
+
+// vanityKey is the signing key found by a GenerateVanity worker, or the error that stopped it.
+type vanityKey struct {
+	privateKey interface{}
+	publicKey  interface{}
+	err        error
+}
+
+// ThreatSpec TMv0.1 for Entity.GenerateVanity
+// Does key generation with a vanity short key id for App:Entity
+// Mitigates App:Entity against unbounded key generation with maximum attempts and cancellation
+
+// GenerateVanity is like GenerateKeys, but generates signing keys until the entity's short key id, see ShortKeyId,
+// starts with the given lowercase hex prefix. Keys are generated in parallel on all available CPUs, and at most
+// maxAttempts signing keys are generated in total. Each hex digit of the prefix takes 16 times as many attempts on
+// average, and EC keys are much faster to generate than RSA keys.
+//
+// The prefix only makes the short key id easier to recognise, it doesn't make it any safer to rely on.
+//
+// It returns ErrKeysAlreadyExist if the entity already has keys, ErrInvalidVanityPrefix if the prefix isn't valid,
+// ErrVanityNotFound if the attempts are exhausted and the context error if the context is done first.
+func (entity *Entity) GenerateVanity(ctx context.Context, prefix string, maxAttempts int) (err error) {
+	body := entity.Data.Body
+	if len(body.PublicSigningKey) > 0 || len(body.PrivateSigningKey) > 0 ||
+		len(body.PublicEncryptionKey) > 0 || len(body.PrivateEncryptionKey) > 0 {
+		return ErrKeysAlreadyExist
+	}
+	if len(prefix) == 0 || len(prefix) > 2*ShortKeyIdBytes || strings.Trim(prefix, "0123456789abcdef") != "" {
+		return fmt.Errorf("Prefix '%s': %w", prefix, ErrInvalidVanityPrefix)
+	}
+	defer func() { entity.logAudit(AuditOperationGenerateKeys, "", err) }()
+
+	keyType := crypto.KeyType(entity.Data.Body.KeyType)
+	signingKey := findVanityKey(ctx, keyType, prefix, maxAttempts)
+	if signingKey.err != nil {
+		return signingKey.err
+	}
+
+	encryptionKey, publicEncryptionKey, err := generateKey(keyType)
+	if err != nil {
+		return err
+	}
+	return entity.setKeys(signingKey.privateKey, encryptionKey, signingKey.publicKey, publicEncryptionKey)
+}
+
+// findVanityKey generates signing keys in parallel until the short key id of one starts with the prefix, maxAttempts
+// keys have been generated or the context is done.
+func findVanityKey(ctx context.Context, keyType crypto.KeyType, prefix string, maxAttempts int) vanityKey {
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var attempts atomic.Int64
+	var once sync.Once
+	var result vanityKey
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for workerCtx.Err() == nil && attempts.Add(1) <= int64(maxAttempts) {
+				privateKey, publicKey, err := generateKey(keyType)
+				var fingerprint string
+				if err == nil {
+					fingerprint, err = crypto.Fingerprint(publicKey)
+				}
+				if err != nil {
+					once.Do(func() { result.err = err })
+					cancel()
+					return
+				}
+				if strings.HasPrefix(shortKeyId(fingerprint), prefix) {
+					once.Do(func() { result.privateKey, result.publicKey = privateKey, publicKey })
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if result.err == nil && result.privateKey == nil {
+		if err := ctx.Err(); err != nil {
+			result.err = fmt.Errorf("Could not generate vanity key: %w", err)
+		} else {
+			result.err = fmt.Errorf("Prefix '%s' after %d attempts: %w", prefix, maxAttempts, ErrVanityNotFound)
+		}
+	}
+	return result
+}
@@ -0,0 +1,65 @@
+// ThreatSpec package github.com/pki-io/core/entity as entity
+package entity
+
+import (
+	gocrypto "crypto"
+	"fmt"
+	"github.com/pki-io/core/crypto"
+	"github.com/pki-io/core/document"
+)
+
+// Verifier verifies container signatures from a known signer, holding only its id and parsed public signing key.
+// It accepts the same containers as Entity.Verify on the signer's public entity, without the generation and decryption
+// machinery of an Entity. A Verifier is safe for concurrent use.
+type Verifier struct {
+	id        string
+	keyType   crypto.KeyType
+	publicKey gocrypto.PublicKey
+}
+
+// ThreatSpec TMv0.1 for NewVerifier
+// Creates new verification-only entity for App:Entity
+// Mitigates App:Entity against weak or malformed signer keys with public key validation
+
+// NewVerifier returns a Verifier for the signer with the given id and PEM encoded public signing key.
+// The key is parsed and validated once, returning crypto.ErrMalformedKey or crypto.ErrInvalidPublicKey if it can't be used.
+func NewVerifier(id, publicSigningKey string) (*Verifier, error) {
+	publicKey, err := crypto.PemDecodePublic([]byte(publicSigningKey))
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode public signing key: %w", err)
+	}
+	keyType, err := crypto.GetKeyType(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{id: id, keyType: keyType, publicKey: publicKey}, nil
+}
+
+// Id returns the signer's id.
+func (verifier *Verifier) Id() string {
+	return verifier.id
+}
+
+// ThreatSpec TMv0.1 for Verifier.Verify
+// Does container signature verification with a verification-only entity for App:Entity
+
+// Verify verifies the container signature like Entity.Verify: the signature mode must match the key type and meet the
+// minimum set by SetMinSignatureStrength, and containers signed with a context return ErrContextMismatch.
+func (verifier *Verifier) Verify(container *document.Container) (err error) {
+	defer crypto.Observe(crypto.OperationVerify, crypto.StartTimer())
+	defer func() { logAuditEvent(verifier.id, AuditOperationVerify, container.Data.Options.Source, err) }()
+	if !container.IsSigned() {
+		return fmt.Errorf("Container isn't signed: %w", ErrVerificationFailed)
+	}
+	if err := checkSignatureMode(verifier.keyType, crypto.Mode(container.Data.Options.SignatureMode)); err != nil {
+		return err
+	}
+	if err := container.VerifyWithKey(verifier.publicKey); err != nil {
+		return err
+	}
+
+	if signedContext := container.Data.Options.SignatureInputs["context"]; len(signedContext) > 0 {
+		return fmt.Errorf("Expected no context but got '%s': %w", signedContext, ErrContextMismatch)
+	}
+	return nil
+}
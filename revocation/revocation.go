@@ -0,0 +1,159 @@
+// ThreatSpec package github.com/pki-io/core/revocation as revocation
+package revocation
+
+import (
+	"fmt"
+	"github.com/pki-io/core/document"
+	"time"
+)
+
+// RevocationListDefault provides default values for RevocationList.
+const RevocationListDefault string = `{
+    "scope": "pki.io",
+    "version": 1,
+    "type": "revocation-list-document",
+    "options": "",
+    "body": {
+        "issuer-id": "",
+        "revoked": {}
+    }
+}`
+
+// RevocationListSchema defines the JSON Schema for RevocationList.
+const RevocationListSchema string = `{
+  "$schema": "http://json-schema.org/draft-04/schema#",
+  "title": "RevocationListDocument",
+  "description": "Revocation List Document",
+  "type": "object",
+  "required": ["scope","version","type","options","body"],
+  "additionalProperties": false,
+  "properties": {
+      "scope": {
+          "description": "Scope of the document",
+          "type": "string"
+      },
+      "version": {
+          "description": "Document schema version",
+          "type": "integer"
+      },
+      "type": {
+          "description": "Type of document",
+          "type": "string"
+      },
+      "options": {
+          "description": "Options data",
+          "type": "string"
+      },
+      "body": {
+          "description": "Body data",
+          "type": "object",
+          "required": ["issuer-id", "revoked"],
+          "additionalProperties": false,
+          "properties": {
+              "issuer-id" : {
+                  "description": "ID of the issuer that revoked the entities",
+                  "type": "string"
+              },
+              "revoked": {
+                  "description": "Revoked entity IDs mapped to the Unix time they were revoked",
+                  "type": "object",
+                  "additionalProperties": {
+                      "type": "integer"
+                  }
+              }
+          }
+      }
+  }
+}`
+
+// RevocationListData represents parsed RevocationList JSON data.
+type RevocationListData struct {
+	Scope   string `json:"scope"`
+	Version int    `json:"version"`
+	Type    string `json:"type"`
+	Options string `json:"options"`
+	Body    struct {
+		IssuerId string           `json:"issuer-id"`
+		Revoked  map[string]int64 `json:"revoked"`
+	} `json:"body"`
+}
+
+// RevocationList lists the entities revoked by an issuer. It should be signed by the issuer before being distributed.
+type RevocationList struct {
+	document.Document
+	Data RevocationListData
+}
+
+// ThreatSpec TMv0.1 for New
+// Creates new revocation list for App:Revocation
+
+// New returns a new RevocationList.
+func New(jsonString interface{}) (*RevocationList, error) {
+	list := new(RevocationList)
+	list.Schema = RevocationListSchema
+	list.Default = RevocationListDefault
+	if err := list.Load(jsonString); err != nil {
+		return nil, fmt.Errorf("Could not create new revocation list: %w", err)
+	} else {
+		return list, nil
+	}
+}
+
+// ThreatSpec TMv0.1 for RevocationList.Load
+// Does revocation list JSON loading for App:Revocation
+
+// Load takes a JSON string and sets the revocation list data.
+func (list *RevocationList) Load(jsonString interface{}) error {
+	data := new(RevocationListData)
+	if data, err := list.FromJson(jsonString, data); err != nil {
+		return fmt.Errorf("Could not load revocation list JSON: %w", err)
+	} else {
+		list.Data = *data.(*RevocationListData)
+		if list.Data.Body.Revoked == nil {
+			list.Data.Body.Revoked = make(map[string]int64)
+		}
+		return nil
+	}
+}
+
+// ThreatSpec TMv0.1 for RevocationList.Dump
+// Does revocation list JSON dumping for App:Revocation
+
+// Dump serializes the revocation list, returning a JSON string.
+func (list *RevocationList) Dump() string {
+	if jsonString, err := list.ToJson(list.Data); err != nil {
+		return ""
+	} else {
+		return jsonString
+	}
+}
+
+// IssuerId returns the ID of the issuer of the revocation list.
+func (list *RevocationList) IssuerId() string {
+	return list.Data.Body.IssuerId
+}
+
+// ThreatSpec TMv0.1 for RevocationList.Add
+// Does entity revocation for App:Revocation
+
+// Add revokes the entity with the given id as of now. Revoking an entity that is already revoked keeps the original time.
+func (list *RevocationList) Add(id string) {
+	if _, ok := list.Data.Body.Revoked[id]; !ok {
+		list.Data.Body.Revoked[id] = time.Now().Unix()
+	}
+}
+
+// IsRevoked checks whether the entity with the given id has been revoked.
+func (list *RevocationList) IsRevoked(id string) bool {
+	_, ok := list.Data.Body.Revoked[id]
+	return ok
+}
+
+// RevokedAt returns the time the entity with the given id was revoked, and whether it has been revoked.
+func (list *RevocationList) RevokedAt(id string) (time.Time, bool) {
+	revoked, ok := list.Data.Body.Revoked[id]
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(revoked, 0), true
+}
@@ -0,0 +1,28 @@
+package revocation
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRevocationListNew(t *testing.T) {
+	list, err := New(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, list.Data.Scope, "pki.io")
+	assert.False(t, list.IsRevoked("1"))
+}
+
+func TestRevocationListAdd(t *testing.T) {
+	list, _ := New(nil)
+	list.Add("1")
+	assert.True(t, list.IsRevoked("1"))
+	assert.False(t, list.IsRevoked("2"))
+
+	revokedAt, ok := list.RevokedAt("1")
+	assert.True(t, ok)
+	assert.False(t, revokedAt.IsZero())
+
+	newList, err := New(list.Dump())
+	assert.NoError(t, err)
+	assert.True(t, newList.IsRevoked("1"))
+}
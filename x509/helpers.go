@@ -24,6 +24,9 @@ func PemEncodeX509CertificateDER(cert []byte) []byte {
 
 func PemDecodeX509Certificate(in []byte) (*x509.Certificate, error) {
 	b, _ := pem.Decode(in)
+	if b == nil {
+		return nil, fmt.Errorf("Could not decode PEM")
+	}
 	if certs, err := x509.ParseCertificates(b.Bytes); err != nil {
 		return nil, fmt.Errorf("Could not parse certificate: %s", err)
 	} else {
@@ -44,6 +47,9 @@ func PemEncodeX509CSRDER(cert []byte) []byte {
 
 func PemDecodeX509CSR(in []byte) (*x509.CertificateRequest, error) {
 	b, _ := pem.Decode(in)
+	if b == nil {
+		return nil, fmt.Errorf("Could not decode PEM")
+	}
 	if csr, err := x509.ParseCertificateRequest(b.Bytes); err != nil {
 		return nil, fmt.Errorf("Could not parse csr: %s", err)
 	} else {